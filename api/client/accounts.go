@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"shifumi-game/pkg/accounts"
+	"shifumi-game/pkg/kafka"
+	"strings"
+	"time"
+)
+
+// AccountConfirmTimeout is how long registering an account waits for it to be read back from the
+// account registry
+const AccountConfirmTimeout = 10 * time.Second
+
+// AccountsHandler serves the player account endpoints:
+// POST /accounts registers an account and returns its API key,
+// GET /accounts/<id> returns the profile of an account,
+// POST /accounts/<id>/key replaces the API key of an account, with its current key in the X-API-Key header.
+func AccountsHandler(w http.ResponseWriter, r *http.Request, kafkaBroker string) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/accounts"), "/")
+	id, action, _ := strings.Cut(path, "/")
+
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		createAccount(w, r, kafkaBroker)
+	case id != "" && action == "" && r.Method == http.MethodGet:
+		account, ok := accounts.Get(id)
+		if !ok {
+			http.Error(w, accounts.ErrNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(account.Profile())
+	case id != "" && action == "key" && r.Method == http.MethodPost:
+		rotateAccountKey(w, r, kafkaBroker, id)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// createAccount registers an account under the display name of the request
+func createAccount(w http.ResponseWriter, r *http.Request, kafkaBroker string) {
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	account, apiKey, err := accounts.Create(request.Name, time.Now())
+	if errors.Is(err, accounts.ErrNameTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := kafka.SaveAccount(kafkaBroker, account); err != nil {
+		accounts.Release(account.ID)
+		log.Printf(Red+"[ERROR] Failed to save player account | Name: %s | Error: %v"+Reset, account.Name, err)
+		http.Error(w, "Error saving player account", http.StatusInternalServerError)
+		return
+	}
+
+	// Another instance may have registered the same name in the meantime: the account registry keeps
+	// the first one, and the other account is removed
+	ctx, cancel := context.WithTimeout(r.Context(), AccountConfirmTimeout)
+	defer cancel()
+	if err := accounts.Confirm(ctx, account.ID); err != nil {
+		if err := kafka.DeleteAccount(kafkaBroker, account.ID); err != nil {
+			log.Printf(Red+"[ERROR] Failed to delete player account | AccountID: %s | Error: %v"+Reset, account.ID, err)
+		}
+		if errors.Is(err, accounts.ErrNameTaken) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf(Red+"[ERROR] Player account was not read back from the registry | Name: %s | Error: %v"+Reset, account.Name, err)
+		http.Error(w, "Error saving player account", http.StatusInternalServerError)
+		return
+	}
+	log.Printf(Green+"[INFO] Player account created | AccountID: %s | Name: %s"+Reset, account.ID, account.Name)
+	respondAccount(w, http.StatusCreated, account, apiKey)
+}
+
+// rotateAccountKey replaces the API key of an account, authenticated with its current key
+func rotateAccountKey(w http.ResponseWriter, r *http.Request, kafkaBroker, id string) {
+	account, err := accounts.Authenticate(r.Header.Get("X-API-Key"))
+	if err != nil || subtle.ConstantTimeCompare([]byte(account.ID), []byte(id)) != 1 {
+		http.Error(w, "Invalid API key.", http.StatusUnauthorized)
+		return
+	}
+
+	updated, apiKey, err := accounts.RotateKey(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := kafka.SaveAccount(kafkaBroker, updated); err != nil {
+		accounts.Put(account)
+		log.Printf(Red+"[ERROR] Failed to save player account | AccountID: %s | Error: %v"+Reset, id, err)
+		http.Error(w, "Error saving player account", http.StatusInternalServerError)
+		return
+	}
+	log.Printf(Green+"[INFO] Player API key rotated | AccountID: %s"+Reset, id)
+	respondAccount(w, http.StatusOK, updated, apiKey)
+}
+
+// respondAccount writes the profile of an account with its API key, which is only ever sent here
+func respondAccount(w http.ResponseWriter, status int, account accounts.Account, apiKey string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		accounts.Profile
+		APIKey string `json:"api_key"`
+	}{account.Profile(), apiKey})
+}
@@ -2,17 +2,21 @@ package client
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
+	"math/big"
 	"net/http"
+	"shifumi-game/pkg/accounts"
+	"shifumi-game/pkg/auth"
+	"shifumi-game/pkg/engine"
 	"shifumi-game/pkg/kafka"
 	"shifumi-game/pkg/models"
-	"strconv"
+	"shifumi-game/pkg/store"
+	"strings"
 	"time"
-
-	kafkago "github.com/segmentio/kafka-go"
 )
 
 const (
@@ -23,28 +27,36 @@ const (
 	Orange = "\033[33m"
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
+// tokens issues and verifies the player tokens, nil when they are disabled
+var tokens *auth.Keys
+
+// SetTokenKeys enables player tokens: players get a token when they take a seat, and must send it
+// with their later moves. A nil keys disables them.
+func SetTokenKeys(keys *auth.Keys) {
+	tokens = keys
 }
 
-// generateSessionID genereates a new session ID when first player joins
-func generateSessionID() string {
-	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	b := make([]byte, 10)
-	for i := range b {
-		b[i] = letters[rand.Intn(len(letters))]
-	}
-	return string(b)
+// sessions holds the game sessions the moves are checked against
+var sessions store.SessionStore
+
+// SetSessionStore sets the store the game sessions are read from
+func SetSessionStore(s store.SessionStore) {
+	sessions = s
 }
 
-// isValidChoice determines if the player choice is valid
-func isValidChoice(choice string) bool {
-	validChoices := map[string]bool{
-		"rock":     true,
-		"paper":    true,
-		"scissors": true,
+// newInviteCode draws the invite code of a private session from a cryptographically secure source,
+// e.g. "k7qpm-9xzab", leaving out the characters that are easily mistaken for one another
+func newInviteCode() (string, error) {
+	const letters = "abcdefghjkmnpqrstuvwxyz23456789"
+	b := make([]byte, 10)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(letters))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = letters[n.Int64()]
 	}
-	return validChoices[choice]
+	return string(b[:5]) + "-" + string(b[5:]), nil
 }
 
 // MakeChoiceHandler handles player choices and serves the /play API endpoint
@@ -58,152 +70,370 @@ func MakeChoiceHandler(w http.ResponseWriter, r *http.Request, kafkaBroker strin
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	choice.Type = models.MessageChoice
 
 	log.Printf(Green+"[INFO] Player choice received | PlayerID: %s | SessionID: %s | Choice: %s"+Reset, choice.PlayerID, choice.SessionID, choice.Choice)
 
-	if !isValidChoice(choice.Choice) {
-		log.Printf(Red+"[ERROR] Invalid choice received: %s"+Reset, choice.Choice)
-		http.Error(w, "Invalid choice. Must be rock, paper, or scissors.", http.StatusBadRequest)
+	wait, err := playWait(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	move := engine.Move{Type: models.MessageChoice, Choice: choice.Choice}
+	if gameSession, ok := submit(w, r, kafkaBroker, &choice.Envelope, models.ModeOpen, move, &choice); ok {
+		respondToMove(w, r, choice.Envelope, gameSession.CurrentRound, "Choice submitted successfully", wait)
+	}
+}
+
+// CommitHandler handles the commitments of commit-reveal sessions and serves the /commit API endpoint.
+// Creating a session through /commit makes it a commit-reveal session.
+func CommitHandler(w http.ResponseWriter, r *http.Request, kafkaBroker string) {
+	log.Println(Green + "[INFO] Received request to CommitHandler" + Reset)
+
+	var commit models.PlayerCommit
+	if err := json.NewDecoder(r.Body).Decode(&commit); err != nil {
+		log.Printf(Red+"[ERROR] Error decoding player commit: %v"+Reset, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	commit.Type = models.MessageCommit
+
+	log.Printf(Green+"[INFO] Player commit received | PlayerID: %s | SessionID: %s"+Reset, commit.PlayerID, commit.SessionID)
+
+	move := engine.Move{Type: models.MessageCommit, Commitment: commit.Commitment}
+	if _, ok := submit(w, r, kafkaBroker, &commit.Envelope, models.ModeCommitReveal, move, &commit); ok {
+		respond(w, http.StatusOK, commit.Envelope, "Commitment submitted successfully")
+	}
+}
+
+// RevealHandler handles the reveals of commit-reveal sessions and serves the /reveal API endpoint
+func RevealHandler(w http.ResponseWriter, r *http.Request, kafkaBroker string) {
+	log.Println(Green + "[INFO] Received request to RevealHandler" + Reset)
+
+	var reveal models.PlayerReveal
+	if err := json.NewDecoder(r.Body).Decode(&reveal); err != nil {
+		log.Printf(Red+"[ERROR] Error decoding player reveal: %v"+Reset, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reveal.Type = models.MessageReveal
+
+	log.Printf(Green+"[INFO] Player reveal received | PlayerID: %s | SessionID: %s"+Reset, reveal.PlayerID, reveal.SessionID)
+
+	if reveal.SessionID == "" || reveal.PlayerID == "" {
+		log.Printf(Red + "[ERROR] Reveal received without session ID or player ID" + Reset)
+		http.Error(w, "Session ID and player ID are required to reveal a choice.", http.StatusBadRequest)
+		return
+	}
+
+	wait, err := playWait(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	move := engine.Move{Type: models.MessageReveal, Choice: reveal.Choice, Salt: reveal.Salt}
+	if gameSession, ok := submit(w, r, kafkaBroker, &reveal.Envelope, models.ModeCommitReveal, move, &reveal); ok {
+		respondToMove(w, r, reveal.Envelope, gameSession.CurrentRound, "Reveal submitted successfully", wait)
+	}
+}
+
+// JoinHandler serves the /join API endpoint: it creates a session without a first move when no
+// session ID is given, and takes the next free seat of a session otherwise, so that players can
+// gather before anyone throws
+func JoinHandler(w http.ResponseWriter, r *http.Request, kafkaBroker string) {
+	log.Println(Green + "[INFO] Received request to JoinHandler" + Reset)
+
+	var join models.Envelope
+	if err := json.NewDecoder(r.Body).Decode(&join); err != nil {
+		log.Printf(Red+"[ERROR] Error decoding join request: %v"+Reset, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	join.Type = models.MessageJoin
+	if join.PlayerID != "" {
+		http.Error(w, "Player ID is allocated when joining.", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := submit(w, r, kafkaBroker, &join, "", engine.Move{Type: models.MessageJoin}, &join); ok {
+		respond(w, http.StatusOK, join, "Joined successfully")
+	}
+}
+
+// ControlHandler serves the /pause, /resume and /cancel API endpoints, for a player seated in the session
+func ControlHandler(w http.ResponseWriter, r *http.Request, kafkaBroker string, command string) {
+	log.Printf(Green+"[INFO] Received request to ControlHandler | Command: %s"+Reset, command)
+
+	var control models.Envelope
+	if err := json.NewDecoder(r.Body).Decode(&control); err != nil {
+		log.Printf(Red+"[ERROR] Error decoding %s request: %v"+Reset, command, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	control.Type = command
+	if control.SessionID == "" || control.PlayerID == "" {
+		http.Error(w, fmt.Sprintf("Session ID and player ID are required to %s a session.", command), http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := submit(w, r, kafkaBroker, &control, "", engine.Move{Type: command}, &control); ok {
+		respond(w, http.StatusOK, control, fmt.Sprintf("Session %s requested successfully", command))
+	}
+}
+
+// submit checks a move against the session with the game engine, then publishes it. Without a session ID,
+// the move creates a new session with the options of the envelope, and the sender becomes Player 1. A move
+// without a player ID takes the next free seat. mode is the move protocol the endpoint serves, empty for
+// both. Rejected moves are never published: submit writes the error response and returns false. It returns
+// the session the move was checked against otherwise.
+func submit(w http.ResponseWriter, r *http.Request, kafkaBroker string, envelope *models.Envelope, mode string, move engine.Move, message interface{}) (*models.GameSession, bool) {
+	seated := envelope.PlayerID != ""
+	// The hash of the invite code is only computed here, from the code
+	envelope.InviteHash = ""
+
+	// A player taking a seat may sign in with the API key of their account, seated players play with
+	// the account of their seat
+	envelope.AccountID = ""
+	if apiKey := r.Header.Get("X-API-Key"); !seated && apiKey != "" {
+		account, err := accounts.Authenticate(apiKey)
+		if err != nil {
+			log.Printf(Red+"[ERROR] Account authentication failed: %v"+Reset, err)
+			http.Error(w, "Invalid API key.", http.StatusUnauthorized)
+			return nil, false
+		}
+		envelope.AccountID = account.ID
+	}
+
+	gameSession, ok := loadSession(w, kafkaBroker, envelope, mode)
+	if !ok {
+		return nil, false
+	}
 
-	if choice.SessionID == "" {
+	// Moves from a seated player need the token issued with their seat
+	if seated && tokens != nil {
+		if envelope.Token == "" {
+			envelope.Token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		claims, err := tokens.Verify(envelope.Token, envelope.SessionID, envelope.PlayerID, time.Now())
+		if err != nil {
+			log.Printf(Red+"[ERROR] Player token rejected | SessionID: %s | PlayerID: %s | Error: %v"+Reset, envelope.SessionID, envelope.PlayerID, err)
+			http.Error(w, "Missing or invalid player token.", http.StatusUnauthorized)
+			return nil, false
+		}
+		envelope.AccountID = claims.AccountID
+	} else if player := gameSession.Player(envelope.PlayerID); seated && player != nil {
+		envelope.AccountID = player.AccountID
+	}
+
+	if envelope.PlayerID == "" {
+		envelope.PlayerID = gameSession.NextPlayerID()
+		if envelope.PlayerID == "" {
+			log.Printf("[ERROR] Session is full; all %d seats are taken.", gameSession.NumPlayers)
+			http.Error(w, fmt.Sprintf("Session is full; all %d seats are taken.", gameSession.NumPlayers), http.StatusConflict)
+			return nil, false
+		}
+	}
+	move.PlayerID = envelope.PlayerID
+	move.AccountID = envelope.AccountID
+	if envelope.InviteCode != "" {
+		move.InviteHash = models.InviteHash(envelope.SessionID, envelope.InviteCode)
+	}
+	move.At = time.Now()
+
+	// Player 1 is seated when the session is created
+	if !envelope.InitSession || move.Type != models.MessageJoin {
+		if _, _, err := engine.Apply(gameSession, move); err != nil {
+			rejectMove(w, gameSession, err)
+			return nil, false
+		}
+	}
+
+	if envelope.InitSession {
+		sessionID, err := store.NewSessionID(r.Context(), sessions, "")
+		if err != nil {
+			log.Printf(Red+"[ERROR] Error drawing a session ID: %v"+Reset, err)
+			http.Error(w, "Error creating session", http.StatusInternalServerError)
+			return nil, false
+		}
+		envelope.SessionID = sessionID
+		log.Printf("[INFO] New session created | SessionID: %s", envelope.SessionID)
+	}
+
+	// A player taking a seat gets the token authenticating their later moves
+	if !seated && tokens != nil {
+		token, err := tokens.Issue(auth.Claims{SessionID: envelope.SessionID, PlayerID: envelope.PlayerID, AccountID: envelope.AccountID}, time.Now())
+		if err != nil {
+			log.Printf(Red+"[ERROR] Failed to issue player token | SessionID: %s | Error: %v"+Reset, envelope.SessionID, err)
+			http.Error(w, "Failed to issue player token", http.StatusInternalServerError)
+			return nil, false
+		}
+		envelope.Token = token
+	}
+
+	// Only the hash of the invite code is published, so that reading the topics does not let anyone
+	// join the session. Player 1 still gets the code back in the response.
+	inviteCode := envelope.InviteCode
+	if inviteCode != "" {
+		envelope.InviteCode, envelope.InviteHash = "", models.InviteHash(envelope.SessionID, inviteCode)
+	}
+	err := kafka.PublishPlayerMessage(kafkaBroker, *envelope, message)
+	envelope.InviteCode = inviteCode
+	if err != nil {
+		log.Printf("[ERROR] Failed to publish player %s | SessionID: %s | Error: %v", envelope.Type, envelope.SessionID, err)
+		http.Error(w, fmt.Sprintf("Failed to submit %s", envelope.Type), http.StatusInternalServerError)
+		return nil, false
+	}
+	return gameSession, true
+}
+
+// loadSession returns the session a move is sent to. Without a session ID, it validates the options of the
+// envelope and returns the session they create, with the sender as Player 1. With a session ID, it fetches
+// the game session, which must use the mode of the endpoint. It writes an error response and returns false
+// if the session cannot be used.
+func loadSession(w http.ResponseWriter, kafkaBroker string, envelope *models.Envelope, mode string) (*models.GameSession, bool) {
+	if envelope.SessionID == "" {
 		// Case 1: First player starting a new session
-		if choice.PlayerID != "" {
+		if envelope.PlayerID != "" {
 			log.Printf("[ERROR] Player ID cannot be provided without a session ID for the first player.")
 			http.Error(w, "Player ID cannot be provided without a session ID for the first player.", http.StatusBadRequest)
-			return
-		}
-		// Initialize new session
-		choice.SessionID = generateSessionID()
-		choice.PlayerID = "1"
-		choice.InitSession = true
-		if err := kafka.CreateTopicForSession(kafkaBroker, choice.SessionID, 1, 1); err != nil {
-			log.Printf("[ERROR] Error creating topic for session: %v", err)
-			http.Error(w, "Error creating Kafka topic", http.StatusInternalServerError)
-			return
-		}
-		log.Printf("[INFO] New session created | SessionID: %s", choice.SessionID)
-
-	} else {
-		// Case 2: Existing session, fetch the game session
-		var gameSession *models.GameSession
-		topicName := "game-results-" + choice.SessionID
-		gameSession, err = kafka.ReadGameSession(topicName, choice.SessionID, kafkaBroker, "client-reader")
-		if err != nil {
-			log.Printf("[ERROR] Error fetching game session: %v", err)
-			http.Error(w, "Error retrieving game session", http.StatusInternalServerError)
-			return
-		}
-
-		if gameSession == nil {
-			log.Printf("[INFO] No message found within timeout")
-			http.Error(w, "Session ID does not exist, or the server is busy processing another player's choice.", http.StatusBadRequest)
-			// Publish the player choice to Kafka
-			if err := publishPlayerChoice(choice, kafkaBroker); err != nil {
-				log.Printf("[ERROR] Failed to publish player choice | SessionID: %s | Error: %v", choice.SessionID, err)
-				http.Error(w, "Failed to submit choice", http.StatusInternalServerError)
-			}
-			return
-		}
-
-		// Determine if player 2 is joining
-		if choice.PlayerID == "" {
-			if !gameSession.HasPlayer2Played() && gameSession.HasPlayer1Played() {
-				choice.PlayerID = "2"
-				log.Printf("[INFO] Player 2 joined session | SessionID: %s", choice.SessionID)
-			} else if gameSession.HasPlayer2Played() {
-				log.Printf("[ERROR] Session is full; Player 2 has already joined.")
-				http.Error(w, "Session is full; Player 2 has already joined.", http.StatusConflict)
-				return
-			} else {
-				log.Printf("[ERROR] Player 2 cannot join yet, waiting for Player 1 to play.")
-				http.Error(w, "Player 2 cannot join yet, waiting for Player 1 to play.", http.StatusBadRequest)
-				// Publish the player choice to Kafka
-				if err := publishPlayerChoice(choice, kafkaBroker); err != nil {
-					log.Printf("[ERROR] Failed to publish player choice | SessionID: %s | Error: %v", choice.SessionID, err)
-					http.Error(w, "Failed to submit choice", http.StatusInternalServerError)
-				}
-				return
-			}
-		} else {
-			// Validate if player ID is within allowed limits
-			playerIDNum, err := strconv.Atoi(choice.PlayerID)
-			if err != nil || playerIDNum > models.MaxPlayers {
-				log.Printf("[ERROR] Invalid PlayerID for session.")
-				http.Error(w, "Invalid PlayerID for session.", http.StatusConflict)
-				// Publish the player choice to Kafka
-				if err := publishPlayerChoice(choice, kafkaBroker); err != nil {
-					log.Printf("[ERROR] Failed to publish player choice | SessionID: %s | Error: %v", choice.SessionID, err)
-					http.Error(w, "Failed to submit choice", http.StatusInternalServerError)
-				}
-				return
+			return nil, false
+		}
+		// Player 1 picks the options of the session: variant, match format, number of players and scoring
+		if mode != "" {
+			if envelope.Mode != "" && envelope.Mode != mode {
+				log.Printf(Red+"[ERROR] Mode %s requested from a %s endpoint"+Reset, envelope.Mode, mode)
+				http.Error(w, fmt.Sprintf("Mode %s cannot be used on this endpoint.", envelope.Mode), http.StatusBadRequest)
+				return nil, false
 			}
-
-			// Check if the player has already played in the current round
-			if (choice.PlayerID == "1" && gameSession.HasPlayer1Played()) ||
-				(choice.PlayerID == "2" && gameSession.HasPlayer2Played()) {
-				log.Printf(Red+"[ERROR] Player %s has already played this round | SessionID: %s", choice.PlayerID, choice.SessionID)
-				http.Error(w, "Player has already played this round", http.StatusConflict)
-				// Publish the player choice to Kafka
-				if err := publishPlayerChoice(choice, kafkaBroker); err != nil {
-					log.Printf("[ERROR] Failed to publish player choice | SessionID: %s | Error: %v", choice.SessionID, err)
-					http.Error(w, "Failed to submit choice", http.StatusInternalServerError)
-				}
-				return
+			envelope.Mode = mode
+		}
+		// Private sessions get an invite code unless Player 1 picked a passphrase
+		if envelope.Private && envelope.InviteCode == "" {
+			inviteCode, err := newInviteCode()
+			if err != nil {
+				log.Printf(Red+"[ERROR] Error drawing an invite code: %v"+Reset, err)
+				http.Error(w, "Error creating session", http.StatusInternalServerError)
+				return nil, false
 			}
+			envelope.InviteCode = inviteCode
 		}
+		gameSession, _, err := engine.New("", envelope.SessionOptions, envelope.AccountID, time.Now())
+		if err == nil {
+			err = checkSpectators(envelope.SessionOptions)
+		}
+		if err != nil {
+			log.Printf(Red+"[ERROR] Invalid session options requested: %v"+Reset, err)
+			http.Error(w, fmt.Sprintf("Invalid session options: %v", err), http.StatusBadRequest)
+			return nil, false
+		}
+		envelope.Variant = gameSession.Variant
+		envelope.PlayerID = "1"
+		envelope.InitSession = true
+		return gameSession, true
+	}
 
-		// Check if the game session has finished
-		if gameSession.Status == "finished" {
-			log.Printf("[ERROR] Attempt to play in a finished game session: %s", choice.SessionID)
-			http.Error(w, fmt.Sprintf("Game has already finished. %s won!", gameSession.Winner), http.StatusConflict)
-			return
+	// Case 2: Existing session, fetch the game session
+	gameSession, err := sessions.Get(context.Background(), envelope.SessionID)
+	if errors.Is(err, store.ErrNotFound) {
+		log.Printf("[INFO] No game session found | SessionID: %s", envelope.SessionID)
+		http.Error(w, "Session ID does not exist, or the server is busy processing another player's choice.", http.StatusBadRequest)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("[ERROR] Error fetching game session: %v", err)
+		http.Error(w, "Error retrieving game session", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	// The session options are fixed when the session is created
+	if !envelope.SessionOptions.IsZero() {
+		log.Printf(Red+"[ERROR] Session options requested for existing session %s"+Reset, envelope.SessionID)
+		http.Error(w, "Session options can only be chosen when creating a session.", http.StatusBadRequest)
+		return nil, false
+	}
+	if mode != "" && gameSession.Mode != mode {
+		log.Printf(Red+"[ERROR] %s move received for %s session %s"+Reset, mode, gameSession.Mode, envelope.SessionID)
+		if gameSession.Mode == models.ModeCommitReveal {
+			http.Error(w, "Session uses commit-reveal; submit a commitment on /commit, then reveal it on /reveal.", http.StatusBadRequest)
+		} else {
+			http.Error(w, "Session does not use commit-reveal; submit your choice on /play.", http.StatusBadRequest)
 		}
+		return nil, false
+	}
+	return gameSession, true
+}
+
+// checkSpectators rejects the sessions kept from spectators when player tokens are disabled: the
+// players could not prove their seat, so the session could not be kept from anyone
+func checkSpectators(opts models.SessionOptions) error {
+	if opts.NoSpectators && tokens == nil {
+		return errors.New("no_spectators needs player tokens, which are disabled as AUTH_KEY is not set")
 	}
+	return nil
+}
 
-	// Publish the player choice to Kafka
-	if err := publishPlayerChoice(choice, kafkaBroker); err != nil {
-		log.Printf("[ERROR] Failed to publish player choice | SessionID: %s | Error: %v", choice.SessionID, err)
-		http.Error(w, "Failed to submit choice", http.StatusInternalServerError)
+// rejectMove writes the error response of a move rejected by the game engine
+func rejectMove(w http.ResponseWriter, gameSession *models.GameSession, err error) {
+	log.Printf(Red+"[ERROR] Move rejected | SessionID: %s | Error: %v"+Reset, gameSession.SessionID, err)
+
+	var stateErr *engine.StateError
+	if errors.As(err, &stateErr) {
+		switch stateErr.Status {
+		case models.StatusFinished:
+			if gameSession.Winner == "" {
+				http.Error(w, "Game has already finished in a draw.", http.StatusConflict)
+			} else {
+				http.Error(w, fmt.Sprintf("Game has already finished. %s won!", gameSession.Winner), http.StatusConflict)
+			}
+		case models.StatusAbandoned:
+			http.Error(w, "Game has been abandoned after too many missed round deadlines.", http.StatusConflict)
+		case models.StatusCancelled:
+			http.Error(w, "Game has been cancelled.", http.StatusConflict)
+		case models.StatusPaused:
+			http.Error(w, "Game is paused; resume it on /resume to keep playing.", http.StatusConflict)
+		default:
+			http.Error(w, fmt.Sprintf("Cannot %s: %v.", stateErr.Command, err), http.StatusConflict)
+		}
 		return
 	}
 
-	response := map[string]interface{}{
-		"session_id": choice.SessionID,
-		"player_id":  choice.PlayerID,
-		"status":     "Choice submitted successfully",
+	var moveErr *engine.MoveError
+	if errors.As(err, &moveErr) {
+		status := http.StatusConflict
+		if errors.Is(err, engine.ErrInvalidMove) || errors.Is(err, engine.ErrWrongMode) {
+			status = http.StatusBadRequest
+		}
+		if errors.Is(err, engine.ErrNotInvited) {
+			status = http.StatusForbidden
+		}
+		http.Error(w, moveErr.Error(), status)
+		return
 	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// respond writes the session and player IDs allocated to the sender of a move, with their player token
+func respond(w http.ResponseWriter, code int, envelope models.Envelope, status string) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(seatResponse(envelope, status))
 	log.Println("[INFO] Response sent to client")
 }
 
-// publishPlayerChoice writes the player choice struct to the player-choices topic
-func publishPlayerChoice(choice models.PlayerChoice, kafkaBroker string) error {
-	writer := kafkago.NewWriter(kafkago.WriterConfig{
-		Brokers:  []string{kafkaBroker},
-		Topic:    "player-choices",
-		Balancer: &kafkago.LeastBytes{},
-	})
-	defer writer.Close()
-
-	message, err := json.Marshal(choice)
-	if err != nil {
-		log.Printf(Red+"[ERROR] Failed to marshal player choice: %v"+Reset, err)
-		return err
+// seatResponse returns the response body of a move: the session and player IDs of the sender, their
+// player token, and the invite code of the private session they created
+func seatResponse(envelope models.Envelope, status string) map[string]interface{} {
+	response := map[string]interface{}{
+		"session_id": envelope.SessionID,
+		"player_id":  envelope.PlayerID,
+		"status":     status,
 	}
-
-	err = writer.WriteMessages(context.Background(), kafkago.Message{
-		Key:   []byte(choice.SessionID),
-		Value: message,
-	})
-	if err != nil {
-		log.Printf(Red+"[ERROR] Failed to write player choice to Kafka: %v"+Reset, err)
-		return err
+	if envelope.Token != "" {
+		response["token"] = envelope.Token
 	}
-
-	log.Printf(Green+"[INFO] Successfully published player choice | SessionID: %s | PlayerID: %s | Message: %s"+Reset, choice.SessionID, choice.PlayerID, message)
-	return nil
+	// Player 1 shares the invite code of a private session with the other players
+	if envelope.InitSession && envelope.InviteCode != "" {
+		response["invite_code"] = envelope.InviteCode
+	}
+	return response
 }
@@ -0,0 +1,316 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"shifumi-game/pkg/accounts"
+	"shifumi-game/pkg/auth"
+	"shifumi-game/pkg/engine"
+	"shifumi-game/pkg/kafka"
+	"shifumi-game/pkg/matchmaking"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/rating"
+	"shifumi-game/pkg/store"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MatchmakeWait is how long a matchmaking request waits for an opponent before answering that the
+// player is still queued
+const MatchmakeWait = 25 * time.Second
+
+// queue is the matchmaking queue of this instance, kept in sync with the matchmaking topic
+var queue = matchmaking.NewQueue()
+
+// matchmakeMu makes sure that a pair of players is only started once within this instance
+var matchmakeMu sync.Mutex
+
+// matchmaker is set, with matchmakeMu held, while this instance is the one pairing the players (see
+// RunMatchmaker). The queue is shared by every instance through the matchmaking topic, so a single
+// instance pairs the players, lest two instances give the same players different sessions.
+var matchmaker bool
+
+// ratings are the ratings players are paired by, nil when they are not followed
+var ratings *rating.Store
+
+// SetRatings sets the ratings players are paired by. Without them, every player is paired as a new player.
+func SetRatings(store *rating.Store) {
+	ratings = store
+}
+
+// MatchmakeHandler serves the matchmaking endpoints:
+// POST /matchmake queues a player with their session preferences,
+// GET /matchmake/<ticket id> waits for the player to be paired,
+// DELETE /matchmake/<ticket id> leaves the queue.
+// POST and GET wait up to MatchmakeWait for an opponent: they answer with the session and seat of the
+// player once paired, and with 202 Accepted and the ticket while the player is still queued.
+func MatchmakeHandler(w http.ResponseWriter, r *http.Request, kafkaBroker string) {
+	ticketID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/matchmake"), "/")
+
+	switch {
+	case ticketID == "" && r.Method == http.MethodPost:
+		ticket, ok := enqueue(w, r, kafkaBroker)
+		if ok {
+			waitForMatch(w, r, ticket.ID)
+		}
+	case ticketID != "" && r.Method == http.MethodGet:
+		if ticket, ok := queue.Get(ticketID); ok && !ownsTicket(w, r, ticket) {
+			return
+		}
+		waitForMatch(w, r, ticketID)
+	case ticketID != "" && r.Method == http.MethodDelete:
+		ticket, ok := queue.Get(ticketID)
+		if !ok {
+			http.Error(w, "Ticket not found", http.StatusNotFound)
+			return
+		}
+		if !ownsTicket(w, r, ticket) {
+			return
+		}
+		if ticket.Status == matchmaking.StatusMatched {
+			http.Error(w, "Player has already been paired", http.StatusConflict)
+			return
+		}
+		if err := kafka.DeleteTicket(kafkaBroker, ticketID); err != nil {
+			log.Printf(Red+"[ERROR] Failed to delete matchmaking ticket | TicketID: %s | Error: %v"+Reset, ticketID, err)
+			http.Error(w, "Error leaving the queue", http.StatusInternalServerError)
+			return
+		}
+		queue.Remove(ticketID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// ownsTicket checks that the request comes from the player of a ticket: the API key of its account, for
+// a player with an account, and the ticket ID alone for an anonymous player
+func ownsTicket(w http.ResponseWriter, r *http.Request, ticket matchmaking.Ticket) bool {
+	if ticket.AccountID == "" {
+		return true
+	}
+	account, err := accounts.Authenticate(r.Header.Get("X-API-Key"))
+	if err != nil || account.ID != ticket.AccountID {
+		http.Error(w, "The ticket belongs to another account.", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// enqueue validates the preferences of a player and puts them in the queue. A player with an account
+// who is already queued gets their ticket back.
+func enqueue(w http.ResponseWriter, r *http.Request, kafkaBroker string) (matchmaking.Ticket, bool) {
+	var opts models.SessionOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return matchmaking.Ticket{}, false
+	}
+	if opts.Opponent != "" || opts.Players > models.MinPlayers {
+		http.Error(w, "Matchmaking pairs two players; bot opponents and larger sessions are not available.", http.StatusBadRequest)
+		return matchmaking.Ticket{}, false
+	}
+	if opts.Private || opts.InviteCode != "" || len(opts.AllowedAccounts) > 0 {
+		http.Error(w, "Matched sessions cannot be private.", http.StatusBadRequest)
+		return matchmaking.Ticket{}, false
+	}
+	session, _, err := engine.New("", opts, "", time.Now())
+	if err == nil {
+		err = checkSpectators(opts)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid session options: %v", err), http.StatusBadRequest)
+		return matchmaking.Ticket{}, false
+	}
+	opts.Variant = session.Variant
+
+	accountID, playerRating := "", 0.0
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+		account, err := accounts.Authenticate(apiKey)
+		if err != nil {
+			http.Error(w, "Invalid API key.", http.StatusUnauthorized)
+			return matchmaking.Ticket{}, false
+		}
+		accountID = account.ID
+		if ticket, ok := queue.Waiting(accountID); ok {
+			return ticket, true
+		}
+	}
+	if ratings != nil {
+		playerRating = ratings.System().Initial(accountID).Rating
+		if current, ok := ratings.Get(accountID); ok {
+			playerRating = current.Rating
+		}
+	}
+
+	ticket := matchmaking.NewTicket(accountID, playerRating, opts, time.Now())
+	if err := kafka.SaveTicket(kafkaBroker, ticket); err != nil {
+		log.Printf(Red+"[ERROR] Failed to save matchmaking ticket | Error: %v"+Reset, err)
+		http.Error(w, "Error joining the queue", http.StatusInternalServerError)
+		return matchmaking.Ticket{}, false
+	}
+	queue.Put(ticket)
+	log.Printf(Green+"[INFO] Player queued for matchmaking | TicketID: %s | AccountID: %s | Rating: %.0f | Variant: %s"+Reset, ticket.ID, accountID, playerRating, opts.Variant)
+
+	// Pair the player right away if an opponent is already waiting and this instance is the matchmaker
+	Matchmake(kafkaBroker, time.Now())
+	return ticket, true
+}
+
+// waitForMatch answers with the seat of a player once they are paired, along with the player token of
+// the seat, or with their ticket after MatchmakeWait
+func waitForMatch(w http.ResponseWriter, r *http.Request, ticketID string) {
+	ctx, cancel := context.WithTimeout(r.Context(), MatchmakeWait)
+	defer cancel()
+	ticket, ok := queue.Wait(ctx, ticketID)
+	if !ok {
+		http.Error(w, "Ticket not found", http.StatusNotFound)
+		return
+	}
+
+	if ticket.Status != matchmaking.StatusMatched {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ticket_id": ticket.ID, "status": ticket.Status})
+		return
+	}
+	response := map[string]interface{}{
+		"ticket_id":  ticket.ID,
+		"status":     ticket.Status,
+		"session_id": ticket.SessionID,
+		"player_id":  ticket.PlayerID,
+	}
+	token, err := issueToken(ticket.SessionID, ticket.PlayerID, ticket.AccountID, time.Now())
+	if err != nil {
+		log.Printf(Red+"[ERROR] Failed to issue player token | TicketID: %s | Error: %v"+Reset, ticket.ID, err)
+		http.Error(w, "Error issuing the player token", http.StatusInternalServerError)
+		return
+	}
+	if token != "" {
+		response["token"] = token
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RunMatchmaker makes this instance the one pairing the players until ctx is cancelled: it loads the
+// tickets the previous matchmaker may have written, then pairs the waiting players every second, as
+// their rating band widens. It returns once no pairing is under way anymore.
+func RunMatchmaker(ctx context.Context, kafkaBroker string) {
+	if err := kafka.LoadTickets(ctx, kafkaBroker, queue); err != nil {
+		log.Printf(Red+"[ERROR] Failed to load the matchmaking queue | Error: %v"+Reset, err)
+		return
+	}
+	matchmakeMu.Lock()
+	matchmaker = true
+	matchmakeMu.Unlock()
+	log.Println(Green + "[INFO] This instance is pairing the matchmaking players" + Reset)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			Matchmake(kafkaBroker, now)
+		case <-ctx.Done():
+			matchmakeMu.Lock()
+			matchmaker = false
+			matchmakeMu.Unlock()
+			log.Println(Yellow + "[INFO] This instance has stopped pairing the matchmaking players" + Reset)
+			return
+		}
+	}
+}
+
+// Matchmake pairs the waiting players who can play together and starts their sessions, then drops
+// the expired tickets. Only the instance running the matchmaker does.
+func Matchmake(kafkaBroker string, now time.Time) {
+	matchmakeMu.Lock()
+	defer matchmakeMu.Unlock()
+	if !matchmaker {
+		return
+	}
+
+	for _, pair := range queue.Pairs(now) {
+		if err := startMatchedSession(kafkaBroker, pair, now); err != nil {
+			log.Printf(Red+"[ERROR] Failed to start matched session | Tickets: %s, %s | Error: %v"+Reset, pair[0].ID, pair[1].ID, err)
+		}
+	}
+	for _, ticket := range queue.Expired(now) {
+		if err := kafka.DeleteTicket(kafkaBroker, ticket.ID); err != nil {
+			log.Printf(Red+"[ERROR] Failed to delete expired matchmaking ticket | TicketID: %s | Error: %v"+Reset, ticket.ID, err)
+			continue
+		}
+		queue.Remove(ticket.ID)
+	}
+}
+
+// startMatchedSession creates the session of two paired players: the first ticket creates it as Player 1,
+// the second one joins as Player 2. The tickets then carry the seat of each player, and are saved
+// together once both seats are taken: a pair that cannot be started leaves both players waiting.
+func startMatchedSession(kafkaBroker string, pair [2]matchmaking.Ticket, now time.Time) error {
+	sessionID, err := store.NewSessionID(context.Background(), sessions, "")
+	if err != nil {
+		return err
+	}
+
+	matchedAt := now.UTC()
+	for i := range pair {
+		ticket := &pair[i]
+		join := models.Envelope{
+			Type:        models.MessageJoin,
+			PlayerID:    strconv.Itoa(i + 1),
+			SessionID:   sessionID,
+			InitSession: i == 0,
+			AccountID:   ticket.AccountID,
+		}
+		if join.InitSession {
+			join.SessionOptions = ticket.Options
+		}
+		if join.Token, err = issueToken(sessionID, join.PlayerID, ticket.AccountID, now); err != nil {
+			return err
+		}
+		if err := kafka.PublishPlayerMessage(kafkaBroker, join, join); err != nil {
+			if i > 0 {
+				cancelMatchedSession(kafkaBroker, sessionID, pair[0], now)
+			}
+			return err
+		}
+		ticket.Status, ticket.SessionID, ticket.PlayerID, ticket.MatchedAt = matchmaking.StatusMatched, sessionID, join.PlayerID, &matchedAt
+	}
+
+	if err := kafka.SaveTickets(context.Background(), kafkaBroker, pair[0], pair[1]); err != nil {
+		return err
+	}
+	queue.Put(pair[0])
+	queue.Put(pair[1])
+	log.Printf(Green+"[INFO] Players paired | SessionID: %s | Tickets: %s, %s"+Reset, sessionID, pair[0].ID, pair[1].ID)
+	return nil
+}
+
+// issueToken returns the player token of a seat, empty when player tokens are disabled
+func issueToken(sessionID, playerID, accountID string, now time.Time) (string, error) {
+	if tokens == nil {
+		return "", nil
+	}
+	return tokens.Issue(auth.Claims{SessionID: sessionID, PlayerID: playerID, AccountID: accountID}, now)
+}
+
+// cancelMatchedSession calls off a session created for a pair that could not be started, as nobody
+// was told about it. The ticket is the one Player 1 was given the seat with.
+func cancelMatchedSession(kafkaBroker, sessionID string, ticket matchmaking.Ticket, now time.Time) {
+	cancel := models.Envelope{Type: models.MessageCancel, PlayerID: ticket.PlayerID, SessionID: sessionID, AccountID: ticket.AccountID}
+	token, err := issueToken(sessionID, ticket.PlayerID, ticket.AccountID, now)
+	if err != nil {
+		log.Printf(Red+"[ERROR] Failed to cancel matched session | SessionID: %s | Error: %v"+Reset, sessionID, err)
+		return
+	}
+	cancel.Token = token
+	if err := kafka.PublishPlayerMessage(kafkaBroker, cancel, cancel); err != nil {
+		log.Printf(Red+"[ERROR] Failed to cancel matched session | SessionID: %s | Error: %v"+Reset, sessionID, err)
+	}
+}
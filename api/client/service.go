@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"shifumi-game/pkg/kafka"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/rating"
+	"time"
+)
+
+// Start creates the topics of the client service, starts its background work, and registers its
+// handlers on mux. The session store, token keys and rating store are set beforehand, see
+// SetSessionStore, SetTokenKeys and SetRatings.
+func Start(kafkaBroker string, mux *http.ServeMux) error {
+	// Follow the bot registry so that sessions can pick external bots as opponents
+	go func() {
+		for {
+			err := kafka.WatchBotRegistry(context.Background(), kafkaBroker)
+			log.Printf("[WARN] Bot registry watcher exited: %v. Restarting...", err)
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
+	// Follow the player accounts so that players can sign in with their API key on any instance
+	if err := kafka.CreateCompactedTopic(kafkaBroker, kafka.AccountsTopic, 1); err != nil {
+		return fmt.Errorf("failed to create topic %s: %w", kafka.AccountsTopic, err)
+	}
+	go func() {
+		for {
+			err := kafka.WatchAccounts(context.Background(), kafkaBroker)
+			log.Printf("[WARN] Account registry watcher exited: %v. Restarting...", err)
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
+	// The ratings players are paired by follow the finished games
+	if err := kafka.CreateCompactedTopic(kafkaBroker, kafka.FinishedGamesTopic, 1); err != nil {
+		return fmt.Errorf("failed to create topic %s: %w", kafka.FinishedGamesTopic, err)
+	}
+	go func() {
+		for {
+			err := kafka.WatchFinishedGames(context.Background(), kafkaBroker, func(session *models.GameSession) {
+				if game, ok := rating.GameFromSession(session); ok {
+					ratings.Apply(game)
+				}
+			})
+			log.Printf("[WARN] Finished games watcher exited: %v. Restarting...", err)
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
+	// The matchmaking queue is rebuilt from its topic on startup, then the instance elected as the
+	// matchmaker pairs the waiting players every second, as their rating band widens
+	if err := kafka.CreateCompactedTopic(kafkaBroker, kafka.MatchmakingTopic, 1); err != nil {
+		return fmt.Errorf("failed to create topic %s: %w", kafka.MatchmakingTopic, err)
+	}
+	go func() {
+		for {
+			err := kafka.WatchTickets(context.Background(), kafkaBroker, queue)
+			log.Printf("[WARN] Matchmaking queue watcher exited: %v. Restarting...", err)
+			time.Sleep(2 * time.Second)
+		}
+	}()
+	go func() {
+		for {
+			err := kafka.LeadMatchmaking(context.Background(), kafkaBroker, func(ctx context.Context) {
+				RunMatchmaker(ctx, kafkaBroker)
+			})
+			log.Printf("[WARN] Matchmaker election exited: %v. Restarting...", err)
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
+	mux.HandleFunc("/play", func(w http.ResponseWriter, r *http.Request) {
+		MakeChoiceHandler(w, r, kafkaBroker)
+	})
+	mux.HandleFunc("/commit", func(w http.ResponseWriter, r *http.Request) {
+		CommitHandler(w, r, kafkaBroker)
+	})
+	mux.HandleFunc("/reveal", func(w http.ResponseWriter, r *http.Request) {
+		RevealHandler(w, r, kafkaBroker)
+	})
+	mux.HandleFunc("/join", func(w http.ResponseWriter, r *http.Request) {
+		JoinHandler(w, r, kafkaBroker)
+	})
+	mux.HandleFunc("/sessions", func(w http.ResponseWriter, r *http.Request) {
+		SessionsHandler(w, r, kafkaBroker)
+	})
+	mux.HandleFunc("/sessions/", func(w http.ResponseWriter, r *http.Request) {
+		SessionsHandler(w, r, kafkaBroker)
+	})
+	mux.HandleFunc("/accounts", func(w http.ResponseWriter, r *http.Request) {
+		AccountsHandler(w, r, kafkaBroker)
+	})
+	mux.HandleFunc("/accounts/", func(w http.ResponseWriter, r *http.Request) {
+		AccountsHandler(w, r, kafkaBroker)
+	})
+	mux.HandleFunc("/matchmake", func(w http.ResponseWriter, r *http.Request) {
+		MatchmakeHandler(w, r, kafkaBroker)
+	})
+	mux.HandleFunc("/matchmake/", func(w http.ResponseWriter, r *http.Request) {
+		MatchmakeHandler(w, r, kafkaBroker)
+	})
+	for _, command := range []string{models.MessagePause, models.MessageResume, models.MessageCancel} {
+		command := command
+		mux.HandleFunc("/"+command, func(w http.ResponseWriter, r *http.Request) {
+			ControlHandler(w, r, kafkaBroker, command)
+		})
+	}
+	return nil
+}
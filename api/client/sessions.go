@@ -0,0 +1,256 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"shifumi-game/pkg/engine"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/render"
+	"shifumi-game/pkg/store"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// moveRequest is the body of POST /sessions/{id}/moves. The type is choice by default; commit-reveal
+// sessions take a commit, then a reveal.
+type moveRequest struct {
+	models.Envelope
+	Choice     string `json:"choice,omitempty"`
+	Commitment string `json:"commitment,omitempty"`
+	Salt       string `json:"salt,omitempty"`
+}
+
+// SessionsHandler serves the session resources, so that creating, joining and moving are separate steps:
+// POST /sessions creates a session with the options of the body and seats its creator as Player 1,
+// POST /sessions/{id}/join takes the next free seat,
+// POST /sessions/{id}/moves submits a choice, commit or reveal for a seated player,
+// POST /sessions/{id}/pause, /resume and /cancel control the session,
+// GET /sessions/{id} returns the session, GET /sessions/{id}/rounds/{n} one of its rounds and
+// GET /sessions/{id}/events its event log.
+func SessionsHandler(w http.ResponseWriter, r *http.Request, kafkaBroker string) {
+	log.Printf(Green+"[INFO] Received request to SessionsHandler | Method: %s | Path: %s"+Reset, r.Method, r.URL.Path)
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/sessions"), "/")
+	var parts []string
+	if path != "" {
+		parts = strings.Split(path, "/")
+	}
+
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		createSession(w, r, kafkaBroker)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		getSession(w, r, parts[0], 0)
+	case len(parts) == 3 && parts[1] == "rounds" && r.Method == http.MethodGet:
+		round, err := strconv.Atoi(parts[2])
+		if err != nil || round < 1 {
+			http.Error(w, "Invalid round number", http.StatusBadRequest)
+			return
+		}
+		getSession(w, r, parts[0], round)
+	case len(parts) == 2 && parts[1] == "events" && r.Method == http.MethodGet:
+		getHistory(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "join" && r.Method == http.MethodPost:
+		joinSession(w, r, kafkaBroker, parts[0])
+	case len(parts) == 2 && parts[1] == "moves" && r.Method == http.MethodPost:
+		submitMove(w, r, kafkaBroker, parts[0])
+	case len(parts) == 2 && (parts[1] == models.MessagePause || parts[1] == models.MessageResume || parts[1] == models.MessageCancel) && r.Method == http.MethodPost:
+		controlSession(w, r, kafkaBroker, parts[0], parts[1])
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// createSession creates a session without a first move
+func createSession(w http.ResponseWriter, r *http.Request, kafkaBroker string) {
+	var opts models.SessionOptions
+	if err := decodeBody(r, &opts); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	create := models.Envelope{Type: models.MessageJoin, SessionOptions: opts}
+	if _, ok := submit(w, r, kafkaBroker, &create, "", engine.Move{Type: models.MessageJoin}, &create); ok {
+		respond(w, http.StatusCreated, create, "Session created successfully")
+	}
+}
+
+// joinSession seats a player in the next free seat of a session
+func joinSession(w http.ResponseWriter, r *http.Request, kafkaBroker string, sessionID string) {
+	var join models.Envelope
+	if err := decodeBody(r, &join); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if join.PlayerID != "" {
+		http.Error(w, "Player ID is allocated when joining.", http.StatusBadRequest)
+		return
+	}
+	join.Type, join.SessionID = models.MessageJoin, sessionID
+
+	if _, ok := submit(w, r, kafkaBroker, &join, "", engine.Move{Type: models.MessageJoin}, &join); ok {
+		respond(w, http.StatusOK, join, "Joined successfully")
+	}
+}
+
+// submitMove submits the move of a seated player
+func submitMove(w http.ResponseWriter, r *http.Request, kafkaBroker string, sessionID string) {
+	var request moveRequest
+	if err := decodeBody(r, &request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if request.PlayerID == "" {
+		http.Error(w, "Player ID is required; join the session first.", http.StatusBadRequest)
+		return
+	}
+	wait, err := playWait(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	envelope := request.Envelope
+	envelope.SessionID = sessionID
+
+	switch envelope.Type {
+	case "", models.MessageChoice:
+		choice := models.PlayerChoice{Envelope: envelope, Choice: request.Choice}
+		choice.Type = models.MessageChoice
+		move := engine.Move{Type: models.MessageChoice, Choice: choice.Choice}
+		if gameSession, ok := submit(w, r, kafkaBroker, &choice.Envelope, models.ModeOpen, move, &choice); ok {
+			respondToMove(w, r, choice.Envelope, gameSession.CurrentRound, "Choice submitted successfully", wait)
+		}
+	case models.MessageCommit:
+		commit := models.PlayerCommit{Envelope: envelope, Commitment: request.Commitment}
+		move := engine.Move{Type: models.MessageCommit, Commitment: commit.Commitment}
+		if _, ok := submit(w, r, kafkaBroker, &commit.Envelope, models.ModeCommitReveal, move, &commit); ok {
+			respond(w, http.StatusOK, commit.Envelope, "Commitment submitted successfully")
+		}
+	case models.MessageReveal:
+		reveal := models.PlayerReveal{Envelope: envelope, Choice: request.Choice, Salt: request.Salt}
+		move := engine.Move{Type: models.MessageReveal, Choice: reveal.Choice, Salt: reveal.Salt}
+		if gameSession, ok := submit(w, r, kafkaBroker, &reveal.Envelope, models.ModeCommitReveal, move, &reveal); ok {
+			respondToMove(w, r, reveal.Envelope, gameSession.CurrentRound, "Reveal submitted successfully", wait)
+		}
+	default:
+		http.Error(w, fmt.Sprintf("Unknown move type %q, expected %s, %s or %s.", envelope.Type, models.MessageChoice, models.MessageCommit, models.MessageReveal), http.StatusBadRequest)
+	}
+}
+
+// controlSession pauses, resumes or cancels a session for a seated player
+func controlSession(w http.ResponseWriter, r *http.Request, kafkaBroker string, sessionID, command string) {
+	var control models.Envelope
+	if err := decodeBody(r, &control); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if control.PlayerID == "" {
+		http.Error(w, fmt.Sprintf("Player ID is required to %s a session.", command), http.StatusBadRequest)
+		return
+	}
+	control.Type, control.SessionID = command, sessionID
+
+	if _, ok := submit(w, r, kafkaBroker, &control, "", engine.Move{Type: command}, &control); ok {
+		respond(w, http.StatusOK, control, fmt.Sprintf("Session %s requested successfully", command))
+	}
+}
+
+// getSession writes the latest snapshot of a session, or one of its rounds when round is not 0, with the
+// round results rendered in the style and language of the query
+func getSession(w http.ResponseWriter, r *http.Request, sessionID string, round int) {
+	formatter, err := render.New(render.Style(r.URL.Query().Get("style")), r.URL.Query().Get("lang"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session, err := sessions.Get(r.Context(), sessionID)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf(Red+"[ERROR] Error fetching game session | SessionID: %s | Error: %v"+Reset, sessionID, err)
+		}
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if session.NoSpectators && !isSeated(r, session) {
+		http.Error(w, "Session does not allow spectators; a player token is needed.", http.StatusForbidden)
+		return
+	}
+
+	rendered := formatter.Session(session)
+	rendered.InviteHash = ""
+	w.Header().Set("Content-Type", "application/json")
+	if round == 0 {
+		json.NewEncoder(w).Encode(rendered)
+		return
+	}
+	if round > len(rendered.Results) {
+		http.Error(w, "Round not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(rendered.Results[round-1])
+}
+
+// getHistory writes the event log of a session, without the invite codes of its players
+func getHistory(w http.ResponseWriter, r *http.Request, sessionID string) {
+	session, err := sessions.Get(r.Context(), sessionID)
+	if err == nil && session.NoSpectators && !isSeated(r, session) {
+		http.Error(w, "Session does not allow spectators; a player token is needed.", http.StatusForbidden)
+		return
+	}
+	var records []engine.Record
+	if err == nil {
+		records, err = sessions.History(r.Context(), sessionID)
+	}
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf(Red+"[ERROR] Error fetching session history | SessionID: %s | Error: %v"+Reset, sessionID, err)
+		}
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	// The records may be shared with the store, so they are redacted on copies
+	for i := range records {
+		if records[i].Session != nil {
+			records[i].Session = records[i].Session.Clone()
+			records[i].Session.InviteHash = ""
+		}
+		if records[i].Move != nil {
+			move := *records[i].Move
+			move.InviteHash = ""
+			records[i].Move = &move
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
+
+// isSeated returns whether the request carries the token of a player seated in the session. Without
+// player tokens, nobody can prove their seat, so everyone is let in: sessions without spectators
+// cannot be created then (see checkSpectators).
+func isSeated(r *http.Request, session *models.GameSession) bool {
+	if tokens == nil {
+		return true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	for _, p := range session.Players {
+		if _, err := tokens.Verify(token, session.SessionID, p.ID, time.Now()); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeBody decodes the JSON body of a request, an empty body leaving v unchanged
+func decodeBody(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
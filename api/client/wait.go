@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/render"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPlayWait = 30 * time.Second // How long ?wait=true holds a move request
+	MaxPlayWait     = 60 * time.Second
+)
+
+// PlayerScore is the score of a player in the response of a move that waited for its round
+type PlayerScore struct {
+	PlayerID   string `json:"player_id"`
+	Wins       int    `json:"wins"`
+	Points     int    `json:"points"`
+	Eliminated bool   `json:"eliminated,omitempty"`
+}
+
+// playWait returns how long a move request asks to wait for the result of its round, 0 when it does
+// not wait. The wait is asked for with ?wait=true (DefaultPlayWait), ?wait=<duration> or ?wait=<seconds>,
+// or with a "Prefer: wait=<seconds>" header.
+func playWait(r *http.Request) (time.Duration, error) {
+	value := r.URL.Query().Get("wait")
+	if value == "" {
+		for _, preference := range strings.Split(r.Header.Get("Prefer"), ",") {
+			if seconds, ok := strings.CutPrefix(strings.TrimSpace(preference), "wait="); ok {
+				value = seconds
+			}
+		}
+	}
+
+	var wait time.Duration
+	switch value {
+	case "", "false", "0":
+		return 0, nil
+	case "true":
+		wait = DefaultPlayWait
+	default:
+		if seconds, err := strconv.Atoi(value); err == nil {
+			wait = time.Duration(seconds) * time.Second
+		} else if wait, err = time.ParseDuration(value); err != nil {
+			return 0, fmt.Errorf("invalid wait %q, expected true, a number of seconds or a duration", value)
+		}
+	}
+	if wait < 0 {
+		return 0, fmt.Errorf("wait cannot be negative")
+	}
+	if wait > MaxPlayWait {
+		wait = MaxPlayWait
+	}
+	return wait, nil
+}
+
+// respondToMove writes the response of a move, after the result of its round when the request asked to wait for it
+func respondToMove(w http.ResponseWriter, r *http.Request, envelope models.Envelope, round int, status string, wait time.Duration) {
+	if wait == 0 {
+		respond(w, http.StatusOK, envelope, status)
+		return
+	}
+	respondWithRound(w, r, envelope, round, status, wait)
+}
+
+// respondWithRound follows the session snapshots until the round of a move is resolved, or the wait is
+// over, then writes the response of the move with the round result and the score. It answers 202 Accepted
+// without them when the round is not resolved in time.
+func respondWithRound(w http.ResponseWriter, r *http.Request, envelope models.Envelope, round int, status string, wait time.Duration) {
+	formatter, err := render.New(render.Style(r.URL.Query().Get("style")), r.URL.Query().Get("lang"))
+	if err != nil {
+		formatter = render.Default()
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	var resolved *models.GameSession
+	err = sessions.Watch(ctx, envelope.SessionID, func(session *models.GameSession) bool {
+		if (round <= len(session.Results) && session.Results[round-1].ResolvedAt != nil) || session.IsOver() {
+			resolved = session
+			return true
+		}
+		return false
+	})
+	if resolved == nil {
+		log.Printf(Yellow+"[INFO] Round not resolved in time | SessionID: %s | Round: %d | Error: %v"+Reset, envelope.SessionID, round, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(seatResponse(envelope, status+"; the round has not been resolved yet"))
+		return
+	}
+
+	rendered := formatter.Session(resolved)
+	response := seatResponse(envelope, status)
+	if round <= len(rendered.Results) && rendered.Results[round-1].ResolvedAt != nil {
+		response["round"] = rendered.Results[round-1]
+	}
+	score := make([]PlayerScore, 0, len(rendered.Players))
+	for _, p := range rendered.Players {
+		score = append(score, PlayerScore{PlayerID: p.ID, Wins: p.Wins, Points: p.Points, Eliminated: p.Eliminated})
+	}
+	response["score"] = score
+	response["session_status"] = rendered.Status
+	if rendered.Winner != "" {
+		response["winner"] = rendered.Winner
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+	log.Printf(Green+"[INFO] Round result sent to client | SessionID: %s | Round: %d"+Reset, envelope.SessionID, round)
+}
@@ -0,0 +1,66 @@
+package leaderboard
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"shifumi-game/pkg/accounts"
+	"shifumi-game/pkg/leaderboard"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/rating"
+	"strconv"
+	"time"
+)
+
+const (
+	Reset = "\033[0m"
+	Green = "\033[32m"
+)
+
+// LeaderboardHandler serves GET /leaderboard?window=&sort=&offset=&limit=&min_games=, a page of the
+// ranked table of the players with an account
+func LeaderboardHandler(w http.ResponseWriter, r *http.Request, board *leaderboard.Board) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	query := leaderboard.Query{Window: params.Get("window"), SortBy: params.Get("sort")}
+	for name, value := range map[string]*int{"offset": &query.Offset, "limit": &query.Limit, "min_games": &query.MinGames} {
+		if params.Get(name) == "" {
+			continue
+		}
+		n, err := strconv.Atoi(params.Get(name))
+		if err != nil {
+			http.Error(w, "Invalid "+name, http.StatusBadRequest)
+			return
+		}
+		*value = n
+	}
+	if err := query.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page := board.Table(query, time.Now())
+	for i := range page.Entries {
+		if account, ok := accounts.Get(page.Entries[i].PlayerID); ok {
+			page.Entries[i].Name = account.Name
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// RecordGame adds a finished session to the leaderboard. Sessions added before, e.g. when the finished
+// games are replayed, are skipped.
+func RecordGame(board *leaderboard.Board, session *models.GameSession) {
+	game, ok := rating.GameFromSession(session)
+	if !ok {
+		return
+	}
+	if board.Add(game) {
+		log.Printf(Green+"[INFO] Game added to the leaderboard | SessionID: %s"+Reset, game.SessionID)
+	}
+}
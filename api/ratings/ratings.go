@@ -0,0 +1,60 @@
+package ratings
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/rating"
+	"strings"
+)
+
+const (
+	Reset = "\033[0m"
+	Red   = "\033[31m"
+	Green = "\033[32m"
+)
+
+// PlayerRating is the rating of a player with its history, oldest change first
+type PlayerRating struct {
+	rating.Rating
+	System  string          `json:"system"`
+	History []rating.Change `json:"history"`
+}
+
+// RatingsHandler serves the ratings: GET /ratings lists every rated player, highest rating first,
+// and GET /ratings/<account id> returns the rating of a player with its history
+func RatingsHandler(w http.ResponseWriter, r *http.Request, store *rating.Store) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	playerID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/ratings"), "/")
+	w.Header().Set("Content-Type", "application/json")
+	if playerID == "" {
+		json.NewEncoder(w).Encode(store.All())
+		return
+	}
+
+	current, ok := store.Get(playerID)
+	if !ok {
+		http.Error(w, "Player has no rated game", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(PlayerRating{Rating: current, System: store.System().Name(), History: store.History(playerID)})
+}
+
+// RateGame updates the ratings with a finished session. Sessions rated before, e.g. when the finished
+// games are replayed, are skipped.
+func RateGame(store *rating.Store, session *models.GameSession) {
+	game, ok := rating.GameFromSession(session)
+	if !ok {
+		return
+	}
+	if !store.Apply(game) {
+		log.Printf("[INFO] Game already rated, skipping | SessionID: %s", game.SessionID)
+		return
+	}
+	log.Printf(Green+"[INFO] Game rated | SessionID: %s | Players: %s | Winner: %s"+Reset, game.SessionID, strings.Join(game.Players, ", "), game.Winner)
+}
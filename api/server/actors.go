@@ -0,0 +1,110 @@
+package server
+
+import (
+	"log"
+	"shifumi-game/pkg/engine"
+	"shifumi-game/pkg/models"
+	"sync"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const (
+	ActorIdleTimeout   = 5 * time.Minute // Actors without moves for this long are stopped, and read from the store again when needed
+	ActorMailboxSize   = 32              // Moves queued per session before handing over more moves blocks
+	MaxConcurrentMoves = 64              // Moves applied at the same time, across sessions
+)
+
+// playerMove is a move waiting in the mailbox of a session actor, with the message it was read from
+type playerMove struct {
+	envelope models.Envelope
+	move     engine.Move
+	msg      kafkago.Message
+	commits  *offsetCommitter // Told once the move is stored or dropped
+}
+
+// sessionActor applies the moves of a session one at a time, in the order they were read from the
+// player-choices topic, and keeps the session in memory between them
+type sessionActor struct {
+	sessionID string
+	mailbox   chan playerMove
+	pending   int                 // Moves handed over and not received yet, guarded by the mutex of sessionActors
+	session   *models.GameSession // nil until it is read from the store, and when it has to be read again
+}
+
+// sessionActors runs an actor per active session, so that the moves of different sessions are applied
+// concurrently. An actor is started by the first move of its session and stopped after ActorIdleTimeout
+// without moves. Handing over a move blocks while the mailbox of its session is full, which holds up
+// the reading of the player-choices topic rather than queuing moves without bounds. The offsets of the
+// queued moves are not committed (see offsetCommitter), so that the moves lost with the process when
+// it stops are read again.
+type sessionActors struct {
+	mu     sync.Mutex
+	actors map[string]*sessionActor
+	slots  chan struct{} // Taken by the actors while they apply a move
+}
+
+var actors = &sessionActors{actors: map[string]*sessionActor{}, slots: make(chan struct{}, MaxConcurrentMoves)}
+
+// Send hands a move over to the actor of its session, starting the actor if needed
+func (a *sessionActors) Send(m playerMove, kafkaBroker string) {
+	a.mu.Lock()
+	actor, ok := a.actors[m.envelope.SessionID]
+	if !ok {
+		actor = &sessionActor{sessionID: m.envelope.SessionID, mailbox: make(chan playerMove, ActorMailboxSize)}
+		a.actors[m.envelope.SessionID] = actor
+		go a.run(actor, kafkaBroker)
+	}
+	actor.pending++
+	a.mu.Unlock()
+
+	actor.mailbox <- m
+}
+
+// run applies the moves of an actor as they arrive, until it has been idle for ActorIdleTimeout
+func (a *sessionActors) run(actor *sessionActor, kafkaBroker string) {
+	log.Printf(Green+"[INFO] Session actor started | SessionID: %s"+Reset, actor.sessionID)
+	idle := time.NewTimer(ActorIdleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case m := <-actor.mailbox:
+			a.mu.Lock()
+			actor.pending--
+			a.mu.Unlock()
+
+			// Once a move has failed, the moves read after it are read again by the next reader
+			if m.commits.failed() != nil {
+				continue
+			}
+
+			a.slots <- struct{}{}
+			var err error
+			actor.session, err = applyMove(actor.session, m.envelope, m.move, kafkaBroker)
+			<-a.slots
+			m.commits.done(m.msg, err)
+
+			if !idle.Stop() {
+				select {
+				case <-idle.C:
+				default:
+				}
+			}
+			idle.Reset(ActorIdleTimeout)
+		case <-idle.C:
+			// A move handed over in the meantime keeps the actor running
+			a.mu.Lock()
+			if actor.pending > 0 {
+				a.mu.Unlock()
+				idle.Reset(ActorIdleTimeout)
+				continue
+			}
+			delete(a.actors, actor.sessionID)
+			a.mu.Unlock()
+			log.Printf(Green+"[INFO] Session actor stopped after being idle | SessionID: %s"+Reset, actor.sessionID)
+			return
+		}
+	}
+}
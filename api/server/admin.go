@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"shifumi-game/pkg/bot"
+	"shifumi-game/pkg/engine"
+	"shifumi-game/pkg/kafka"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/rules"
+	"shifumi-game/pkg/store"
+	"strings"
+	"time"
+)
+
+// authorizeAdmin checks the bearer token of an admin request against the ADMIN_TOKEN environment
+// variable. Admin endpoints are disabled when ADMIN_TOKEN is not set.
+func authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminToken == "" {
+		http.Error(w, "Admin endpoints are disabled", http.StatusForbidden)
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// AdminBotsHandler manages the external bots:
+// GET lists them (without their credentials), POST registers or updates one,
+// DELETE /admin/bots/<name> unregisters one.
+func AdminBotsHandler(w http.ResponseWriter, r *http.Request, kafkaBroker string) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		regs := bot.Registered()
+		for i := range regs {
+			regs[i] = regs[i].Redacted()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(regs)
+
+	case http.MethodPost:
+		var reg bot.Registration
+		if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if err := reg.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := kafka.SaveBotRegistration(kafkaBroker, reg); err != nil {
+			log.Printf(Red+"[ERROR] Failed to save bot registration | Bot: %s | Error: %v"+Reset, reg.Name, err)
+			http.Error(w, "Error saving bot registration", http.StatusInternalServerError)
+			return
+		}
+		// Available right away on this instance, the others pick it up from the registry
+		bot.Register(reg)
+		log.Printf(Green+"[INFO] External bot registered | Bot: %s | URL: %s"+Reset, reg.Name, reg.URL)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(reg.Redacted())
+
+	case http.MethodDelete:
+		name := strings.TrimPrefix(r.URL.Path, "/admin/bots/")
+		if name == "" || name == r.URL.Path {
+			http.Error(w, "Bot name is required", http.StatusBadRequest)
+			return
+		}
+		if err := kafka.DeleteBotRegistration(kafkaBroker, name); err != nil {
+			log.Printf(Red+"[ERROR] Failed to delete bot registration | Bot: %s | Error: %v"+Reset, name, err)
+			http.Error(w, "Error deleting bot registration", http.StatusInternalServerError)
+			return
+		}
+		bot.Unregister(name)
+		log.Printf(Yellow+"[INFO] External bot unregistered | Bot: %s"+Reset, name)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// MatchRequest is the body of a bot-vs-bot match request
+type MatchRequest struct {
+	Bots []string `json:"bots"` // "bot:<name>" of Player 1 and Player 2
+	models.SessionOptions
+}
+
+// AdminMatchesHandler starts a session between two bots, built-in or external. The session then
+// plays itself through the regular GameSession flow and can be followed on /stats.
+func AdminMatchesHandler(w http.ResponseWriter, r *http.Request, kafkaBroker string) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if err := checkBotsCanPlay(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if len(req.Bots) != 2 {
+		http.Error(w, "A match needs exactly two bots", http.StatusBadRequest)
+		return
+	}
+	opts := req.SessionOptions
+	if opts.Variant == "" {
+		opts.Variant = rules.Default
+	}
+	opts.Opponent = req.Bots[1]
+	if err := engine.ValidateOptions(opts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !bot.IsBot(req.Bots[0]) {
+		http.Error(w, fmt.Sprintf("unknown bot %q, expected %s<strategy>", req.Bots[0], bot.Prefix), http.StatusBadRequest)
+		return
+	}
+	if _, err := bot.New(req.Bots[0], nil); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session, err := startMatch(kafkaBroker, req.Bots[0], opts)
+	if err != nil {
+		log.Printf(Red+"[ERROR] Failed to start bot match | Error: %v"+Reset, err)
+		http.Error(w, "Error starting match", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"session_id": session.SessionID,
+		"players":    session.Players,
+	})
+}
+
+// startMatch creates a session with a bot in each seat and has the bots play the first round
+func startMatch(kafkaBroker string, host string, opts models.SessionOptions) (*models.GameSession, error) {
+	sessionID, err := store.NewSessionID(context.Background(), sessions, "bot")
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session, events, err := engine.New(sessionID, opts, "", now)
+	if err != nil {
+		return nil, err
+	}
+	session.Players[0].Bot = host
+	if err := sessions.Append(context.Background(), session, []engine.Record{engine.CreationRecord(session, now)}); err != nil {
+		return nil, err
+	}
+	log.Printf(Green+"[INFO] Bot match started | SessionID: %s | %s vs %s | Variant: %s | Format: %s"+Reset,
+		sessionID, host, opts.Opponent, session.Variant, session.Format)
+	logEvents(sessionID, events)
+	deadlines.Schedule(session, kafkaBroker)
+	go playBots(session, kafkaBroker)
+	return session, nil
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"shifumi-game/pkg/auth"
+	"shifumi-game/pkg/bot"
+	"shifumi-game/pkg/kafka"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/rules"
+	"time"
+)
+
+// errCannotSignBots rejects the sessions with bots when the game-logic service only verifies tokens
+var errCannotSignBots = errors.New("bots cannot play: the game-logic service has no key to sign their moves (set AUTH_KEY)")
+
+// checkBotsCanPlay returns errCannotSignBots when player tokens are enabled but the bot moves cannot be
+// signed, as they would then be dropped like forged moves and the session would never go on
+func checkBotsCanPlay() error {
+	if tokens != nil && !tokens.CanSign() {
+		return errCannotSignBots
+	}
+	return nil
+}
+
+// playBots publishes the move of every bot seat of the session for the current round, as a regular
+// player choice, so that bot moves go through the same pipeline as human moves
+func playBots(session *models.GameSession, kafkaBroker string) {
+	if session.IsOver() {
+		return
+	}
+	for _, p := range session.ActivePlayers() {
+		if p.Bot == "" || p.HasPlayed {
+			continue
+		}
+
+		rs, err := rules.Get(session.Variant)
+		if err != nil {
+			log.Printf(Red+"[ERROR] Cannot load ruleset for bot | SessionID: %s | Error: %v"+Reset, session.SessionID, err)
+			return
+		}
+		strategy, err := bot.New(p.Bot, nil)
+		if err != nil {
+			log.Printf(Red+"[ERROR] Cannot load bot strategy | SessionID: %s | Bot: %s | Error: %v"+Reset, session.SessionID, p.Bot, err)
+			continue
+		}
+
+		choice := models.PlayerChoice{
+			Envelope: models.Envelope{Type: models.MessageChoice, PlayerID: p.ID, SessionID: session.SessionID},
+			Choice:   strategy.Next(botHistory(session, rs, p.ID)),
+		}
+		if tokens != nil {
+			if choice.Token, err = tokens.Issue(auth.Claims{SessionID: session.SessionID, PlayerID: p.ID}, time.Now()); err != nil {
+				log.Printf(Red+"[ERROR] Cannot sign bot choice | SessionID: %s | Error: %v"+Reset, session.SessionID, err)
+				continue
+			}
+		}
+		log.Printf(Yellow+"[INFO] %s (%s) plays %s | SessionID: %s | Round: %d"+Reset, models.PlayerName(p.ID), strategy.Name(), choice.Choice, session.SessionID, session.CurrentRound)
+		if err := kafka.PublishPlayerMessage(kafkaBroker, choice.Envelope, choice); err != nil {
+			log.Printf(Red+"[ERROR] Failed to publish bot choice | SessionID: %s | Error: %v"+Reset, session.SessionID, err)
+		}
+	}
+}
+
+// botHistory returns the moves of the bot and of its opponent in the previous rounds of the session.
+// Rounds where either side did not play (missed deadline) are left out.
+func botHistory(session *models.GameSession, rs rules.Ruleset, botID string) bot.History {
+	h := bot.History{SessionID: session.SessionID, Round: session.CurrentRound, Ruleset: rs}
+	for i := 0; i < session.CurrentRound-1 && i < len(session.Results); i++ {
+		round := &session.Results[i]
+		own := round.Choice(botID)
+		if own == nil {
+			continue
+		}
+		for _, opponent := range round.Choices {
+			if opponent.PlayerID != botID {
+				h.Own = append(h.Own, own.Choice)
+				h.Opponent = append(h.Opponent, opponent.Choice)
+				break
+			}
+		}
+	}
+	return h
+}
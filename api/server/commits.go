@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// offsetCommitter commits the offsets of the player-choices messages fetched by a reader once the
+// moves they hold are stored. The actors apply the moves of different sessions concurrently, so they
+// complete out of order: an offset is only committed once every message fetched before it is done,
+// so that the messages read again after a crash or a restart include every move that might not be
+// stored. A move that fails stops the commits and cancels the fetching, so that the reader is created
+// again from the last committed offset, after a backoff.
+type offsetCommitter struct {
+	reader *kafkago.Reader
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu         sync.Mutex
+	partitions map[int]*fetchedOffsets
+	err        error // First failure, after which nothing is committed anymore
+}
+
+// fetchedOffsets are the offsets of a partition fetched and not committed yet
+type fetchedOffsets struct {
+	fetched []int64 // In the order they were fetched
+	done    map[int64]bool
+}
+
+// newOffsetCommitter returns the committer of the messages fetched by a reader
+func newOffsetCommitter(reader *kafkago.Reader) *offsetCommitter {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &offsetCommitter{reader: reader, ctx: ctx, cancel: cancel, partitions: map[int]*fetchedOffsets{}}
+}
+
+// fetched records a message before its move is handed over
+func (c *offsetCommitter) fetched(msg kafkago.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.partitions[msg.Partition]
+	if !ok {
+		p = &fetchedOffsets{done: map[int64]bool{}}
+		c.partitions[msg.Partition] = p
+	}
+	p.fetched = append(p.fetched, msg.Offset)
+}
+
+// done records that the move of a message is stored, or dropped, and commits the offsets that every
+// message fetched before is done with. err is the failure of a move that has to be applied again.
+func (c *offsetCommitter) done(msg kafkago.Message, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	if err != nil {
+		c.fail(err)
+		return
+	}
+
+	p := c.partitions[msg.Partition]
+	p.done[msg.Offset] = true
+	last := int64(-1)
+	for len(p.fetched) > 0 && p.done[p.fetched[0]] {
+		last = p.fetched[0]
+		delete(p.done, last)
+		p.fetched = p.fetched[1:]
+	}
+	if last < 0 {
+		return
+	}
+	// Commits are made under the lock, so that they are made in order
+	if err := c.reader.CommitMessages(c.ctx, kafkago.Message{Topic: msg.Topic, Partition: msg.Partition, Offset: last}); err != nil {
+		c.fail(err)
+	}
+}
+
+// fail stops the commits and the fetching, with c.mu held
+func (c *offsetCommitter) fail(err error) {
+	c.err = err
+	c.cancel()
+}
+
+// failed returns the failure that stopped the commits, nil while the moves are being stored
+func (c *offsetCommitter) failed() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
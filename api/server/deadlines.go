@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"shifumi-game/pkg/kafka"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/store"
+	"sync"
+	"time"
+)
+
+// deadlineWatcher keeps one timer per session with a pending round deadline. When a timer fires,
+// it publishes a RoundTimeout to the player-choices topic so that the timeout is processed in order
+// with the player moves. The deadlines themselves live in the session snapshots, so the timers can
+// be rebuilt after a restart with RecoverDeadlines.
+type deadlineWatcher struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+var deadlines = &deadlineWatcher{timers: map[string]*time.Timer{}}
+
+// Schedule replaces the timer of a session with one firing at its current round deadline, if any
+func (d *deadlineWatcher) Schedule(session *models.GameSession, kafkaBroker string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if timer, ok := d.timers[session.SessionID]; ok {
+		timer.Stop()
+		delete(d.timers, session.SessionID)
+	}
+	if session.RoundDeadline == nil || session.IsOver() {
+		return
+	}
+
+	timeout := models.RoundTimeout{
+		Envelope: models.Envelope{Type: models.MessageTimeout, SessionID: session.SessionID},
+		Round:    session.CurrentRound,
+		Phase:    session.Phase,
+		Deadline: *session.RoundDeadline,
+	}
+	d.timers[session.SessionID] = time.AfterFunc(time.Until(timeout.Deadline), func() {
+		d.mu.Lock()
+		delete(d.timers, timeout.SessionID)
+		d.mu.Unlock()
+
+		log.Printf(Yellow+"[INFO] Round deadline passed | SessionID: %s | Round: %d"+Reset, timeout.SessionID, timeout.Round)
+		if err := kafka.PublishPlayerMessage(kafkaBroker, timeout.Envelope, timeout); err != nil {
+			log.Printf(Red+"[ERROR] Failed to publish round timeout | SessionID: %s | Error: %v"+Reset, timeout.SessionID, err)
+		}
+	})
+	log.Printf(Green+"[INFO] Round deadline scheduled | SessionID: %s | Round: %d | Deadline: %s"+Reset, session.SessionID, session.CurrentRound, timeout.Deadline)
+}
+
+// RecoverDeadlines reschedules the round deadlines of every session in progress from the latest
+// session snapshots. Deadlines that passed while the service was down fire immediately.
+func RecoverDeadlines(kafkaBroker string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	sessionIDs, err := sessions.List(ctx)
+	if err != nil {
+		log.Printf(Red+"[ERROR] Error listing sessions to recover deadlines: %v"+Reset, err)
+		return
+	}
+
+	recovered := 0
+	for _, sessionID := range sessionIDs {
+		session, err := sessions.Get(ctx, sessionID)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf(Red+"[ERROR] Error reading session %s to recover its deadline: %v"+Reset, sessionID, err)
+			continue
+		}
+		if session.RoundDeadline == nil || session.IsOver() {
+			continue
+		}
+		deadlines.Schedule(session, kafkaBroker)
+		recovered++
+	}
+	log.Printf(Green+"[INFO] Recovered %d round deadline(s) from %d session(s)"+Reset, recovered, len(sessionIDs))
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"shifumi-game/pkg/kafka"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/store"
+	"sync"
+	"time"
+)
+
+// finishedGames publishes the finished sessions to the finished-games topic, which feeds the rating
+// and leaderboard services. A session that fails to be published is kept pending and published again
+// in the background until it is; the ones still pending when the service stops are published by
+// RecoverFinishedGames on startup.
+var finishedGames = &finishedPublisher{pending: map[string]*models.GameSession{}}
+
+// finishedPublisher publishes the finished sessions, see finishedGames
+type finishedPublisher struct {
+	mu       sync.Mutex
+	pending  map[string]*models.GameSession // Sessions that failed to be published, by session ID
+	retrying bool                           // Whether a goroutine is publishing the pending sessions
+}
+
+// Publish publishes a finished session, and keeps it pending when that fails
+func (p *finishedPublisher) Publish(session *models.GameSession, kafkaBroker string) {
+	err := kafka.PublishFinishedGame(kafkaBroker, session)
+	if err == nil {
+		return
+	}
+	log.Printf(Red+"[ERROR] Error publishing finished game, retrying in the background | SessionID: %s | Error: %v"+Reset, session.SessionID, err)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending[session.SessionID] = session
+	if !p.retrying {
+		p.retrying = true
+		go p.retry(kafkaBroker)
+	}
+}
+
+// retry publishes the pending sessions with a backoff, until none is left
+func (p *finishedPublisher) retry(kafkaBroker string) {
+	backoff := 2 * time.Second
+	for {
+		time.Sleep(backoff)
+		p.mu.Lock()
+		pending := make([]*models.GameSession, 0, len(p.pending))
+		for _, session := range p.pending {
+			pending = append(pending, session)
+		}
+		p.mu.Unlock()
+
+		failed := false
+		for _, session := range pending {
+			if err := kafka.PublishFinishedGame(kafkaBroker, session); err != nil {
+				log.Printf(Red+"[ERROR] Error publishing finished game | SessionID: %s | Error: %v"+Reset, session.SessionID, err)
+				failed = true
+				continue
+			}
+			log.Printf(Green+"[INFO] Pending finished game published | SessionID: %s"+Reset, session.SessionID)
+			p.mu.Lock()
+			delete(p.pending, session.SessionID)
+			p.mu.Unlock()
+		}
+
+		p.mu.Lock()
+		if len(p.pending) == 0 {
+			p.retrying = false
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Unlock()
+		if failed && backoff < time.Minute {
+			backoff *= 2 // Exponential backoff, with a cap at 1 minute
+		}
+	}
+}
+
+// RecoverFinishedGames publishes the finished sessions of the session store that are missing from
+// the finished-games topic, e.g. when the service stopped before it could publish one
+func RecoverFinishedGames(kafkaBroker string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	published, err := kafka.FinishedGameIDs(ctx, kafkaBroker)
+	if err != nil {
+		log.Printf(Red+"[ERROR] Error reading the finished games to recover: %v"+Reset, err)
+		return
+	}
+	sessionIDs, err := sessions.List(ctx)
+	if err != nil {
+		log.Printf(Red+"[ERROR] Error listing sessions to recover finished games: %v"+Reset, err)
+		return
+	}
+
+	recovered := 0
+	for _, sessionID := range sessionIDs {
+		if published[sessionID] {
+			continue
+		}
+		session, err := sessions.Get(ctx, sessionID)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf(Red+"[ERROR] Error reading session %s to recover its finished game: %v"+Reset, sessionID, err)
+			continue
+		}
+		if session.CurrentStatus() != models.StatusFinished {
+			continue
+		}
+		finishedGames.Publish(session, kafkaBroker)
+		recovered++
+	}
+	log.Printf(Green+"[INFO] Recovered %d finished game(s) from %d session(s)"+Reset, recovered, len(sessionIDs))
+}
@@ -3,21 +3,23 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"regexp"
+	"shifumi-game/pkg/auth"
+	"shifumi-game/pkg/engine"
 	"shifumi-game/pkg/kafka"
 	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/render"
+	"shifumi-game/pkg/store"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
 	kafkago "github.com/segmentio/kafka-go"
-	"github.com/segmentio/kafka-go/topics"
 )
 
 const (
@@ -28,9 +30,31 @@ const (
 	Orange = "\033[33m"
 )
 
-var mu sync.Mutex
+// MaxUpdateAttempts is how many times a move is applied to the latest version of its session when
+// other updates of the session keep being stored first
+const MaxUpdateAttempts = 5
 
-// ProcessChoices listens to the player-choices topic and processes incoming player choices
+// tokens verifies the player tokens of the player messages and signs the moves of the bots, nil when
+// player tokens are disabled
+var tokens *auth.Keys
+
+// sessions holds the game sessions
+var sessions store.SessionStore
+
+// SetSessionStore sets the store the game sessions are read from and written to
+func SetSessionStore(s store.SessionStore) {
+	sessions = s
+}
+
+// SetTokenKeys enables player tokens: player messages without a valid token for their session and
+// player are dropped, so that forged messages written straight to Kafka are rejected too
+func SetTokenKeys(keys *auth.Keys) {
+	tokens = keys
+}
+
+// ProcessChoices listens to the player-choices topic and processes incoming player choices. The offset
+// of a message is committed once its move is stored, and a move that cannot be stored is read again,
+// with the messages that follow it, after a backoff.
 func ProcessChoices(kafkaBroker string) {
 	topic := "player-choices"
 	backoff := 2 * time.Second // Initial backoff duration
@@ -46,18 +70,26 @@ func ProcessChoices(kafkaBroker string) {
 			MaxBytes: 10e6, // 10MB
 		})
 
+		commits := newOffsetCommitter(reader)
+
 		for {
-			err := kafka.ReadMessages(reader, func(key, value []byte) error {
+			err := kafka.FetchMessages(commits.ctx, reader, func(msg kafkago.Message) error {
 				log.Printf(Green+"[INFO] Processing message from topic: %s"+Reset, topic)
+				commits.fetched(msg)
 
 				// Skip messages where the key or value starts with "test"
-				if strings.HasPrefix(string(key), "test") || strings.HasPrefix(string(value), "test") {
-					log.Printf(Green+"[INFO] Skipping test message | Key: %s | Value: %s"+Reset, string(key), string(value))
+				if strings.HasPrefix(string(msg.Key), "test") || strings.HasPrefix(string(msg.Value), "test") {
+					log.Printf(Green+"[INFO] Skipping test message | Key: %s | Value: %s"+Reset, string(msg.Key), string(msg.Value))
+					commits.done(msg, nil)
 					return nil
 				}
 
-				return handlePlayerChoice(value, kafkaBroker)
+				return handlePlayerChoice(msg, commits, kafkaBroker)
 			})
+			// A move that could not be stored stops the reading
+			if failed := commits.failed(); failed != nil {
+				err = failed
+			}
 			if err != nil {
 				log.Printf(Red+"[ERROR] Error reading messages from topic %s: %v. Retrying in %s"+Reset, topic, err, backoff)
 				time.Sleep(backoff)
@@ -71,141 +103,250 @@ func ProcessChoices(kafkaBroker string) {
 		}
 
 		log.Printf(Red+"[ERROR] Reconnecting Kafka reader for topic %s due to persistent errors"+Reset, topic)
+		commits.cancel()
 		reader.Close()
 		time.Sleep(backoff)
 	}
 }
 
-// handlePlayerChoice processes each player choice, updating the game session and determining the round winner
-func handlePlayerChoice(value []byte, kafkaBroker string) error {
-	mu.Lock()         // Lock the mutex
-	defer mu.Unlock() // Ensure the mutex is unlocked when function exits
-	var choice models.PlayerChoice
-	if err := json.Unmarshal(value, &choice); err != nil {
-		log.Printf(Red+"[ERROR] Error unmarshalling player choice | Error: %v"+Reset, err)
+// handlePlayerChoice processes each message of the player-choices topic (choice, commit, reveal or
+// timeout): it decodes the move and hands it to the actor of its session, which applies it and tells
+// commits once it is stored. Messages that are dropped are done with right away.
+func handlePlayerChoice(msg kafkago.Message, commits *offsetCommitter, kafkaBroker string) error {
+	value := msg.Value
+	var envelope models.Envelope
+	if err := json.Unmarshal(value, &envelope); err != nil {
+		log.Printf(Red+"[ERROR] Error unmarshalling player message | Error: %v"+Reset, err)
+		commits.done(msg, nil)
 		return err
 	}
-	log.Printf(Green+"[INFO] Successfully unmarshalled player choice | SessionID: %s | PlayerID: %s | Choice: %s"+Reset, choice.SessionID, choice.PlayerID, choice.Choice)
-
-	var gameSession *models.GameSession
-	var err error
-	topicName := "game-results-" + choice.SessionID
-
-	if choice.InitSession {
-		gameSession = models.NewGameSession(choice.SessionID)
-		log.Printf(Green+"[INFO] New game session created | SessionID: %s"+Reset, choice.SessionID)
-	} else {
-		gameSession, err = kafka.ReadGameSession(topicName, choice.SessionID, kafkaBroker, "server")
+	if envelope.Type == "" {
+		envelope.Type = models.MessageChoice
+	}
+	log.Printf(Green+"[INFO] Successfully unmarshalled player message | Type: %s | SessionID: %s | PlayerID: %s"+Reset, envelope.Type, envelope.SessionID, envelope.PlayerID)
+
+	// Round timeouts come from the game-logic service itself, and only apply once the deadline has passed.
+	// The account of a player is the one their token was issued for.
+	if tokens != nil && envelope.Type != models.MessageTimeout {
+		claims, err := tokens.Verify(envelope.Token, envelope.SessionID, envelope.PlayerID, time.Now())
+		if err == nil && claims.AccountID != envelope.AccountID {
+			err = auth.ErrWrongPlayer
+		}
 		if err != nil {
-			log.Printf(Red+"[ERROR] Error retrieving game session: %v"+Reset, err)
-			return err
+			log.Printf(Red+"[ERROR] Player token rejected, dropping message | SessionID: %s | PlayerID: %s | Error: %v"+Reset, envelope.SessionID, envelope.PlayerID, err)
+			commits.done(msg, nil)
+			return nil
 		}
 	}
 
-	// Record the player's choice
+	move, err := decodeMove(envelope, value, msg.Partition, msg.Offset, time.Now())
+	if err != nil {
+		log.Printf(Red+"[ERROR] Error unmarshalling player %s | Error: %v"+Reset, envelope.Type, err)
+		commits.done(msg, nil)
+		return err
+	}
 
+	actors.Send(playerMove{envelope: envelope, move: move, msg: msg, commits: commits}, kafkaBroker)
+	return nil
+}
+
+// applyMove applies a move to the session an actor holds, current being nil when the session has to be
+// read from the store, and returns the session as stored, nil when it has to be read again. Several
+// instances can process messages at once: an update stored from a version that is no longer the
+// latest one is made again from the latest one. An error means that the move is not stored and has to
+// be read again; moves that are rejected, or cannot be applied at all, are dropped.
+func applyMove(current *models.GameSession, envelope models.Envelope, move engine.Move, kafkaBroker string) (*models.GameSession, error) {
+	var gameSession *models.GameSession
+	var events []engine.Event
+	var err error
+	for attempt := 1; ; attempt++ {
+		gameSession, events, err = updateSession(current, envelope, move)
+		if !errors.Is(err, store.ErrConflict) || envelope.InitSession || attempt == MaxUpdateAttempts {
+			break
+		}
+		log.Printf(Yellow+"[INFO] Session updated concurrently, applying the move again | SessionID: %s | Attempt: %d"+Reset, envelope.SessionID, attempt)
+		current = nil
+	}
+	if errors.Is(err, store.ErrConflict) && envelope.InitSession {
+		// A session is only created once
+		log.Printf(Orange+"[ERROR] Session already exists, dropping message | SessionID: %s | Error: %v"+Reset, envelope.SessionID, err)
+		return nil, nil
+	}
+	if err != nil {
+		// The error is logged, and the session is read again for the next move
+		log.Printf(Orange+"[ERROR] Error updating session | SessionID: %s | Error: %v"+Reset, envelope.SessionID, err)
+		return nil, err
+	}
 	if gameSession == nil {
-		log.Printf(Red+"[ERROR] Invalid game session state | SessionID: %s"+Reset, choice.SessionID)
-		return fmt.Errorf("invalid game session state for sessionID: %s", choice.SessionID)
+		return current, nil
 	}
+	deadlines.Schedule(gameSession, kafkaBroker)
 
-	currentRound := &gameSession.Results[gameSession.CurrentRound-1]
-	if choice.PlayerID == "1" {
-		currentRound.Player1 = &choice
-		gameSession.SetPlayer1HasPlayed(true)
-		log.Printf(Yellow+"[INFO] Player 1 has played | SessionID: %s"+Reset, choice.SessionID)
+	// Finished sessions feed the rating service
+	for _, event := range events {
+		if event.Type == engine.EventSessionFinished {
+			finishedGames.Publish(gameSession, kafkaBroker)
+			break
+		}
+	}
 
-	} else if choice.PlayerID == "2" {
-		currentRound.Player2 = &choice
-		gameSession.SetPlayer2HasPlayed(true)
-		log.Printf(Yellow+"[INFO] Player 2 has played | SessionID: %s"+Reset, choice.SessionID)
+	// Bots throw as soon as a round starts, and again on resume in case their move was rejected
+	// during a pause. External bots answer over HTTP, so they play in the background rather than
+	// holding up the other sessions.
+	for _, event := range events {
+		if event.Type == engine.EventRoundStarted || event.Type == engine.EventSessionResumed {
+			go playBots(gameSession, kafkaBroker)
+			break
+		}
 	}
 
-	// Before determining the winner, log the current state
-	log.Printf(Green+"[INFO] Before determining winner | Round: %d | Player 1 Played: %t | Player 2 Played: %t"+Reset,
-		gameSession.CurrentRound, gameSession.HasPlayer1Played(), gameSession.HasPlayer2Played())
+	return gameSession, nil
+}
 
-	// If both players have played, determine the winner
-	if gameSession.HasPlayer1Played() && gameSession.HasPlayer2Played() {
-		log.Printf(Green+"[INFO] Both players have played | SessionID: %s | Round: %d"+Reset, gameSession.SessionID, gameSession.CurrentRound)
-		determineWinner(gameSession)
+// updateSession applies a move to a session, read from the store when current is nil, or to a new
+// session, and stores the update. It returns a nil session when the move is dropped, ErrConflict from
+// the store when the session was updated in the meantime, and the other errors of the store.
+func updateSession(current *models.GameSession, envelope models.Envelope, move engine.Move) (*models.GameSession, []engine.Event, error) {
+	var gameSession *models.GameSession
+	var events []engine.Event
+	var records []engine.Record
+	var err error
 
-		// Log before incrementing the round
-		log.Printf(Green+"[INFO] Incrementing round | SessionID: %s | Current Round: %d"+Reset, gameSession.SessionID, gameSession.CurrentRound)
+	if envelope.InitSession {
+		gameSession, events, err = engine.New(envelope.SessionID, envelope.SessionOptions, envelope.AccountID, move.At)
+		if err == nil && envelope.Opponent != "" {
+			err = checkBotsCanPlay()
+		}
+		if err != nil {
+			log.Printf(Red+"[ERROR] Invalid session options, dropping message | SessionID: %s | Error: %v"+Reset, envelope.SessionID, err)
+			return nil, nil, nil
+		}
+		records = append(records, engine.CreationRecord(gameSession, move.At))
+		log.Printf(Green+"[INFO] New game session created | SessionID: %s | Variant: %s | Format: %s | Players: %d | Scoring: %s | Mode: %s"+Reset,
+			envelope.SessionID, gameSession.Variant, gameSession.Format, gameSession.NumPlayers, gameSession.Scoring, gameSession.Mode)
+	} else if current != nil {
+		gameSession = current
+	} else {
+		gameSession, err = sessions.Get(context.Background(), envelope.SessionID)
+		if errors.Is(err, store.ErrNotFound) {
+			log.Printf(Red+"[ERROR] Invalid game session state, dropping message | SessionID: %s"+Reset, envelope.SessionID)
+			return nil, nil, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error retrieving game session: %w", err)
+		}
+	}
 
-		// Prepare for the next round
-		gameSession.CurrentRound++
-		gameSession.Results = append(gameSession.Results, models.RoundResult{
-			RoundNumber: gameSession.CurrentRound,
-		})
-		gameSession.SetPlayer1HasPlayed(false)
-		gameSession.SetPlayer2HasPlayed(false)
+	// Messages read again after a restart may already be applied
+	if move.Offset != nil && gameSession.Applied(move.Partition, *move.Offset) {
+		log.Printf(Yellow+"[INFO] Player message already applied, skipping | SessionID: %s | Partition: %d | Offset: %d"+Reset, envelope.SessionID, move.Partition, *move.Offset)
+		return nil, nil, nil
 	}
 
-	// Publish the updated game session to Kafka
-	if err := kafka.UpdateSession(topicName, gameSession, kafkaBroker); err != nil {
-		log.Printf(Orange+"[ERROR] Error updating session | SessionID: %s | Error: %v"+Reset, gameSession.SessionID, err)
+	// Record the player's move, or apply the missed deadline. Player 1 already has a seat in a
+	// session created with a join.
+	updated, applied, err := gameSession, []engine.Event(nil), error(nil)
+	if !envelope.InitSession || move.Type != models.MessageJoin {
+		updated, applied, err = engine.Apply(gameSession, move)
+		if err == nil {
+			records = append(records, engine.MoveRecords(updated, move, applied)...)
+		}
+	}
+	if errors.Is(err, engine.ErrRejected) {
+		log.Printf(Red+"[ERROR] %v | SessionID: %s | Type: %s | PlayerID: %s"+Reset, err, envelope.SessionID, envelope.Type, envelope.PlayerID)
+		if !envelope.InitSession {
+			return nil, nil, nil
+		}
+		// The session is still created when the first move of Player 1 is rejected
+	} else if err != nil {
+		// The move cannot be applied whatever the attempt, e.g. the variant of the session is not loaded
+		log.Printf(Red+"[ERROR] Error applying player %s, dropping message | SessionID: %s | Error: %v"+Reset, envelope.Type, envelope.SessionID, err)
+		return nil, nil, nil
 	}
+	gameSession = updated
+	events = append(events, applied...)
 
-	return nil
+	// Store the move, with its outcome, in the event log of the session
+	if err := sessions.Append(context.Background(), gameSession, records); err != nil {
+		return nil, nil, err
+	}
+	logEvents(gameSession.SessionID, events)
+	return gameSession, events, nil
 }
 
-// determineWinner determines the winner of the current round and updates the game session accordingly
-func determineWinner(session *models.GameSession) {
-	currentRound := &session.Results[session.CurrentRound-1]
-	var result string
-
-	switch currentRound.Player1.Choice {
-	case "rock":
-		switch currentRound.Player2.Choice {
-		case "scissors":
-			session.Player1Wins++
-			result = "Player 1 wins 🪨X→ 🥇"
-		case "paper":
-			session.Player2Wins++
-			result = "Player 2 wins 🪨📄 → 🥇"
-		case "rock":
-			session.Draws++
-			result = "Draw 🪨🪨 → 🤝"
+// decodeMove decodes the message of a player, or a round timeout, read at an offset of a partition of
+// the player-choices topic, into an engine move
+func decodeMove(envelope models.Envelope, value []byte, partition int, offset int64, at time.Time) (engine.Move, error) {
+	move := engine.Move{Type: envelope.Type, PlayerID: envelope.PlayerID, AccountID: envelope.AccountID, InviteHash: envelope.InviteHash, At: at, Offset: &offset, Partition: partition}
+	switch envelope.Type {
+	case models.MessageCommit:
+		var commit models.PlayerCommit
+		if err := json.Unmarshal(value, &commit); err != nil {
+			return move, err
 		}
-	case "paper":
-		switch currentRound.Player2.Choice {
-		case "rock":
-			session.Player1Wins++
-			result = "Player 1 wins 📄🪨 → 🥇"
-		case "scissors":
-			session.Player2Wins++
-			result = "Player 2 wins 📄X→ 🥇"
-		case "paper":
-			session.Draws++
-			result = "Draw 📄📄 → 🤝"
+		move.Commitment = commit.Commitment
+	case models.MessageReveal:
+		var reveal models.PlayerReveal
+		if err := json.Unmarshal(value, &reveal); err != nil {
+			return move, err
 		}
-	case "scissors":
-		switch currentRound.Player2.Choice {
-		case "paper":
-			session.Player1Wins++
-			result = "Player 1 wins X📄 → 🥇"
-		case "rock":
-			session.Player2Wins++
-			result = "Player 2 wins X🪨 → 🥇"
-		case "scissors":
-			session.Draws++
-			result = "Draw XX→ 🤝"
+		move.Choice, move.Salt = reveal.Choice, reveal.Salt
+	case models.MessageTimeout:
+		var timeout models.RoundTimeout
+		if err := json.Unmarshal(value, &timeout); err != nil {
+			return move, err
 		}
+		move.Round, move.Phase, move.Deadline = timeout.Round, timeout.Phase, timeout.Deadline
+	default:
+		var choice models.PlayerChoice
+		if err := json.Unmarshal(value, &choice); err != nil {
+			return move, err
+		}
+		move.Choice = choice.Choice
 	}
+	return move, nil
+}
 
-	currentRound.Result = result
-	log.Printf(Green+"[INFO] %s | SessionID: %s | Round: %d"+Reset, result, session.SessionID, session.CurrentRound)
-
-	// Check if the game has finished
-	if session.Player1Wins == 3 || session.Player2Wins == 3 {
-		session.Status = "finished"
-		if session.Player1Wins == 3 {
-			session.SetWinner("Player 1")
-		} else {
-			session.SetWinner("Player 2")
+// logEvents logs the changes the engine made to a session
+func logEvents(sessionID string, events []engine.Event) {
+	for _, e := range events {
+		player := models.PlayerName(e.PlayerID)
+		switch e.Type {
+		case engine.EventPlayerJoined:
+			log.Printf(Yellow+"[INFO] %s joined | SessionID: %s"+Reset, player, sessionID)
+		case engine.EventMovePlayed, engine.EventMoveRevealed:
+			log.Printf(Yellow+"[INFO] %s has played | SessionID: %s | Round: %d"+Reset, player, sessionID, e.Round)
+		case engine.EventMoveCommitted:
+			log.Printf(Yellow+"[INFO] %s has committed | SessionID: %s | Round: %d"+Reset, player, sessionID, e.Round)
+		case engine.EventRevealStarted:
+			log.Printf(Green+"[INFO] All players have committed, revealing | SessionID: %s | Round: %d"+Reset, sessionID, e.Round)
+		case engine.EventDeadlineMissed:
+			if e.Detail == "" {
+				log.Printf(Yellow+"[INFO] %s missed the deadline and forfeits the round | SessionID: %s"+Reset, player, sessionID)
+			} else {
+				log.Printf(Yellow+"[INFO] %s missed the deadline, playing %s | SessionID: %s"+Reset, player, e.Detail, sessionID)
+			}
+		case engine.EventPlayerDropped:
+			log.Printf(Red+"[INFO] %s dropped after too many missed deadlines | SessionID: %s"+Reset, player, sessionID)
+		case engine.EventRoundResolved:
+			log.Printf(Green+"[INFO] %s | SessionID: %s | Round: %d"+Reset, e.Detail, sessionID, e.Round)
+		case engine.EventRoundStarted:
+			log.Printf(Green+"[INFO] Round %d started | SessionID: %s"+Reset, e.Round, sessionID)
+		case engine.EventSessionFinished:
+			if e.PlayerID == "" {
+				log.Printf(Red+"[INFO] Game over | SessionID: %s | Draw 🤝"+Reset, sessionID)
+			} else {
+				log.Printf(Red+"[INFO] Game over | SessionID: %s | Winner: %s 🥇"+Reset, sessionID, player)
+			}
+		case engine.EventSessionAbandoned:
+			log.Printf(Red+"[INFO] Game abandoned | SessionID: %s"+Reset, sessionID)
+		case engine.EventSessionPaused:
+			log.Printf(Yellow+"[INFO] Game paused by %s | SessionID: %s"+Reset, player, sessionID)
+		case engine.EventSessionResumed:
+			log.Printf(Yellow+"[INFO] Game resumed by %s | SessionID: %s"+Reset, player, sessionID)
+		case engine.EventSessionCancelled:
+			log.Printf(Red+"[INFO] Game cancelled by %s | SessionID: %s"+Reset, player, sessionID)
 		}
-		log.Printf(Red+"[INFO] Game over | SessionID: %s | Winner: %s 🥇"+Reset, session.SessionID, session.GetWinner())
 	}
 }
 
@@ -213,14 +354,13 @@ func determineWinner(session *models.GameSession) {
 func StatsHandler(w http.ResponseWriter, r *http.Request, kafkaBroker string) {
 	log.Println("[INFO] Received request to StatsHandler")
 
-	// Create a Kafka client
-	client := kafkago.Client{
-		Addr: kafkago.TCP(kafkaBroker),
+	// Round results are rendered with the style and language asked for, emoji in English by default
+	formatter, err := render.New(render.Style(r.URL.Query().Get("style")), r.URL.Query().Get("lang"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	// Define the regex pattern for topics
-	topicPattern := regexp.MustCompile(`^game-results-.*`)
-
 	// Create a context that listens for SIGINT or SIGTERM signals
 	serverCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -239,82 +379,80 @@ func StatsHandler(w http.ResponseWriter, r *http.Request, kafkaBroker string) {
 		cancel() // Cancel the request context
 	}()
 
-	// Wait for a matching topic to become available
-	var matchingTopics []kafkago.Topic
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+
+	// Every session update goes through the session-events topic
+	reader := kafkago.NewReader(kafkago.ReaderConfig{
+		Brokers:  []string{kafkaBroker},
+		Topic:    kafka.SessionEventsTopic,
+		GroupID:  "live-stats-consumer",
+		MinBytes: 10e3, // 10KB
+		MaxBytes: 10e6, // 10MB
+	})
+	defer reader.Close()
+
+	// An update that lost to a concurrent one leads to a version already sent
+	sent := map[string]int64{}
 
-searchLoop: // Labeled loop to allow breaking out after finding matching topics
+	// Kafka message reading loop
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("[INFO] Context canceled, exiting")
+			log.Println("[INFO] Context canceled, shutting down reader")
 			return
 		default:
-			var err error
-			// Use the topics.ListRe to find matching topics
-			matchingTopics, err = topics.ListRe(ctx, &client, topicPattern)
+			// Try reading a message from Kafka
+			msg, err := reader.ReadMessage(ctx)
 			if err != nil {
-				log.Printf("[ERROR] Error listing topics: %v", err)
-				// Retry after a brief sleep
-				time.Sleep(5 * time.Second)
+				log.Printf("[ERROR] Error fetching message from Kafka: %v", err)
+				// Log the error and retry after a brief sleep
+				time.Sleep(1 * time.Second)
+				continue
+			}
+
+			// Each message holds the records of a session update
+			records, err := kafka.DecodeRecords(msg.Value)
+			if err != nil || len(records) == 0 {
+				log.Printf("[ERROR] Error unmarshalling session records: %v", err)
+				continue
+			}
+			last := records[len(records)-1]
+			session, err := sessionAt(ctx, last.SessionID, last.Seq)
+			if err != nil {
+				log.Printf("[ERROR] Error reading game session %s: %v", last.SessionID, err)
+				continue
+			}
+			if session.NoSpectators || session.Version <= sent[session.SessionID] {
 				continue
 			}
+			sent[session.SessionID] = session.Version
+			session.InviteHash = ""
 
-			if len(matchingTopics) > 0 {
-				log.Println("[INFO] Found matching topics, proceeding")
-				break searchLoop // Break out of the loop when matching topics are found
+			// Log the session and send it to the client
+			log.Printf("[INFO] Live game session: %v", session)
+			if err := encoder.Encode(formatter.Session(session)); err != nil {
+				log.Printf("[ERROR] Error encoding session: %v", err)
 			}
 
-			// Sleep for a while before retrying to find topics
-			time.Sleep(5 * time.Second)
+			// Flush the data to ensure it gets sent to the client immediately
+			w.(http.Flusher).Flush()
 		}
 	}
+}
 
-	// Set response header
-	w.Header().Set("Content-Type", "application/json")
-	encoder := json.NewEncoder(w)
-
-	// Iterate over each matching topic and read messages
-	for _, topic := range matchingTopics {
-		reader := kafkago.NewReader(kafkago.ReaderConfig{
-			Brokers:  []string{kafkaBroker},
-			Topic:    topic.Name,
-			GroupID:  "live-stats-consumer",
-			MinBytes: 10e3, // 10KB
-			MaxBytes: 10e6, // 10MB
-		})
-		defer reader.Close()
-
-		// Kafka message reading loop
-		for {
-			select {
-			case <-ctx.Done():
-				log.Println("[INFO] Context canceled, shutting down reader")
-				return
-			default:
-				// Try reading a message from Kafka
-				msg, err := reader.ReadMessage(ctx)
-				if err != nil {
-					log.Printf("[ERROR] Error fetching message from Kafka: %v", err)
-					// Log the error and retry after a brief sleep
-					time.Sleep(1 * time.Second)
-					continue
-				}
-
-				var session models.GameSession
-				if err := json.Unmarshal(msg.Value, &session); err != nil {
-					log.Printf("[ERROR] Error unmarshalling game session: %v", err)
-					continue
-				}
-
-				// Log the session and send it to the client
-				log.Printf("[INFO] Live game session: %v", session)
-				if err := encoder.Encode(session); err != nil {
-					log.Printf("[ERROR] Error encoding session: %v", err)
-				}
-
-				// Flush the data to ensure it gets sent to the client immediately
-				w.(http.Flusher).Flush()
-			}
-		}
+// sessionAt returns a session once the store holds it at the given version or a later one
+func sessionAt(ctx context.Context, sessionID string, version int64) (*models.GameSession, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var session *models.GameSession
+	err := sessions.Watch(ctx, sessionID, func(s *models.GameSession) bool {
+		session = s
+		return s.Version >= version
+	})
+	if session == nil {
+		return nil, err
 	}
+	return session, nil
 }
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"shifumi-game/pkg/kafka"
+	"time"
+)
+
+// Start creates the topics of the game-logic service, starts its background work, and registers its
+// handlers on mux. The session store and token keys are set beforehand, see SetSessionStore and
+// SetTokenKeys.
+func Start(kafkaBroker string, mux *http.ServeMux) error {
+	// Keep the external bots in sync with the bot registry
+	if err := kafka.CreateCompactedTopic(kafkaBroker, kafka.BotRegistryTopic, 1); err != nil {
+		return fmt.Errorf("failed to create topic %s: %w", kafka.BotRegistryTopic, err)
+	}
+	go func() {
+		for {
+			err := kafka.WatchBotRegistry(context.Background(), kafkaBroker)
+			log.Printf("[WARN] Bot registry watcher exited: %v. Restarting...", err)
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
+	// Finished sessions are published for the rating service, including the ones the service stopped
+	// before publishing
+	if err := kafka.CreateCompactedTopic(kafkaBroker, kafka.FinishedGamesTopic, 1); err != nil {
+		return fmt.Errorf("failed to create topic %s: %w", kafka.FinishedGamesTopic, err)
+	}
+	go RecoverFinishedGames(kafkaBroker)
+
+	// Reschedule the round deadlines of the sessions in progress
+	go RecoverDeadlines(kafkaBroker)
+
+	// Start processing player choices in a separate goroutine
+	go func() {
+		for {
+			log.Println("[INFO] Attempting to start processing player choices...")
+			ProcessChoices(kafkaBroker)
+			log.Println("[WARN] ProcessChoices function exited unexpectedly. Restarting...")
+			time.Sleep(2 * time.Second) // Sleep briefly before restarting to avoid tight loops in case of persistent errors
+		}
+	}()
+
+	// Registering handlers for live stats
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		StatsHandler(w, r, kafkaBroker)
+	})
+
+	// Registering admin handlers, protected by ADMIN_TOKEN
+	mux.HandleFunc("/admin/bots", func(w http.ResponseWriter, r *http.Request) {
+		AdminBotsHandler(w, r, kafkaBroker)
+	})
+	mux.HandleFunc("/admin/bots/", func(w http.ResponseWriter, r *http.Request) {
+		AdminBotsHandler(w, r, kafkaBroker)
+	})
+	mux.HandleFunc("/admin/matches", func(w http.ResponseWriter, r *http.Request) {
+		AdminMatchesHandler(w, r, kafkaBroker)
+	})
+	return nil
+}
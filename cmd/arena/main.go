@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"shifumi-game/pkg/arena"
+	"shifumi-game/pkg/match"
+	"shifumi-game/pkg/rules"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func main() {
+	bots := flag.String("bots", "random,frequency,beat-last,markov:1,markov:2,markov:3", "Comma-separated bot strategies")
+	variant := flag.String("variant", rules.Default, "Game variant")
+	format := flag.String("format", "first-to:3", "Match format, <type>:<target>[:<tiebreak>]")
+	matches := flag.Int("matches", 1000, "Matches played by each pair of bots")
+	maxRounds := flag.Int("max-rounds", arena.DefaultMaxRounds, "Rounds after which a match is drawn")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "Seed of the bots' random sources")
+	workers := flag.Int("workers", runtime.NumCPU(), "Pairs played concurrently")
+	output := flag.String("output", "text", "Output format: text, json or csv")
+	flag.Parse()
+
+	// Load custom game variants, if any, on top of the built-in ones
+	if variantsDir := os.Getenv("VARIANTS_DIR"); variantsDir != "" {
+		if _, err := rules.LoadDir(variantsDir); err != nil {
+			log.Fatalf("Failed to load variants from %s: %v", variantsDir, err)
+		}
+	}
+	rs, err := rules.Get(*variant)
+	if err != nil {
+		log.Fatalf("%v (available: %s)", err, strings.Join(rules.Names(), ", "))
+	}
+	f, err := match.ParseFormat(*format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	start := time.Now()
+	report, err := arena.Run(arena.Config{
+		Ruleset:   rs,
+		Format:    f,
+		Bots:      strings.Split(*bots, ","),
+		Matches:   *matches,
+		MaxRounds: *maxRounds,
+		Seed:      *seed,
+		Workers:   *workers,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("[INFO] Played %d matches in %s | Seed: %d", *matches*len(report.HeadToHead), time.Since(start).Round(time.Millisecond), *seed)
+
+	switch *output {
+	case "text":
+		err = writeText(os.Stdout, report)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	case "csv":
+		err = writeCSV(os.Stdout, report)
+	default:
+		log.Fatalf("unknown output format %q, expected text, json or csv", *output)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeText prints the standings table followed by the head-to-head win rates of the row bot
+// against the column bot
+func writeText(out io.Writer, report *arena.Report) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Variant: %s | Format: %s | Matches per pair: %d\n\n", report.Variant, report.Format, report.Matches)
+	fmt.Fprintln(w, "#\tBot\tPlayed\tWon\tDrawn\tLost\tPoints\tWin rate")
+	for i, s := range report.Standings {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%d\t%d\t%d\t%.1f%%\n", i+1, s.Bot, s.Played, s.Won, s.Drawn, s.Lost, s.Points, 100*s.WinRate)
+	}
+
+	fmt.Fprint(w, "\nHead to head\t")
+	for _, col := range report.Standings {
+		fmt.Fprintf(w, "%s\t", col.Bot)
+	}
+	fmt.Fprintln(w)
+	for _, row := range report.Standings {
+		fmt.Fprintf(w, "%s\t", row.Bot)
+		for _, col := range report.Standings {
+			if rate, ok := report.WinRate(row.Bot, col.Bot); ok {
+				fmt.Fprintf(w, "%.1f%%\t", 100*rate)
+			} else {
+				fmt.Fprint(w, "-\t")
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
+
+// writeCSV prints one line per pair of bots with their head-to-head record
+func writeCSV(out io.Writer, report *arena.Report) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"a", "b", "matches", "wins_a", "wins_b", "draws", "rounds", "win_rate_a"})
+	for _, p := range report.HeadToHead {
+		w.Write([]string{
+			p.A, p.B,
+			strconv.Itoa(p.Matches), strconv.Itoa(p.WinsA), strconv.Itoa(p.WinsB), strconv.Itoa(p.Draws), strconv.Itoa(p.Rounds),
+			strconv.FormatFloat(p.WinRate, 'f', 4, 64),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -5,6 +5,11 @@ import (
 	"net/http"
 	"os"
 	api "shifumi-game/api/client"
+	"shifumi-game/pkg/auth"
+	"shifumi-game/pkg/kafka"
+	"shifumi-game/pkg/rating"
+	"shifumi-game/pkg/rules"
+	"shifumi-game/pkg/store"
 )
 
 func main() {
@@ -13,8 +18,48 @@ func main() {
 		log.Fatal("KAFKA_BROKER environment variable is not set")
 	}
 
-	http.HandleFunc("/play", func(w http.ResponseWriter, r *http.Request) {
-		api.MakeChoiceHandler(w, r, kafkaBroker)
-	})
+	// Player tokens, disabled when no key is configured
+	keys, err := auth.FromEnv()
+	if err != nil {
+		log.Fatalf("Invalid player token configuration: %v", err)
+	}
+	if keys == nil {
+		log.Println("[WARN] AUTH_KEY is not set, player tokens are disabled: anyone can move for any player")
+	}
+	api.SetTokenKeys(keys)
+
+	// Load custom game variants, if any, on top of the built-in ones
+	if variantsDir := os.Getenv("VARIANTS_DIR"); variantsDir != "" {
+		loaded, err := rules.LoadDir(variantsDir)
+		if err != nil {
+			log.Fatalf("Failed to load variants from %s: %v", variantsDir, err)
+		}
+		log.Printf("[INFO] Loaded %d variant(s) from %s", len(loaded), variantsDir)
+	}
+
+	// Game sessions are kept in the session-events topic, with snapshots in the compacted game-results
+	// topic, unless another store is configured
+	if err := kafka.CreateSessionEventsTopic(kafkaBroker, 1); err != nil {
+		log.Fatalf("Failed to create topic %s: %v", kafka.SessionEventsTopic, err)
+	}
+	if err := kafka.CreateCompactedTopic(kafkaBroker, kafka.GameResultsTopic, 1); err != nil {
+		log.Fatalf("Failed to create topic %s: %v", kafka.GameResultsTopic, err)
+	}
+	sessions, err := store.NewShared(os.Getenv("SESSION_STORE"), kafkaBroker, os.Getenv("SESSION_STORE_PATH"), false)
+	if err != nil {
+		log.Fatalf("Invalid session store configuration: %v", err)
+	}
+	api.SetSessionStore(sessions)
+
+	// Players are paired by rating, computed from the finished games like the rating service does
+	system, err := rating.New(os.Getenv("RATING_SYSTEM"))
+	if err != nil {
+		log.Fatalf("Invalid rating system: %v", err)
+	}
+	api.SetRatings(rating.NewStore(system))
+
+	if err := api.Start(kafkaBroker, http.DefaultServeMux); err != nil {
+		log.Fatal(err)
+	}
 	log.Fatal(http.ListenAndServe(":8081", nil))
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	client "shifumi-game/api/client"
+	server "shifumi-game/api/server"
+	"shifumi-game/pkg/auth"
+	"shifumi-game/pkg/kafka"
+	"shifumi-game/pkg/rating"
+	"shifumi-game/pkg/rules"
+	"shifumi-game/pkg/store"
+)
+
+// The dev service runs the client and game-logic services in a single process, on their usual ports,
+// so that they can share a session store held by the process: the memory store, or the bolt store
+func main() {
+	kafkaBroker := os.Getenv("KAFKA_BROKER")
+	if kafkaBroker == "" {
+		log.Fatal("KAFKA_BROKER environment variable is not set")
+	}
+
+	// Player tokens, disabled when no key is configured
+	keys, err := auth.FromEnv()
+	if err != nil {
+		log.Fatalf("Invalid player token configuration: %v", err)
+	}
+	if keys == nil {
+		log.Println("[WARN] AUTH_KEY is not set, player tokens are disabled: anyone can move for any player")
+	} else if !keys.CanSign() {
+		log.Println("[WARN] AUTH_KEY is not set, bot moves cannot be signed: sessions with bots are rejected")
+	}
+	client.SetTokenKeys(keys)
+	server.SetTokenKeys(keys)
+
+	// Load custom game variants, if any, on top of the built-in ones
+	if variantsDir := os.Getenv("VARIANTS_DIR"); variantsDir != "" {
+		loaded, err := rules.LoadDir(variantsDir)
+		if err != nil {
+			log.Fatalf("Failed to load variants from %s: %v", variantsDir, err)
+		}
+		log.Printf("[INFO] Loaded %d variant(s) from %s", len(loaded), variantsDir)
+	}
+
+	// Monitor Kafka availability before starting the services
+	log.Println("[INFO] Waiting for Kafka to be available...")
+	kafka.MonitorKafkaAvailability(kafkaBroker, []string{"player-choices"}, 1, 1)
+	log.Println("[INFO] Kafka is available. Starting the client and game logic services...")
+
+	// Both services share the same session store, the memory store unless another one is configured
+	kind := os.Getenv("SESSION_STORE")
+	if kind == "" {
+		kind = store.KindMemory
+	}
+	if kind == store.KindKafka {
+		if err := kafka.CreateSessionEventsTopic(kafkaBroker, 1); err != nil {
+			log.Fatalf("Failed to create topic %s: %v", kafka.SessionEventsTopic, err)
+		}
+		if err := kafka.CreateCompactedTopic(kafkaBroker, kafka.GameResultsTopic, 1); err != nil {
+			log.Fatalf("Failed to create topic %s: %v", kafka.GameResultsTopic, err)
+		}
+	}
+	sessions, err := store.NewShared(kind, kafkaBroker, os.Getenv("SESSION_STORE_PATH"), true)
+	if err != nil {
+		log.Fatalf("Invalid session store configuration: %v", err)
+	}
+	client.SetSessionStore(sessions)
+	server.SetSessionStore(sessions)
+	log.Printf("[INFO] Sessions are kept in the %s store", kind)
+
+	// Players are paired by rating, computed from the finished games like the rating service does
+	system, err := rating.New(os.Getenv("RATING_SYSTEM"))
+	if err != nil {
+		log.Fatalf("Invalid rating system: %v", err)
+	}
+	client.SetRatings(rating.NewStore(system))
+
+	serverMux, clientMux := http.NewServeMux(), http.NewServeMux()
+	if err := server.Start(kafkaBroker, serverMux); err != nil {
+		log.Fatal(err)
+	}
+	if err := client.Start(kafkaBroker, clientMux); err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		log.Println("[INFO] Game logic service is running on port 8082")
+		log.Fatal(http.ListenAndServe(":8082", serverMux))
+	}()
+	log.Println("[INFO] Client service is running on port 8081")
+	log.Fatal(http.ListenAndServe(":8081", clientMux))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	api "shifumi-game/api/leaderboard"
+	"shifumi-game/pkg/kafka"
+	"shifumi-game/pkg/leaderboard"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/rating"
+	"time"
+)
+
+func main() {
+	kafkaBroker := os.Getenv("KAFKA_BROKER")
+	if kafkaBroker == "" {
+		log.Fatal("KAFKA_BROKER environment variable is not set")
+	}
+
+	// Ratings use the same system as the rating service
+	system, err := rating.New(os.Getenv("RATING_SYSTEM"))
+	if err != nil {
+		log.Fatalf("Invalid rating system: %v", err)
+	}
+	board := leaderboard.NewBoard(system)
+
+	// The leaderboard is rebuilt from every finished game on startup, then kept up to date
+	if err := kafka.CreateCompactedTopic(kafkaBroker, kafka.FinishedGamesTopic, 1); err != nil {
+		log.Fatalf("Failed to create topic %s: %v", kafka.FinishedGamesTopic, err)
+	}
+	go func() {
+		for {
+			err := kafka.WatchFinishedGames(context.Background(), kafkaBroker, func(session *models.GameSession) {
+				api.RecordGame(board, session)
+			})
+			log.Printf("[WARN] Finished games watcher exited: %v. Restarting...", err)
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
+	// Display names of the players
+	if err := kafka.CreateCompactedTopic(kafkaBroker, kafka.AccountsTopic, 1); err != nil {
+		log.Fatalf("Failed to create topic %s: %v", kafka.AccountsTopic, err)
+	}
+	go func() {
+		for {
+			err := kafka.WatchAccounts(context.Background(), kafkaBroker)
+			log.Printf("[WARN] Account registry watcher exited: %v. Restarting...", err)
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
+	http.HandleFunc("/leaderboard", func(w http.ResponseWriter, r *http.Request) {
+		api.LeaderboardHandler(w, r, board)
+	})
+	log.Fatal(http.ListenAndServe(":8084", nil))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"shifumi-game/pkg/engine"
+	"shifumi-game/pkg/kafka"
+	"shifumi-game/pkg/store"
+	"time"
+)
+
+// The migration copies the latest snapshot of every per-session game-results-<id> topic into the
+// session store: the snapshot, converted to the current session format (see kafka.DecodeLegacySession), becomes the session-created record of the event log of the session, in
+// the session-events topic, and its first snapshot in the compacted game-results topic. Sessions
+// already in the store are left as they are, so the migration can be run again, e.g. after services
+// on the previous version wrote more sessions.
+func main() {
+	broker := flag.String("broker", os.Getenv("KAFKA_BROKER"), "Kafka broker, KAFKA_BROKER by default")
+	deleteTopics := flag.Bool("delete", false, "Delete the per-session topics once their session is in the game-results topic")
+	dryRun := flag.Bool("dry-run", false, "List the sessions to migrate without writing anything")
+	flag.Parse()
+	if *broker == "" {
+		log.Fatal("No Kafka broker, set -broker or KAFKA_BROKER")
+	}
+
+	if err := kafka.CreateSessionEventsTopic(*broker, 1); err != nil {
+		log.Fatalf("Failed to create topic %s: %v", kafka.SessionEventsTopic, err)
+	}
+	if err := kafka.CreateCompactedTopic(*broker, kafka.GameResultsTopic, 1); err != nil {
+		log.Fatalf("Failed to create topic %s: %v", kafka.GameResultsTopic, err)
+	}
+	sessions := store.NewKafkaStore(*broker)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	sessionIDs, err := kafka.ListSessionTopics(ctx, *broker)
+	cancel()
+	if err != nil {
+		log.Fatalf("Failed to list the per-session topics: %v", err)
+	}
+	log.Printf("[INFO] Found %d per-session topic(s)", len(sessionIDs))
+
+	copied, skipped, failed := 0, 0, 0
+	for _, sessionID := range sessionIDs {
+		_, err := sessions.Get(context.Background(), sessionID)
+		switch {
+		case err == nil:
+			log.Printf("[INFO] Already migrated | SessionID: %s", sessionID)
+			skipped++
+		case !errors.Is(err, store.ErrNotFound):
+			log.Printf("[ERROR] Failed to look up session | SessionID: %s | Error: %v", sessionID, err)
+			failed++
+			continue
+		default:
+			session, err := kafka.ReadSessionTopic(*broker, sessionID)
+			if err != nil {
+				log.Printf("[ERROR] Failed to read session topic | SessionID: %s | Error: %v", sessionID, err)
+				failed++
+				continue
+			}
+			if session == nil {
+				log.Printf("[INFO] Empty session topic | SessionID: %s", sessionID)
+				skipped++
+				break
+			}
+			if *dryRun {
+				log.Printf("[INFO] Would migrate | SessionID: %s | Status: %s | Round: %d", sessionID, session.Status, session.CurrentRound)
+				copied++
+				continue
+			}
+			// The converted snapshot has no version: the session-created record makes it version 1
+			records := []engine.Record{engine.CreationRecord(session, time.Now())}
+			if err := sessions.Append(context.Background(), session, records); err != nil {
+				log.Printf("[ERROR] Failed to copy session | SessionID: %s | Error: %v", sessionID, err)
+				failed++
+				continue
+			}
+			log.Printf("[INFO] Migrated | SessionID: %s | Status: %s | Round: %d", sessionID, session.Status, session.CurrentRound)
+			copied++
+		}
+
+		if *deleteTopics && !*dryRun {
+			if err := kafka.DeleteSessionTopic(*broker, sessionID); err != nil {
+				log.Printf("[ERROR] Failed to delete session topic | SessionID: %s | Error: %v", sessionID, err)
+				failed++
+			}
+		}
+	}
+
+	log.Printf("[INFO] Migration done | Copied: %d | Skipped: %d | Failed: %d", copied, skipped, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
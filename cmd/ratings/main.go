@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	api "shifumi-game/api/ratings"
+	"shifumi-game/pkg/kafka"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/rating"
+	"time"
+)
+
+func main() {
+	kafkaBroker := os.Getenv("KAFKA_BROKER")
+	if kafkaBroker == "" {
+		log.Fatal("KAFKA_BROKER environment variable is not set")
+	}
+
+	// Elo by default, or Glicko-2
+	system, err := rating.New(os.Getenv("RATING_SYSTEM"))
+	if err != nil {
+		log.Fatalf("Invalid rating system: %v", err)
+	}
+	store := rating.NewStore(system)
+	log.Printf("[INFO] Rating players with %s", system.Name())
+
+	// The ratings are rebuilt from every finished game on startup, then kept up to date
+	if err := kafka.CreateCompactedTopic(kafkaBroker, kafka.FinishedGamesTopic, 1); err != nil {
+		log.Fatalf("Failed to create topic %s: %v", kafka.FinishedGamesTopic, err)
+	}
+	go func() {
+		for {
+			err := kafka.WatchFinishedGames(context.Background(), kafkaBroker, func(session *models.GameSession) {
+				api.RateGame(store, session)
+			})
+			log.Printf("[WARN] Finished games watcher exited: %v. Restarting...", err)
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
+	http.HandleFunc("/ratings", func(w http.ResponseWriter, r *http.Request) {
+		api.RatingsHandler(w, r, store)
+	})
+	http.HandleFunc("/ratings/", func(w http.ResponseWriter, r *http.Request) {
+		api.RatingsHandler(w, r, store)
+	})
+	log.Fatal(http.ListenAndServe(":8083", nil))
+}
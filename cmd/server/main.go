@@ -5,8 +5,10 @@ import (
 	"net/http"
 	"os"
 	api "shifumi-game/api/server"
+	"shifumi-game/pkg/auth"
 	"shifumi-game/pkg/kafka"
-	"time"
+	"shifumi-game/pkg/rules"
+	"shifumi-game/pkg/store"
 )
 
 func main() {
@@ -15,6 +17,27 @@ func main() {
 		log.Fatal("KAFKA_BROKER environment variable is not set")
 	}
 
+	// Player tokens, disabled when no key is configured
+	keys, err := auth.FromEnv()
+	if err != nil {
+		log.Fatalf("Invalid player token configuration: %v", err)
+	}
+	if keys == nil {
+		log.Println("[WARN] AUTH_KEY is not set, player tokens are disabled: anyone can move for any player")
+	} else if !keys.CanSign() {
+		log.Println("[WARN] AUTH_KEY is not set, bot moves cannot be signed: sessions with bots are rejected")
+	}
+	api.SetTokenKeys(keys)
+
+	// Load custom game variants, if any, on top of the built-in ones
+	if variantsDir := os.Getenv("VARIANTS_DIR"); variantsDir != "" {
+		loaded, err := rules.LoadDir(variantsDir)
+		if err != nil {
+			log.Fatalf("Failed to load variants from %s: %v", variantsDir, err)
+		}
+		log.Printf("[INFO] Loaded %d variant(s) from %s", len(loaded), variantsDir)
+	}
+
 	// Topics to monitor
 	topics := []string{"player-choices"}
 
@@ -23,20 +46,23 @@ func main() {
 	kafka.MonitorKafkaAvailability(kafkaBroker, topics, 1, 1)
 	log.Println("[INFO] Kafka is available. Starting game logic service setup...")
 
-	// Start processing player choices in a separate goroutine
-	go func() {
-		for {
-			log.Println("[INFO] Attempting to start processing player choices...")
-			api.ProcessChoices(kafkaBroker)
-			log.Println("[WARN] ProcessChoices function exited unexpectedly. Restarting...")
-			time.Sleep(2 * time.Second) // Sleep briefly before restarting to avoid tight loops in case of persistent errors
-		}
-	}()
+	// Game sessions are kept in the session-events topic, with snapshots in the compacted game-results
+	// topic, unless another store is configured
+	if err := kafka.CreateSessionEventsTopic(kafkaBroker, 1); err != nil {
+		log.Fatalf("Failed to create topic %s: %v", kafka.SessionEventsTopic, err)
+	}
+	if err := kafka.CreateCompactedTopic(kafkaBroker, kafka.GameResultsTopic, 1); err != nil {
+		log.Fatalf("Failed to create topic %s: %v", kafka.GameResultsTopic, err)
+	}
+	sessions, err := store.NewShared(os.Getenv("SESSION_STORE"), kafkaBroker, os.Getenv("SESSION_STORE_PATH"), false)
+	if err != nil {
+		log.Fatalf("Invalid session store configuration: %v", err)
+	}
+	api.SetSessionStore(sessions)
 
-	// Registering handlers for live stats
-	http.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
-		api.StatsHandler(w, r, kafkaBroker)
-	})
+	if err := api.Start(kafkaBroker, http.DefaultServeMux); err != nil {
+		log.Fatal(err)
+	}
 
 	log.Println("[INFO] Game logic service is running on port 8082")
 	log.Fatal(http.ListenAndServe(":8082", nil)) // Serve on port 8082
@@ -0,0 +1,223 @@
+package accounts
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var (
+	// ErrInvalidCredentials is returned for an API key that matches no account
+	ErrInvalidCredentials = errors.New("invalid API key")
+	// ErrNameTaken is returned when registering a display name that another account uses
+	ErrNameTaken = errors.New("display name is already taken")
+	// ErrNotFound is returned for an unknown account ID
+	ErrNotFound = errors.New("account not found")
+)
+
+// Account is the persistent identity of a player across sessions. The API key itself is never
+// stored, only its SHA-256.
+type Account struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	APIKeyHash string    `json:"api_key_hash"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Profile is the public part of an account
+type Profile struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Profile returns the public part of the account
+func (a Account) Profile() Profile {
+	return Profile{ID: a.ID, Name: a.Name, CreatedAt: a.CreatedAt}
+}
+
+// ValidateName checks a display name: 3 to 32 letters, digits, spaces, dashes or underscores
+func ValidateName(name string) error {
+	if n := len([]rune(name)); n < 3 || n > 32 || strings.TrimSpace(name) != name {
+		return fmt.Errorf("display name must be 3 to 32 characters, without leading or trailing spaces")
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != ' ' && r != '-' && r != '_' {
+			return fmt.Errorf("display name can only contain letters, digits, spaces, dashes and underscores")
+		}
+	}
+	return nil
+}
+
+var (
+	mu       sync.RWMutex
+	byID     = map[string]Account{}
+	byName   = map[string]string{}    // Lowercased display name to account ID
+	byKey    = map[string]string{}    // API key hash to account ID
+	reserved = map[string]string{}    // Lowercased display names of the accounts created here and not read back yet
+	pending  = map[string]chan bool{} // Accounts created here and not read back yet, told whether they hold their name
+)
+
+// Create returns a new account with its API key, which is only known to the caller. The account is
+// only registered once it is read back from the account registry, as several instances may create
+// accounts at once: the caller saves it to the registry, then waits for it with Confirm.
+func Create(name string, now time.Time) (Account, string, error) {
+	if err := ValidateName(name); err != nil {
+		return Account{}, "", err
+	}
+	apiKey := "sk_" + randomHex(24)
+	account := Account{
+		ID:         "p_" + randomHex(8),
+		Name:       name,
+		APIKeyHash: hashKey(apiKey),
+		CreatedAt:  now.UTC(),
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	key := strings.ToLower(name)
+	if _, ok := byName[key]; ok {
+		return Account{}, "", ErrNameTaken
+	}
+	if _, ok := reserved[key]; ok {
+		return Account{}, "", ErrNameTaken
+	}
+	reserved[key] = account.ID
+	pending[account.ID] = make(chan bool, 1)
+	return account, apiKey, nil
+}
+
+// Confirm waits for an account returned by Create to be read back from the account registry, and
+// returns ErrNameTaken when another account registered the same display name first
+func Confirm(ctx context.Context, id string) error {
+	mu.RLock()
+	registered, ok := pending[id]
+	mu.RUnlock()
+	if !ok {
+		return ErrNotFound
+	}
+	defer Release(id)
+
+	select {
+	case holdsName := <-registered:
+		if !holdsName {
+			return ErrNameTaken
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees the display name of an account returned by Create, when it is not saved after all
+func Release(id string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for name, reservedBy := range reserved {
+		if reservedBy == id {
+			delete(reserved, name)
+		}
+	}
+	delete(pending, id)
+}
+
+// RotateKey replaces the API key of an account and returns the updated account with its new key
+func RotateKey(id string) (Account, string, error) {
+	account, ok := Get(id)
+	if !ok {
+		return Account{}, "", ErrNotFound
+	}
+	apiKey := "sk_" + randomHex(24)
+	account.APIKeyHash = hashKey(apiKey)
+	Put(account)
+	return account, apiKey, nil
+}
+
+// Put adds or replaces an account, e.g. when it is read back from the account registry, and returns
+// whether it was registered. Every instance reads the registry in the same order, so the first
+// account read with a display name holds it: the accounts read later with the same name are not
+// registered.
+func Put(account Account) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	key := strings.ToLower(account.Name)
+	holder, taken := byName[key]
+	registered := !taken || holder == account.ID
+	if created, ok := pending[account.ID]; ok {
+		created <- registered
+		delete(pending, account.ID)
+		delete(reserved, key)
+	}
+	if !registered {
+		return false
+	}
+
+	if previous, ok := byID[account.ID]; ok {
+		delete(byName, strings.ToLower(previous.Name))
+		delete(byKey, previous.APIKeyHash)
+	}
+	byID[account.ID] = account
+	byName[key] = account.ID
+	byKey[account.APIKeyHash] = account.ID
+	return true
+}
+
+// Delete removes an account
+func Delete(id string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if account, ok := byID[id]; ok {
+		delete(byName, strings.ToLower(account.Name))
+		delete(byKey, account.APIKeyHash)
+		delete(byID, id)
+	}
+}
+
+// Get returns the account with the given ID
+func Get(id string) (Account, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	account, ok := byID[id]
+	return account, ok
+}
+
+// ByName returns the account with the given display name, ignoring case
+func ByName(name string) (Account, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	account, ok := byID[byName[strings.ToLower(name)]]
+	return account, ok
+}
+
+// Authenticate returns the account an API key belongs to
+func Authenticate(apiKey string) (Account, error) {
+	hash := hashKey(apiKey)
+	mu.RLock()
+	defer mu.RUnlock()
+	account, ok := byID[byKey[hash]]
+	if !ok || subtle.ConstantTimeCompare([]byte(account.APIKeyHash), []byte(hash)) != 1 {
+		return Account{}, ErrInvalidCredentials
+	}
+	return account, nil
+}
+
+func hashKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("accounts: cannot read random bytes: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
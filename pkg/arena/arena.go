@@ -0,0 +1,244 @@
+package arena
+
+import (
+	"fmt"
+	"math/rand"
+	"shifumi-game/pkg/bot"
+	"shifumi-game/pkg/match"
+	"shifumi-game/pkg/rules"
+	"sort"
+	"sync"
+)
+
+// DefaultMaxRounds caps the length of a match, so that two bots stuck on draws cannot play forever
+const DefaultMaxRounds = 1000
+
+// Config describes a round-robin tournament between bot strategies
+type Config struct {
+	Ruleset   rules.Ruleset
+	Format    match.Format
+	Bots      []string // Strategy specs, e.g. "markov:2"
+	Matches   int      // Matches played by each pair of bots
+	MaxRounds int      // Rounds after which a match is drawn, DefaultMaxRounds when 0
+	Seed      int64    // Seed of the bots' random sources, so that a tournament can be replayed
+	Workers   int      // Pairs played concurrently, 1 when 0
+}
+
+// MatchResult is the outcome of a single match between two bots
+type MatchResult struct {
+	Winner int    // 0 or 1, match.NoWinner for a draw
+	Rounds int    // Rounds played
+	Wins   [2]int // Rounds won by each bot
+}
+
+// Pairing is the head-to-head record of two bots, from the point of view of A
+type Pairing struct {
+	A       string  `json:"a"`
+	B       string  `json:"b"`
+	Matches int     `json:"matches"`
+	WinsA   int     `json:"wins_a"`
+	WinsB   int     `json:"wins_b"`
+	Draws   int     `json:"draws"`
+	Rounds  int     `json:"rounds"`
+	WinRate float64 `json:"win_rate"` // Share of the matches won by A
+}
+
+// Standing is the overall record of a bot in the tournament
+type Standing struct {
+	Bot     string  `json:"bot"`
+	Played  int     `json:"played"`
+	Won     int     `json:"won"`
+	Drawn   int     `json:"drawn"`
+	Lost    int     `json:"lost"`
+	Points  int     `json:"points"` // 3 per win, 1 per draw
+	WinRate float64 `json:"win_rate"`
+}
+
+// Report is the outcome of a tournament
+type Report struct {
+	Variant    string     `json:"variant"`
+	Format     string     `json:"format"`
+	Matches    int        `json:"matches_per_pair"`
+	Standings  []Standing `json:"standings"`
+	HeadToHead []Pairing  `json:"head_to_head"`
+}
+
+// PlayMatch plays a match between two strategies with the same round scoring and match format
+// as live sessions
+func PlayMatch(rs rules.Ruleset, format match.Format, a, b bot.Strategy, maxRounds int) (MatchResult, error) {
+	if maxRounds <= 0 {
+		maxRounds = DefaultMaxRounds
+	}
+	var result MatchResult
+	var movesA, movesB []string
+	scores := make([]int, 2)
+	for result.Rounds < maxRounds {
+		round := result.Rounds + 1
+		moves := []string{
+			a.Next(bot.History{Round: round, Ruleset: rs, Own: movesA, Opponent: movesB}),
+			b.Next(bot.History{Round: round, Ruleset: rs, Own: movesB, Opponent: movesA}),
+		}
+		score, err := match.ScoreRound(rs, moves)
+		if err != nil {
+			return result, fmt.Errorf("%s vs %s: %w", a.Name(), b.Name(), err)
+		}
+		movesA, movesB = append(movesA, moves[0]), append(movesB, moves[1])
+		result.Rounds = round
+		if score.Winner != match.NoWinner {
+			result.Wins[score.Winner]++
+		}
+		for i := range scores {
+			scores[i] += score.Points[i]
+		}
+
+		if finished, winner := format.Decide(scores, round); finished {
+			result.Winner = winner
+			return result, nil
+		}
+	}
+	result.Winner = match.NoWinner
+	return result, nil
+}
+
+// Run plays every pair of bots against each other cfg.Matches times and returns the standings,
+// best bot first, and the head-to-head records
+func Run(cfg Config) (*Report, error) {
+	if len(cfg.Bots) < 2 {
+		return nil, fmt.Errorf("a tournament needs at least two bots")
+	}
+	if cfg.Matches < 1 {
+		return nil, fmt.Errorf("each pair must play at least one match")
+	}
+	for _, spec := range cfg.Bots {
+		if _, err := bot.New(spec, nil); err != nil {
+			return nil, err
+		}
+	}
+	format := cfg.Format.Normalize()
+	if err := format.Validate(); err != nil {
+		return nil, err
+	}
+
+	var pairings []Pairing
+	for i := range cfg.Bots {
+		for j := i + 1; j < len(cfg.Bots); j++ {
+			pairings = append(pairings, Pairing{A: cfg.Bots[i], B: cfg.Bots[j]})
+		}
+	}
+
+	workers := cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	errs := make([]error, len(pairings))
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				errs[p] = playPairing(cfg, format, int64(p), &pairings[p])
+			}
+		}()
+	}
+	for p := range pairings {
+		jobs <- p
+	}
+	close(jobs)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Report{
+		Variant:    cfg.Ruleset.Name(),
+		Format:     format.String(),
+		Matches:    cfg.Matches,
+		Standings:  standings(cfg.Bots, pairings),
+		HeadToHead: pairings,
+	}, nil
+}
+
+// playPairing plays the matches of a pair of bots. Each pair gets its own random source derived
+// from the seed, so results do not depend on the scheduling of the workers.
+func playPairing(cfg Config, format match.Format, index int64, p *Pairing) error {
+	rng := rand.New(rand.NewSource(cfg.Seed + index))
+	for m := 0; m < cfg.Matches; m++ {
+		// Fresh strategies for every match, as bots only learn within a session
+		a, err := bot.New(p.A, rand.New(rand.NewSource(rng.Int63())))
+		if err != nil {
+			return err
+		}
+		b, err := bot.New(p.B, rand.New(rand.NewSource(rng.Int63())))
+		if err != nil {
+			return err
+		}
+		result, err := PlayMatch(cfg.Ruleset, format, a, b, cfg.MaxRounds)
+		if err != nil {
+			return err
+		}
+		p.Matches++
+		p.Rounds += result.Rounds
+		switch result.Winner {
+		case 0:
+			p.WinsA++
+		case 1:
+			p.WinsB++
+		default:
+			p.Draws++
+		}
+	}
+	p.WinRate = float64(p.WinsA) / float64(p.Matches)
+	return nil
+}
+
+// standings aggregates the head-to-head records per bot, sorted by points then win rate
+func standings(bots []string, pairings []Pairing) []Standing {
+	byBot := make(map[string]*Standing, len(bots))
+	table := make([]Standing, len(bots))
+	for i, spec := range bots {
+		table[i].Bot = spec
+		byBot[spec] = &table[i]
+	}
+	for _, p := range pairings {
+		a, b := byBot[p.A], byBot[p.B]
+		a.Played += p.Matches
+		b.Played += p.Matches
+		a.Won += p.WinsA
+		a.Lost += p.WinsB
+		b.Won += p.WinsB
+		b.Lost += p.WinsA
+		a.Drawn += p.Draws
+		b.Drawn += p.Draws
+	}
+	for i := range table {
+		s := &table[i]
+		s.Points = 3*s.Won + s.Drawn
+		if s.Played > 0 {
+			s.WinRate = float64(s.Won) / float64(s.Played)
+		}
+	}
+	sort.SliceStable(table, func(i, j int) bool {
+		if table[i].Points != table[j].Points {
+			return table[i].Points > table[j].Points
+		}
+		return table[i].WinRate > table[j].WinRate
+	})
+	return table
+}
+
+// WinRate returns the share of the matches between a and b won by a, and whether they met
+func (r *Report) WinRate(a, b string) (float64, bool) {
+	for _, p := range r.HeadToHead {
+		switch {
+		case p.A == a && p.B == b:
+			return p.WinRate, true
+		case p.A == b && p.B == a:
+			return float64(p.WinsB) / float64(p.Matches), true
+		}
+	}
+	return 0, false
+}
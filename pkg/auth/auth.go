@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultTTL is how long a player token is accepted after it is issued, unless AUTH_TOKEN_TTL says otherwise
+const DefaultTTL = 24 * time.Hour
+
+// MaxClockSkew is how far in the future the issue time of a token can be, for services whose clocks drift apart
+const MaxClockSkew = time.Minute
+
+// Signing algorithms of the player tokens
+const (
+	HMAC    = "hmac"    // HMAC-SHA256 with a shared secret
+	Ed25519 = "ed25519" // Ed25519, services that only verify tokens need the public key alone
+)
+
+var (
+	// ErrInvalidToken is returned for a token that is malformed or not signed with the configured key
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpiredToken is returned for a token issued longer ago than the TTL of the keys
+	ErrExpiredToken = errors.New("token has expired")
+	// ErrWrongPlayer is returned for a valid token issued for another session or player
+	ErrWrongPlayer = errors.New("token was issued for another player")
+	// ErrCannotSign is returned when issuing a token with a verify-only Ed25519 key
+	ErrCannotSign = errors.New("no private key to sign tokens")
+)
+
+// Claims are the contents of a player token
+type Claims struct {
+	SessionID string `json:"sid"`
+	PlayerID  string `json:"pid"`
+	AccountID string `json:"aid,omitempty"` // Account of the player, empty for anonymous players
+	IssuedAt  int64  `json:"iat"`           // Unix time the token was issued at, it expires after the TTL of the keys
+}
+
+// Keys issue and verify player tokens. A token is "<payload>.<signature>", both base64url encoded,
+// where the payload is the JSON encoding of the Claims.
+type Keys struct {
+	alg     string
+	ttl     time.Duration
+	secret  []byte
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+// NewHMAC returns keys signing tokens with HMAC-SHA256
+func NewHMAC(secret []byte) (*Keys, error) {
+	if len(secret) < 16 {
+		return nil, fmt.Errorf("HMAC secret must be at least 16 bytes")
+	}
+	return &Keys{alg: HMAC, ttl: DefaultTTL, secret: secret}, nil
+}
+
+// NewEd25519 returns keys signing tokens with Ed25519. private may be nil for keys that only verify tokens.
+func NewEd25519(private ed25519.PrivateKey, public ed25519.PublicKey) (*Keys, error) {
+	if public == nil && private != nil {
+		public = private.Public().(ed25519.PublicKey)
+	}
+	if len(public) != ed25519.PublicKeySize || (private != nil && len(private) != ed25519.PrivateKeySize) {
+		return nil, fmt.Errorf("invalid Ed25519 key")
+	}
+	return &Keys{alg: Ed25519, ttl: DefaultTTL, private: private, public: public}, nil
+}
+
+// FromEnv returns the keys configured by the environment, or nil when player tokens are disabled:
+//   - AUTH_ALG: hmac (default) or ed25519
+//   - AUTH_KEY: the HMAC secret, or the base64-encoded Ed25519 private key seed
+//   - AUTH_PUBLIC_KEY: the base64-encoded Ed25519 public key, for services that only verify tokens
+//   - AUTH_TOKEN_TTL: how long a token is accepted, e.g. 12h (DefaultTTL when unset)
+func FromEnv() (*Keys, error) {
+	keys, err := keysFromEnv()
+	if keys == nil || err != nil {
+		return keys, err
+	}
+	if ttl := os.Getenv("AUTH_TOKEN_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("AUTH_TOKEN_TTL must be a positive duration, e.g. 12h")
+		}
+		keys.ttl = d
+	}
+	return keys, nil
+}
+
+// keysFromEnv returns the keys of AUTH_ALG, AUTH_KEY and AUTH_PUBLIC_KEY, see FromEnv
+func keysFromEnv() (*Keys, error) {
+	key, publicKey := os.Getenv("AUTH_KEY"), os.Getenv("AUTH_PUBLIC_KEY")
+	switch alg := os.Getenv("AUTH_ALG"); alg {
+	case "", HMAC:
+		if key == "" {
+			return nil, nil
+		}
+		return NewHMAC([]byte(key))
+	case Ed25519:
+		var private ed25519.PrivateKey
+		var public ed25519.PublicKey
+		if key != "" {
+			seed, err := base64.StdEncoding.DecodeString(key)
+			if err != nil || len(seed) != ed25519.SeedSize {
+				return nil, fmt.Errorf("AUTH_KEY must be a base64-encoded %d-byte Ed25519 seed", ed25519.SeedSize)
+			}
+			private = ed25519.NewKeyFromSeed(seed)
+		}
+		if publicKey != "" {
+			decoded, err := base64.StdEncoding.DecodeString(publicKey)
+			if err != nil {
+				return nil, fmt.Errorf("AUTH_PUBLIC_KEY must be base64-encoded: %w", err)
+			}
+			public = decoded
+		}
+		if private == nil && public == nil {
+			return nil, nil
+		}
+		return NewEd25519(private, public)
+	default:
+		return nil, fmt.Errorf("unknown AUTH_ALG %q, expected %s or %s", alg, HMAC, Ed25519)
+	}
+}
+
+// CanSign returns whether the keys can issue tokens, which verify-only Ed25519 keys cannot
+func (k *Keys) CanSign() bool {
+	return k.alg == HMAC || k.private != nil
+}
+
+// Issue returns a token carrying the claims, bound to their session and player
+func (k *Keys) Issue(claims Claims, now time.Time) (string, error) {
+	claims.IssuedAt = now.Unix()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signature, err := k.sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify checks that a token was signed with the keys, has not expired by now, and was issued for the
+// session and player, and returns its claims
+func (k *Keys) Verify(token, sessionID, playerID string, now time.Time) (Claims, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return Claims{}, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !k.verify(payload, signature) {
+		return Claims{}, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	issued := time.Unix(claims.IssuedAt, 0)
+	if now.Sub(issued) > k.ttl || issued.After(now.Add(MaxClockSkew)) {
+		return Claims{}, ErrExpiredToken
+	}
+	if claims.SessionID != sessionID || claims.PlayerID != playerID {
+		return Claims{}, ErrWrongPlayer
+	}
+	return claims, nil
+}
+
+func (k *Keys) sign(payload []byte) ([]byte, error) {
+	if k.alg == HMAC {
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(payload)
+		return mac.Sum(nil), nil
+	}
+	if k.private == nil {
+		return nil, ErrCannotSign
+	}
+	return ed25519.Sign(k.private, payload), nil
+}
+
+func (k *Keys) verify(payload, signature []byte) bool {
+	if k.alg == HMAC {
+		expected, _ := k.sign(payload)
+		return hmac.Equal(signature, expected)
+	}
+	return ed25519.Verify(k.public, payload, signature)
+}
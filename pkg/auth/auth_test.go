@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+var seed = []byte("0123456789abcdef0123456789abcdef")
+
+func hmacKeys(t *testing.T, secret string) *Keys {
+	t.Helper()
+	keys, err := NewHMAC([]byte(secret))
+	if err != nil {
+		t.Fatalf("NewHMAC() error = %v", err)
+	}
+	return keys
+}
+
+func ed25519Keys(t *testing.T, private ed25519.PrivateKey, public ed25519.PublicKey) *Keys {
+	t.Helper()
+	keys, err := NewEd25519(private, public)
+	if err != nil {
+		t.Fatalf("NewEd25519() error = %v", err)
+	}
+	return keys
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	private := ed25519.NewKeyFromSeed(seed)
+	modes := []struct {
+		name   string
+		issuer *Keys
+		// verifier only holds what a service verifying tokens is configured with
+		verifier *Keys
+	}{
+		{name: HMAC, issuer: hmacKeys(t, "a-secret-of-16-bytes"), verifier: hmacKeys(t, "a-secret-of-16-bytes")},
+		{name: Ed25519, issuer: ed25519Keys(t, private, nil), verifier: ed25519Keys(t, nil, private.Public().(ed25519.PublicKey))},
+	}
+	for _, m := range modes {
+		t.Run(m.name, func(t *testing.T) {
+			token, err := m.issuer.Issue(Claims{SessionID: "session-1", PlayerID: "2", AccountID: "alice"}, t0)
+			if err != nil {
+				t.Fatalf("Issue() error = %v", err)
+			}
+			claims, err := m.verifier.Verify(token, "session-1", "2", t0.Add(time.Hour))
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.AccountID != "alice" || claims.IssuedAt != t0.Unix() {
+				t.Errorf("claims = %+v, want account alice issued at %d", claims, t0.Unix())
+			}
+			if _, err := m.verifier.Verify(token, "session-1", "1", t0); !errors.Is(err, ErrWrongPlayer) {
+				t.Errorf("Verify() for another player error = %v, want %v", err, ErrWrongPlayer)
+			}
+			if _, err := m.verifier.Verify(token, "session-2", "2", t0); !errors.Is(err, ErrWrongPlayer) {
+				t.Errorf("Verify() for another session error = %v, want %v", err, ErrWrongPlayer)
+			}
+		})
+	}
+}
+
+func TestVerifyOnly(t *testing.T) {
+	public := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+	keys := ed25519Keys(t, nil, public)
+	if _, err := keys.Issue(Claims{SessionID: "session-1", PlayerID: "1"}, t0); !errors.Is(err, ErrCannotSign) {
+		t.Errorf("Issue() with a public key only error = %v, want %v", err, ErrCannotSign)
+	}
+	if keys.CanSign() {
+		t.Errorf("CanSign() = true for a public key only")
+	}
+	if !ed25519Keys(t, ed25519.NewKeyFromSeed(seed), nil).CanSign() || !hmacKeys(t, "a-secret-of-16-bytes").CanSign() {
+		t.Errorf("CanSign() = false for a private key or an HMAC secret")
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	keys := hmacKeys(t, "a-secret-of-16-bytes")
+	token, err := keys.Issue(Claims{SessionID: "session-1", PlayerID: "1"}, t0)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	payload, signature, _ := strings.Cut(token, ".")
+
+	// The same claims for player 2, under the signature issued for player 1
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"sid":"session-1","pid":"2","iat":` + payloadIssuedAt(t, payload) + `}`))
+	otherKey, _ := hmacKeys(t, "another-secret-of-16-bytes").Issue(Claims{SessionID: "session-1", PlayerID: "1"}, t0)
+	ed25519Token, _ := ed25519Keys(t, ed25519.NewKeyFromSeed(seed), nil).Issue(Claims{SessionID: "session-1", PlayerID: "1"}, t0)
+
+	tokens := map[string]string{
+		"forged payload":        forged + "." + signature,
+		"truncated signature":   payload + "." + signature[:len(signature)-2],
+		"no signature":          payload,
+		"not base64":            payload + ".!!!",
+		"signed with other key": otherKey,
+		"signed with ed25519":   ed25519Token,
+		"empty":                 "",
+	}
+	for name, tampered := range tokens {
+		if _, err := keys.Verify(tampered, "session-1", "1", t0); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: Verify() error = %v, want %v", name, err, ErrInvalidToken)
+		}
+	}
+}
+
+// payloadIssuedAt returns the issue time of an encoded payload, as it appears in its JSON
+func payloadIssuedAt(t *testing.T, payload string) string {
+	t.Helper()
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, iat, _ := strings.Cut(string(decoded), `"iat":`)
+	return strings.TrimSuffix(iat, "}")
+}
+
+func TestVerifyExpiry(t *testing.T) {
+	keys := hmacKeys(t, "a-secret-of-16-bytes")
+	keys.ttl = time.Hour
+	token, err := keys.Issue(Claims{SessionID: "session-1", PlayerID: "1"}, t0)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	tests := []struct {
+		name    string
+		now     time.Time
+		wantErr error
+	}{
+		{name: "just issued", now: t0},
+		{name: "at the end of the TTL", now: t0.Add(time.Hour)},
+		{name: "past the TTL", now: t0.Add(time.Hour + time.Second), wantErr: ErrExpiredToken},
+		{name: "within the clock skew", now: t0.Add(-MaxClockSkew)},
+		{name: "issued in the future", now: t0.Add(-MaxClockSkew - time.Second), wantErr: ErrExpiredToken},
+	}
+	for _, tt := range tests {
+		if _, err := keys.Verify(token, "session-1", "1", tt.now); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Verify() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	encodedSeed := base64.StdEncoding.EncodeToString(seed)
+	encodedPublic := base64.StdEncoding.EncodeToString(ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey))
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantNil  bool
+		wantAlg  string
+		wantSign bool
+		wantTTL  time.Duration
+		wantErr  bool
+	}{
+		{name: "tokens disabled", wantNil: true},
+		{name: "hmac", env: map[string]string{"AUTH_KEY": "a-secret-of-16-bytes"}, wantAlg: HMAC, wantSign: true, wantTTL: DefaultTTL},
+		{name: "short hmac secret", env: map[string]string{"AUTH_KEY": "short"}, wantErr: true},
+		{name: "ed25519 seed", env: map[string]string{"AUTH_ALG": Ed25519, "AUTH_KEY": encodedSeed}, wantAlg: Ed25519, wantSign: true, wantTTL: DefaultTTL},
+		{name: "ed25519 public key", env: map[string]string{"AUTH_ALG": Ed25519, "AUTH_PUBLIC_KEY": encodedPublic}, wantAlg: Ed25519, wantTTL: DefaultTTL},
+		{name: "ed25519 bad seed", env: map[string]string{"AUTH_ALG": Ed25519, "AUTH_KEY": "c2hvcnQ="}, wantErr: true},
+		{name: "unknown algorithm", env: map[string]string{"AUTH_ALG": "rsa", "AUTH_KEY": "a-secret-of-16-bytes"}, wantErr: true},
+		{name: "ttl", env: map[string]string{"AUTH_KEY": "a-secret-of-16-bytes", "AUTH_TOKEN_TTL": "2h"}, wantAlg: HMAC, wantSign: true, wantTTL: 2 * time.Hour},
+		{name: "bad ttl", env: map[string]string{"AUTH_KEY": "a-secret-of-16-bytes", "AUTH_TOKEN_TTL": "-1h"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"AUTH_ALG", "AUTH_KEY", "AUTH_PUBLIC_KEY", "AUTH_TOKEN_TTL"} {
+				t.Setenv(name, tt.env[name])
+			}
+			keys, err := FromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("FromEnv(): want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FromEnv() error = %v", err)
+			}
+			if tt.wantNil {
+				if keys != nil {
+					t.Fatalf("FromEnv() = %+v, want tokens disabled", keys)
+				}
+				return
+			}
+			_, err = keys.Issue(Claims{SessionID: "session-1", PlayerID: "1"}, t0)
+			if keys.alg != tt.wantAlg || (err == nil) != tt.wantSign || keys.ttl != tt.wantTTL {
+				t.Errorf("FromEnv() = %s keys signing %v with a TTL of %s, want %s signing %v with %s",
+					keys.alg, err == nil, keys.ttl, tt.wantAlg, tt.wantSign, tt.wantTTL)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"shifumi-game/pkg/rules"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Prefix marks a bot opponent in the session options, e.g. "bot:markov:2"
+const Prefix = "bot:"
+
+// ErrUnknownStrategy is returned when no strategy matches a bot spec
+var ErrUnknownStrategy = errors.New("unknown bot strategy")
+
+// History is what a strategy knows about a session when picking its next move:
+// the ruleset and the moves of the previous rounds, oldest first
+type History struct {
+	SessionID string
+	Round     int // Round the move is picked for
+	Ruleset   rules.Ruleset
+	Own       []string
+	Opponent  []string
+}
+
+// Strategy picks the move of a bot for the next round
+type Strategy interface {
+	// Name returns the spec of the strategy, e.g. "markov:2"
+	Name() string
+	// Next returns the move to play given the history of the session
+	Next(h History) string
+}
+
+// factory builds a strategy from its optional parameter
+type factory func(param string, rng *rand.Rand) (Strategy, error)
+
+var strategies = map[string]factory{
+	"random": func(param string, rng *rand.Rand) (Strategy, error) {
+		return &uniform{rng: rng}, noParam("random", param)
+	},
+	"frequency": func(param string, rng *rand.Rand) (Strategy, error) {
+		return &frequency{rng: rng}, noParam("frequency", param)
+	},
+	"beat-last": func(param string, rng *rand.Rand) (Strategy, error) {
+		return &beatLast{rng: rng}, noParam("beat-last", param)
+	},
+	"markov": func(param string, rng *rand.Rand) (Strategy, error) {
+		k := 1
+		if param != "" {
+			var err error
+			if k, err = strconv.Atoi(param); err != nil || k < 1 || k > 5 {
+				return nil, fmt.Errorf("markov: order must be between 1 and 5, got %q", param)
+			}
+		}
+		return &markov{k: k, rng: rng}, nil
+	},
+}
+
+// New builds the strategy described by spec, "<strategy>[:<param>]" with an optional "bot:" prefix.
+// Names that are not built-in strategies are looked up in the registered external bots.
+// A nil rng uses a randomly seeded source.
+func New(spec string, rng *rand.Rand) (Strategy, error) {
+	if rng == nil {
+		rng = rand.New(rand.NewSource(rand.Int63()))
+	}
+	name, param, _ := strings.Cut(strings.TrimPrefix(spec, Prefix), ":")
+	if newStrategy, ok := strategies[name]; ok {
+		return newStrategy(param, rng)
+	}
+	if reg, ok := lookupRemote(name); ok {
+		return newRemote(reg, rng), noParam(name, param)
+	}
+	return nil, fmt.Errorf("%w: %s (available: %s)", ErrUnknownStrategy, spec, strings.Join(Names(), ", "))
+}
+
+// Names returns the names of the built-in strategies and registered external bots, sorted alphabetically
+func Names() []string {
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	for _, reg := range Registered() {
+		names = append(names, reg.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsBot reports whether a session opponent is a bot
+func IsBot(opponent string) bool {
+	return strings.HasPrefix(opponent, Prefix)
+}
+
+func noParam(name, param string) error {
+	if param != "" {
+		return fmt.Errorf("%s: unexpected parameter %q", name, param)
+	}
+	return nil
+}
+
+// counter returns a move that beats move, picked at random when several do
+func counter(rs rules.Ruleset, move string, rng *rand.Rand) string {
+	var winners []string
+	for _, candidate := range rs.Moves() {
+		if outcome, err := rs.Outcome(candidate, move); err == nil && outcome == rules.Win {
+			winners = append(winners, candidate)
+		}
+	}
+	if len(winners) == 0 {
+		return randomMove(rs, rng)
+	}
+	return winners[rng.Intn(len(winners))]
+}
+
+// randomMove returns a move of the ruleset picked uniformly at random
+func randomMove(rs rules.Ruleset, rng *rand.Rand) string {
+	moves := rs.Moves()
+	return moves[rng.Intn(len(moves))]
+}
+
+// mostFrequent returns the most frequent move of counts, breaking ties at random
+func mostFrequent(counts map[string]int, rng *rand.Rand) (string, bool) {
+	best, top := 0, []string(nil)
+	for move, count := range counts {
+		switch {
+		case count > best:
+			best, top = count, []string{move}
+		case count == best:
+			top = append(top, move)
+		}
+	}
+	if len(top) == 0 {
+		return "", false
+	}
+	sort.Strings(top) // Map iteration order must not leak into seeded games
+	return top[rng.Intn(len(top))], true
+}
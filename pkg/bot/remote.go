@@ -0,0 +1,180 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultRemoteTimeout is how long the game-logic service waits for an external bot to answer
+const DefaultRemoteTimeout = 2 * time.Second
+
+// Registration describes an external bot reachable over HTTP. Sessions play against it with
+// the opponent "bot:<name>".
+type Registration struct {
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Token     string `json:"token,omitempty"`      // Sent as a bearer token so the bot can authenticate the game
+	TimeoutMs int    `json:"timeout_ms,omitempty"` // DefaultRemoteTimeout when 0
+	Fallback  string `json:"fallback,omitempty"`   // Played when the bot fails or times out, random when empty
+}
+
+// Validate checks that the registration can be used
+func (r Registration) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("bot name is required")
+	}
+	if _, ok := strategies[r.Name]; ok {
+		return fmt.Errorf("bot name %s is reserved for a built-in strategy", r.Name)
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("bot %s: invalid URL %q", r.Name, r.URL)
+	}
+	if r.TimeoutMs < 0 {
+		return fmt.Errorf("bot %s: timeout cannot be negative", r.Name)
+	}
+	return nil
+}
+
+// Redacted returns the registration without its credentials
+func (r Registration) Redacted() Registration {
+	if r.Token != "" {
+		r.Token = "********"
+	}
+	return r
+}
+
+var (
+	remoteMu sync.RWMutex
+	remotes  = map[string]Registration{}
+)
+
+// Register makes an external bot available, replacing any previous registration with the same name
+func Register(reg Registration) error {
+	if err := reg.Validate(); err != nil {
+		return err
+	}
+	remoteMu.Lock()
+	defer remoteMu.Unlock()
+	remotes[reg.Name] = reg
+	return nil
+}
+
+// Unregister removes an external bot
+func Unregister(name string) {
+	remoteMu.Lock()
+	defer remoteMu.Unlock()
+	delete(remotes, name)
+}
+
+// Registered returns the registered external bots, sorted by name
+func Registered() []Registration {
+	remoteMu.RLock()
+	defer remoteMu.RUnlock()
+	regs := make([]Registration, 0, len(remotes))
+	for _, reg := range remotes {
+		regs = append(regs, reg)
+	}
+	sort.Slice(regs, func(i, j int) bool { return regs[i].Name < regs[j].Name })
+	return regs
+}
+
+func lookupRemote(name string) (Registration, bool) {
+	remoteMu.RLock()
+	defer remoteMu.RUnlock()
+	reg, ok := remotes[name]
+	return reg, ok
+}
+
+// MoveRequest is the body posted to an external bot
+type MoveRequest struct {
+	SessionID string   `json:"session_id"`
+	Round     int      `json:"round"`
+	Variant   string   `json:"variant"`
+	Moves     []string `json:"moves"`
+	Own       []string `json:"own"`
+	Opponent  []string `json:"opponent"`
+}
+
+// MoveResponse is the body an external bot answers with
+type MoveResponse struct {
+	Move string `json:"move"`
+}
+
+// remote asks an external bot for its move over HTTP
+type remote struct {
+	reg    Registration
+	client *http.Client
+	rng    *rand.Rand
+}
+
+func newRemote(reg Registration, rng *rand.Rand) *remote {
+	timeout := DefaultRemoteTimeout
+	if reg.TimeoutMs > 0 {
+		timeout = time.Duration(reg.TimeoutMs) * time.Millisecond
+	}
+	return &remote{reg: reg, client: &http.Client{Timeout: timeout}, rng: rng}
+}
+
+func (s *remote) Name() string {
+	return s.reg.Name
+}
+
+func (s *remote) Next(h History) string {
+	move, err := s.ask(h)
+	if err == nil && h.Ruleset.IsValid(move) {
+		return move
+	}
+	if err == nil {
+		err = fmt.Errorf("invalid move %q", move)
+	}
+	log.Printf("[ERROR] External bot %s failed, playing fallback move | SessionID: %s | Error: %v", s.reg.Name, h.SessionID, err)
+	if h.Ruleset.IsValid(s.reg.Fallback) {
+		return s.reg.Fallback
+	}
+	return randomMove(h.Ruleset, s.rng)
+}
+
+func (s *remote) ask(h History) (string, error) {
+	body, err := json.Marshal(MoveRequest{
+		SessionID: h.SessionID,
+		Round:     h.Round,
+		Variant:   h.Ruleset.Name(),
+		Moves:     h.Ruleset.Moves(),
+		Own:       h.Own,
+		Opponent:  h.Opponent,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.reg.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.reg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.reg.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var answer MoveResponse
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return "", err
+	}
+	return answer.Move, nil
+}
@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"shifumi-game/pkg/rules"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowAnswer is how long a bot that times out takes to answer, far beyond the timeout of the tests
+const slowAnswer = 5 * time.Second
+
+// botHandler serves the requests of an external bot. release is closed when the test ends.
+type botHandler func(w http.ResponseWriter, r *http.Request, release <-chan struct{})
+
+// registerBot registers an external bot served by handler for the duration of a test
+func registerBot(t *testing.T, reg Registration, handler botHandler) Strategy {
+	t.Helper()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, release)
+	}))
+	t.Cleanup(func() {
+		close(release)
+		server.Close()
+	})
+
+	reg.Name, reg.URL = "test-bot", server.URL
+	if err := Register(reg); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	t.Cleanup(func() { Unregister(reg.Name) })
+
+	s, err := New(Prefix+reg.Name, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return s
+}
+
+func answer(move string) botHandler {
+	return func(w http.ResponseWriter, r *http.Request, release <-chan struct{}) {
+		json.NewEncoder(w).Encode(MoveResponse{Move: move})
+	}
+}
+
+func TestRemoteMove(t *testing.T) {
+	var got MoveRequest
+	var auth string
+	s := registerBot(t, Registration{Token: "secret", Fallback: "rock"}, func(w http.ResponseWriter, r *http.Request, release <-chan struct{}) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding the request: %v", err)
+		}
+		answer("scissors")(w, r, release)
+	})
+
+	h := History{SessionID: "session-1", Round: 3, Ruleset: rules.Classic(), Own: []string{"rock", "paper"}, Opponent: []string{"paper", "paper"}}
+	if move := s.Next(h); move != "scissors" {
+		t.Errorf("Next() = %q, want the move of the bot", move)
+	}
+	want := MoveRequest{SessionID: "session-1", Round: 3, Variant: "classic", Moves: rules.Classic().Moves(), Own: h.Own, Opponent: h.Opponent}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("request = %+v, want %+v", got, want)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("Authorization = %q, want the bearer token", auth)
+	}
+}
+
+func TestRemoteFallback(t *testing.T) {
+	slow := func(w http.ResponseWriter, r *http.Request, release <-chan struct{}) {
+		select {
+		case <-time.After(slowAnswer):
+		case <-release:
+		}
+		answer("scissors")(w, r, release)
+	}
+
+	tests := []struct {
+		name     string
+		fallback string
+		handler  botHandler
+		want     string // Empty for a random move
+	}{
+		{name: "timeout", fallback: "paper", handler: slow, want: "paper"},
+		{name: "timeout without a fallback", handler: slow},
+		{name: "error status", fallback: "paper", handler: func(w http.ResponseWriter, r *http.Request, release <-chan struct{}) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}, want: "paper"},
+		{name: "invalid move", fallback: "paper", handler: answer("lizard"), want: "paper"},
+		{name: "malformed answer", fallback: "paper", handler: func(w http.ResponseWriter, r *http.Request, release <-chan struct{}) {
+			w.Write([]byte("scissors"))
+		}, want: "paper"},
+		{name: "fallback not in the ruleset", fallback: "lizard", handler: answer("")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := registerBot(t, Registration{TimeoutMs: 50, Fallback: tt.fallback}, tt.handler)
+
+			start := time.Now()
+			move := s.Next(History{SessionID: "session-1", Round: 1, Ruleset: rules.Classic()})
+			if elapsed := time.Since(start); elapsed >= slowAnswer {
+				t.Errorf("Next() took %s, want the bot timeout applied", elapsed)
+			}
+			if tt.want != "" && move != tt.want {
+				t.Errorf("Next() = %q, want the fallback %q", move, tt.want)
+			}
+			if !rules.Classic().IsValid(move) {
+				t.Errorf("Next() = %q, want a valid move", move)
+			}
+		})
+	}
+}
+
+func TestRegistrationValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		reg     Registration
+		wantErr string
+	}{
+		{name: "valid", reg: Registration{Name: "remote", URL: "https://bots.example.com/move"}},
+		{name: "no name", reg: Registration{URL: "https://bots.example.com/move"}, wantErr: "name is required"},
+		{name: "built-in name", reg: Registration{Name: "markov", URL: "https://bots.example.com/move"}, wantErr: "reserved"},
+		{name: "not http", reg: Registration{Name: "remote", URL: "ftp://bots.example.com"}, wantErr: "invalid URL"},
+		{name: "negative timeout", reg: Registration{Name: "remote", URL: "http://bots:8080", TimeoutMs: -1}, wantErr: "cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.reg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
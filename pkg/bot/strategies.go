@@ -0,0 +1,88 @@
+package bot
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// uniform plays every move with the same probability
+type uniform struct {
+	rng *rand.Rand
+}
+
+func (s *uniform) Name() string {
+	return "random"
+}
+
+func (s *uniform) Next(h History) string {
+	return randomMove(h.Ruleset, s.rng)
+}
+
+// frequency counters the move the opponent played the most
+type frequency struct {
+	rng *rand.Rand
+}
+
+func (s *frequency) Name() string {
+	return "frequency"
+}
+
+func (s *frequency) Next(h History) string {
+	counts := map[string]int{}
+	for _, move := range h.Opponent {
+		counts[move]++
+	}
+	predicted, ok := mostFrequent(counts, s.rng)
+	if !ok {
+		return randomMove(h.Ruleset, s.rng)
+	}
+	return counter(h.Ruleset, predicted, s.rng)
+}
+
+// beatLast counters the last move of the opponent
+type beatLast struct {
+	rng *rand.Rand
+}
+
+func (s *beatLast) Name() string {
+	return "beat-last"
+}
+
+func (s *beatLast) Next(h History) string {
+	if len(h.Opponent) == 0 {
+		return randomMove(h.Ruleset, s.rng)
+	}
+	return counter(h.Ruleset, h.Opponent[len(h.Opponent)-1], s.rng)
+}
+
+// markov predicts the next move of the opponent from what followed their last k moves
+// earlier in the session, and counters it
+type markov struct {
+	k   int
+	rng *rand.Rand
+}
+
+func (s *markov) Name() string {
+	return "markov:" + strconv.Itoa(s.k)
+}
+
+func (s *markov) Next(h History) string {
+	moves := h.Opponent
+	if len(moves) <= s.k {
+		return randomMove(h.Ruleset, s.rng)
+	}
+
+	state := strings.Join(moves[len(moves)-s.k:], ",")
+	counts := map[string]int{}
+	for i := s.k; i < len(moves); i++ {
+		if strings.Join(moves[i-s.k:i], ",") == state {
+			counts[moves[i]]++
+		}
+	}
+	predicted, ok := mostFrequent(counts, s.rng)
+	if !ok {
+		return randomMove(h.Ruleset, s.rng)
+	}
+	return counter(h.Ruleset, predicted, s.rng)
+}
@@ -0,0 +1,361 @@
+package engine
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"shifumi-game/pkg/bot"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/rules"
+	"time"
+)
+
+// Move is a command applied to a session: a player move (choice, commit or reveal), a seat taken
+// without moving, a pause, resume or cancellation, or a missed round deadline
+type Move struct {
+	Type       string    `json:"type"` // One of the models.Message* types
+	PlayerID   string    `json:"player_id,omitempty"`
+	AccountID  string    `json:"account_id,omitempty"`  // Account of a player taking a seat
+	InviteHash string    `json:"invite_hash,omitempty"` // Hash of the invite code of a player taking a seat in a private session, see models.InviteHash
+	Choice     string    `json:"choice,omitempty"`      // Choice and reveal
+	Salt       string    `json:"salt,omitempty"`        // Reveal
+	Commitment string    `json:"commitment,omitempty"`  // Commit
+	Round      int       `json:"round,omitempty"`       // Timeout: the round and phase the deadline was set for
+	Phase      string    `json:"phase,omitempty"`
+	Deadline   time.Time `json:"deadline,omitempty"`
+	At         time.Time `json:"at"`                  // When the move is applied, used for the round deadlines
+	Offset     *int64    `json:"offset,omitempty"`    // Offset of the player message in its partition of the player-choices topic, nil when not read from it
+	Partition  int       `json:"partition,omitempty"` // Partition of the player-choices topic the player message was read from
+}
+
+// reject returns the MoveError of a command
+func reject(move Move, reason error, detail string, args ...interface{}) error {
+	return &MoveError{Command: move.Type, PlayerID: move.PlayerID, Reason: reason, Detail: fmt.Sprintf(detail, args...)}
+}
+
+// New creates a session from the options picked by Player 1, who plays with the given account (empty
+// for an anonymous player). Sessions that are full from the start (against a bot) start their first
+// round right away.
+func New(sessionID string, opts models.SessionOptions, accountID string, at time.Time) (*models.GameSession, []Event, error) {
+	if opts.Variant == "" {
+		opts.Variant = rules.Default
+	}
+	if err := ValidateOptions(opts); err != nil {
+		return nil, nil, err
+	}
+	session := models.NewGameSession(sessionID, opts)
+	session.Players[0].AccountID = accountID
+	events := []Event{{Type: EventSessionCreated, Round: session.CurrentRound, PlayerID: session.Players[0].ID}}
+	if session.IsFull() {
+		session.StartClock(at)
+		events = append(events, Event{Type: EventRoundStarted, Round: session.CurrentRound})
+	}
+	return session, events, nil
+}
+
+// ValidateOptions checks the options picked by Player 1, including the bot they play against
+func ValidateOptions(opts models.SessionOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if opts.Opponent != "" {
+		if !bot.IsBot(opts.Opponent) {
+			return fmt.Errorf("unknown opponent %q, expected %s<strategy>", opts.Opponent, bot.Prefix)
+		}
+		if _, err := bot.New(opts.Opponent, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply applies a move to a session and returns the updated session with the events describing
+// the changes. The session passed in is never modified. Apply is deterministic: the same session
+// and move always give the same result. Moves that are not allowed return an error wrapping
+// ErrRejected: a *StateError when the status of the session does not accept the command, a
+// *MoveError when the player or the values of the move are not valid.
+func Apply(session *models.GameSession, move Move) (*models.GameSession, []Event, error) {
+	status := session.CurrentStatus()
+	if !Allowed(status, move.Type) {
+		return session, nil, &StateError{Command: move.Type, Status: status}
+	}
+	rs, err := rules.Get(session.Variant)
+	if err != nil {
+		return session, nil, err
+	}
+
+	a := &applier{session: session.Clone(), rs: rs, at: move.At}
+	a.session.Status = status
+	switch move.Type {
+	case models.MessageJoin:
+		_, err = a.seat(move)
+	case models.MessagePause, models.MessageResume, models.MessageCancel:
+		err = a.control(move)
+	case models.MessageTimeout:
+		err = a.timeout(move)
+	default:
+		err = a.move(move)
+	}
+	if err == nil && a.session.Status == models.StatusRoundResolved {
+		// The next round is under way
+		err = a.transition(models.StatusAwaitingMoves)
+	}
+	if err == nil && !a.session.IsOver() && a.session.HaveAllPlayed() {
+		err = a.resolveRound()
+	}
+	if err != nil {
+		return session, nil, err
+	}
+	if move.Offset != nil {
+		a.session.SetNextOffset(move.Partition, *move.Offset+1)
+	}
+	return a.session, a.events, nil
+}
+
+// applier holds the session being updated by a single command
+type applier struct {
+	session *models.GameSession
+	rs      rules.Ruleset
+	at      time.Time
+	events  []Event
+}
+
+func (a *applier) emit(eventType EventType, playerID, detail string) {
+	a.events = append(a.events, Event{Type: eventType, Round: a.session.CurrentRound, PlayerID: playerID, Detail: detail})
+}
+
+// seat gives the next free seat to a joining player, and starts the first round once every seat is taken
+func (a *applier) seat(move Move) (*models.Player, error) {
+	s := a.session
+	if s.Player(move.PlayerID) != nil {
+		return nil, reject(move, ErrAlreadySeated, "")
+	}
+	if s.IsFull() {
+		return nil, reject(move, ErrSessionFull, "%d seats", s.NumPlayers)
+	}
+	if move.PlayerID != s.NextPlayerID() {
+		return nil, reject(move, ErrNotSeated, "next seat is %q", s.NextPlayerID())
+	}
+	if seated := s.PlayerByAccount(move.AccountID); seated != nil {
+		return nil, reject(move, ErrAlreadySeated, "account %s plays as %s", move.AccountID, models.PlayerName(seated.ID))
+	}
+	if !s.Admits(move.AccountID, move.InviteHash) {
+		return nil, reject(move, ErrNotInvited, "a valid invite code or an allowed account is needed to take a seat")
+	}
+	player := s.AddPlayer(move.PlayerID)
+	player.AccountID = move.AccountID
+	a.emit(EventPlayerJoined, player.ID, "")
+	// The clock of the first round starts once every seat is taken
+	if s.IsFull() {
+		if err := a.transition(models.StatusAwaitingMoves); err != nil {
+			return nil, err
+		}
+		s.StartClock(a.at)
+		a.emit(EventRoundStarted, "", "")
+	}
+	return player, nil
+}
+
+// move seats a joining player and records their choice, commit or reveal
+func (a *applier) move(move Move) error {
+	s := a.session
+	player := s.Player(move.PlayerID)
+	if player == nil {
+		var err error
+		if player, err = a.seat(move); err != nil {
+			return err
+		}
+	}
+	if player.Eliminated || player.HasPlayed || player.HasForfeited {
+		return reject(move, ErrCannotPlay, "eliminated: %t, played: %t, forfeited: %t", player.Eliminated, player.HasPlayed, player.HasForfeited)
+	}
+
+	var err error
+	switch move.Type {
+	case models.MessageChoice:
+		err = a.choice(player, move)
+	case models.MessageCommit:
+		err = a.commit(player, move)
+	case models.MessageReveal:
+		err = a.reveal(player, move)
+	default:
+		err = reject(move, ErrInvalidMove, "unknown move type %q", move.Type)
+	}
+	if err != nil {
+		return err
+	}
+	player.MissedRounds = 0
+	return nil
+}
+
+// control pauses, resumes or cancels the session on behalf of a seated player. Pausing stops the
+// round clock, resuming restarts it for a full round timeout.
+func (a *applier) control(move Move) error {
+	s := a.session
+	if s.Player(move.PlayerID) == nil {
+		return reject(move, ErrNotSeated, "")
+	}
+
+	switch move.Type {
+	case models.MessagePause:
+		if err := a.transition(models.StatusPaused); err != nil {
+			return err
+		}
+		s.RoundDeadline = nil
+		a.emit(EventSessionPaused, move.PlayerID, "")
+	case models.MessageResume:
+		if err := a.transition(models.StatusAwaitingMoves); err != nil {
+			return err
+		}
+		s.StartClock(a.at)
+		a.emit(EventSessionResumed, move.PlayerID, "")
+	case models.MessageCancel:
+		if err := a.transition(models.StatusCancelled); err != nil {
+			return err
+		}
+		s.RoundDeadline = nil
+		a.emit(EventSessionCancelled, move.PlayerID, "")
+	}
+	return nil
+}
+
+// choice records a plaintext choice in an open session
+func (a *applier) choice(player *models.Player, move Move) error {
+	if a.session.Mode == models.ModeCommitReveal {
+		return reject(move, ErrWrongMode, "plaintext choice in a commit-reveal session")
+	}
+	if !a.rs.IsValid(move.Choice) {
+		return reject(move, ErrInvalidMove, "%q is not %s", move.Choice, rules.DescribeMoves(a.rs))
+	}
+	a.play(player, move.Choice)
+	a.emit(EventMovePlayed, player.ID, move.Choice)
+	return nil
+}
+
+// commit records the commitment of a player, and opens the reveal phase once every player has committed
+func (a *applier) commit(player *models.Player, move Move) error {
+	s := a.session
+	switch {
+	case s.Mode != models.ModeCommitReveal:
+		return reject(move, ErrWrongMode, "commitment in a %s session", s.Mode)
+	case s.Phase != models.PhaseCommit:
+		return reject(move, ErrWrongPhase, "the round is revealing")
+	case player.HasCommitted:
+		return reject(move, ErrCannotPlay, "already committed this round")
+	case !models.IsValidCommitment(move.Commitment):
+		return reject(move, ErrInvalidMove, "a commitment is the hex-encoded SHA-256 of \"<choice>:<salt>\"")
+	case s.IsCommitmentTaken(player.ID, move.Commitment):
+		return reject(move, ErrInvalidMove, "commitment already used by another player, pick a fresh salt")
+	}
+
+	player.Commitment = move.Commitment
+	player.HasCommitted = true
+	a.emit(EventMoveCommitted, player.ID, move.Commitment)
+
+	if s.HaveAllCommitted() {
+		a.startReveal()
+	}
+	return nil
+}
+
+// reveal verifies a revealed choice against the player's commitment and records it
+func (a *applier) reveal(player *models.Player, move Move) error {
+	s := a.session
+	if s.Mode != models.ModeCommitReveal {
+		return reject(move, ErrWrongMode, "reveal in a %s session", s.Mode)
+	}
+	if s.Phase != models.PhaseReveal || !player.HasCommitted {
+		return reject(move, ErrWrongPhase, "choices are revealed once every player has committed")
+	}
+	if len(move.Salt) < models.MinSaltLength {
+		return reject(move, ErrInvalidMove, "the salt must be at least %d bytes", models.MinSaltLength)
+	}
+	if models.Commitment(move.Choice, move.Salt) != player.Commitment {
+		return reject(move, ErrInvalidMove, "choice and salt do not match the commitment")
+	}
+	if !a.rs.IsValid(move.Choice) {
+		return reject(move, ErrInvalidMove, "%q is not %s", move.Choice, rules.DescribeMoves(a.rs))
+	}
+	a.play(player, move.Choice)
+	a.emit(EventMoveRevealed, player.ID, move.Choice)
+	return nil
+}
+
+// play records the move of a player in the current round
+func (a *applier) play(player *models.Player, choice string) {
+	s := a.session
+	currentRound := &s.Results[s.CurrentRound-1]
+	currentRound.Choices = append(currentRound.Choices, models.PlayerChoice{
+		Envelope: models.Envelope{Type: models.MessageChoice, PlayerID: player.ID, SessionID: s.SessionID, AccountID: player.AccountID},
+		Choice:   choice,
+	})
+	player.HasPlayed = true
+}
+
+// startReveal opens the reveal phase of a commit-reveal round
+func (a *applier) startReveal() {
+	a.session.Phase = models.PhaseReveal
+	a.session.StartClock(a.at)
+	a.emit(EventRevealStarted, "", "")
+}
+
+// timeout handles a missed round deadline: every player who has not moved yet either forfeits
+// the round or gets a random move, depending on the session policy. Players who miss too many
+// consecutive deadlines are dropped, and the session is abandoned when fewer than two players remain.
+func (a *applier) timeout(move Move) error {
+	s := a.session
+	if s.RoundDeadline == nil || !s.RoundDeadline.Equal(move.Deadline) || s.CurrentRound != move.Round || s.Phase != move.Phase {
+		return reject(move, ErrStaleTimeout, "round %d", move.Round)
+	}
+	if a.at.Before(*s.RoundDeadline) {
+		return reject(move, ErrStaleTimeout, "deadline %s has not passed", s.RoundDeadline)
+	}
+
+	committing := s.Mode == models.ModeCommitReveal && s.Phase == models.PhaseCommit
+	for _, p := range s.ActivePlayers() {
+		if p.HasPlayed || p.HasForfeited || (committing && p.HasCommitted) {
+			continue
+		}
+
+		p.MissedRounds++
+		if p.MissedRounds >= s.MaxMissedRounds {
+			p.Eliminated = true
+			a.emit(EventPlayerDropped, p.ID, "")
+			continue
+		}
+
+		// A committed move cannot be replaced, so players who do not reveal always forfeit
+		if s.TimeoutPolicy == models.TimeoutRandom && s.Phase != models.PhaseReveal {
+			choice := a.randomMove(p.ID)
+			a.play(p, choice)
+			p.HasCommitted = s.Mode == models.ModeCommitReveal
+			a.emit(EventDeadlineMissed, p.ID, choice)
+		} else {
+			p.HasForfeited = true
+			a.emit(EventDeadlineMissed, p.ID, "")
+		}
+	}
+
+	if len(s.ActivePlayers()) < models.MinPlayers {
+		if err := a.transition(models.StatusAbandoned); err != nil {
+			return err
+		}
+		s.RoundDeadline = nil
+		a.emit(EventSessionAbandoned, "", "")
+		return nil
+	}
+
+	if committing && s.HaveAllCommitted() {
+		a.startReveal()
+	}
+	return nil
+}
+
+// randomMove picks the move played for a player who missed a deadline. The pick is seeded with
+// the session, round and player so that replaying a timeout gives the same move.
+func (a *applier) randomMove(playerID string) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%d/%s", a.session.SessionID, a.session.CurrentRound, playerID)
+	moves := a.rs.Moves()
+	return moves[rand.New(rand.NewSource(int64(h.Sum64()))).Intn(len(moves))]
+}
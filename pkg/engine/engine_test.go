@@ -0,0 +1,461 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"shifumi-game/pkg/models"
+	"testing"
+	"time"
+)
+
+const sessionID = "session-1"
+
+var t0 = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func join(playerID string) Move {
+	return Move{Type: models.MessageJoin, PlayerID: playerID, At: t0}
+}
+
+func choice(playerID, move string) Move {
+	return Move{Type: models.MessageChoice, PlayerID: playerID, Choice: move, At: t0}
+}
+
+func control(command, playerID string) Move {
+	return Move{Type: command, PlayerID: playerID, At: t0}
+}
+
+// applyCase applies the setup moves to a new session, which must all be accepted, then the move under test
+type applyCase struct {
+	name    string
+	opts    models.SessionOptions
+	setup   []Move
+	move    Move
+	wantErr error // Reason the move is rejected for, checked with errors.Is
+	check   func(t *testing.T, s *models.GameSession, events []Event)
+}
+
+func runApplyCases(t *testing.T, cases []applyCase) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			session := newSession(t, tc.opts)
+			session = applyAll(t, session, tc.setup...)
+
+			before := session.Clone()
+			updated, events, err := Apply(session, tc.move)
+			if !reflect.DeepEqual(session, before) {
+				t.Fatalf("Apply modified the session passed in")
+			}
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) || !errors.Is(err, ErrRejected) {
+					t.Fatalf("Apply() error = %v, want %v", err, tc.wantErr)
+				}
+				if updated != session || events != nil {
+					t.Fatalf("rejected move returned an updated session or events")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if tc.check != nil {
+				tc.check(t, updated, events)
+			}
+		})
+	}
+}
+
+func newSession(t *testing.T, opts models.SessionOptions) *models.GameSession {
+	t.Helper()
+	session, _, err := New(sessionID, opts, "", t0)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return session
+}
+
+func applyAll(t *testing.T, session *models.GameSession, moves ...Move) *models.GameSession {
+	t.Helper()
+	for _, move := range moves {
+		var err error
+		if session, _, err = Apply(session, move); err != nil {
+			t.Fatalf("Apply(%s from %s) error = %v", move.Type, move.PlayerID, err)
+		}
+	}
+	return session
+}
+
+func wantStatus(want models.Status) func(t *testing.T, s *models.GameSession, events []Event) {
+	return func(t *testing.T, s *models.GameSession, events []Event) {
+		t.Helper()
+		if s.Status != want {
+			t.Errorf("status = %s, want %s", s.Status, want)
+		}
+	}
+}
+
+func hasEvent(events []Event, eventType EventType) bool {
+	for _, e := range events {
+		if e.Type == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func TestApplyTransitions(t *testing.T) {
+	threePlayers := models.SessionOptions{Players: 3}
+	private := models.SessionOptions{InviteCode: "secret-code"}
+
+	runApplyCases(t, []applyCase{
+		{
+			name:  "join takes the next seat",
+			opts:  threePlayers,
+			move:  join("2"),
+			check: wantStatus(models.StatusWaiting),
+		},
+		{
+			name: "last seat starts the game",
+			move: join("2"),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				wantStatus(models.StatusAwaitingMoves)(t, s, events)
+				if !hasEvent(events, EventPlayerJoined) || !hasEvent(events, EventRoundStarted) {
+					t.Errorf("events = %v, want player-joined and round-started", events)
+				}
+			},
+		},
+		{
+			name: "choice seats a joining player",
+			move: choice("2", "rock"),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				wantStatus(models.StatusAwaitingMoves)(t, s, events)
+				if p := s.Player("2"); p == nil || !p.HasPlayed {
+					t.Errorf("player 2 = %+v, want seated and played", p)
+				}
+			},
+		},
+		{name: "join out of turn", opts: threePlayers, move: join("3"), wantErr: ErrNotSeated},
+		{name: "join twice", move: join("1"), wantErr: ErrAlreadySeated},
+		{name: "join a full session", opts: threePlayers, setup: []Move{join("2"), join("3")}, move: choice("4", "rock"), wantErr: ErrSessionFull},
+		{name: "join a private session without the invite code", opts: private, move: join("2"), wantErr: ErrNotInvited},
+		{
+			name:  "join a private session with the invite hash",
+			opts:  private,
+			move:  Move{Type: models.MessageJoin, PlayerID: "2", InviteHash: models.InviteHash(sessionID, "secret-code"), At: t0},
+			check: wantStatus(models.StatusAwaitingMoves),
+		},
+		{
+			name:    "join a private session with the wrong code",
+			opts:    private,
+			move:    Move{Type: models.MessageJoin, PlayerID: "2", InviteHash: models.InviteHash(sessionID, "wrong-code"), At: t0},
+			wantErr: ErrNotInvited,
+		},
+		{
+			name: "allowed account joins without the invite code",
+			opts: models.SessionOptions{InviteCode: "secret-code", AllowedAccounts: []string{"alice"}},
+			move: Move{Type: models.MessageJoin, PlayerID: "2", AccountID: "alice", At: t0},
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				if p := s.Player("2"); p == nil || p.AccountID != "alice" {
+					t.Errorf("player 2 = %+v, want seated with account alice", p)
+				}
+			},
+		},
+		{
+			name:  "last move resolves the round",
+			setup: []Move{choice("2", "rock")},
+			move:  choice("1", "paper"),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				wantStatus(models.StatusRoundResolved)(t, s, events)
+				if s.Results[0].WinnerID != "1" || s.Players[0].Wins != 1 || s.CurrentRound != 2 {
+					t.Errorf("round 1 winner = %q, wins = %d, round = %d, want player 1 with 1 win in round 2",
+						s.Results[0].WinnerID, s.Players[0].Wins, s.CurrentRound)
+				}
+			},
+		},
+		{
+			name:  "first move of the next round",
+			setup: []Move{choice("2", "rock"), choice("1", "paper")},
+			move:  choice("1", "rock"),
+			check: wantStatus(models.StatusAwaitingMoves),
+		},
+		{
+			name:  "drawn round",
+			setup: []Move{choice("2", "rock")},
+			move:  choice("1", "rock"),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				if s.Draws != 1 || s.Results[0].WinnerID != models.Draw {
+					t.Errorf("draws = %d, winner = %q, want 1 draw", s.Draws, s.Results[0].WinnerID)
+				}
+			},
+		},
+		{name: "play twice in a round", setup: []Move{choice("2", "rock")}, move: choice("2", "paper"), wantErr: ErrCannotPlay},
+		{name: "invalid choice", move: choice("1", "lizard"), wantErr: ErrInvalidMove},
+		{
+			name:  "pause",
+			setup: []Move{join("2")},
+			move:  control(models.MessagePause, "1"),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				wantStatus(models.StatusPaused)(t, s, events)
+				if s.RoundDeadline != nil {
+					t.Errorf("round deadline = %v, want the clock stopped", s.RoundDeadline)
+				}
+			},
+		},
+		{name: "pause from a spectator", setup: []Move{join("2")}, move: control(models.MessagePause, "3"), wantErr: ErrNotSeated},
+		{name: "pause before the game starts", move: control(models.MessagePause, "1"), wantErr: ErrRejected},
+		{name: "choice while paused", setup: []Move{join("2"), control(models.MessagePause, "1")}, move: choice("1", "rock"), wantErr: ErrRejected},
+		{
+			name:  "resume",
+			setup: []Move{join("2"), control(models.MessagePause, "2")},
+			move:  control(models.MessageResume, "1"),
+			check: wantStatus(models.StatusAwaitingMoves),
+		},
+		{name: "cancel before the game starts", move: control(models.MessageCancel, "1"), check: wantStatus(models.StatusCancelled)},
+		{name: "cancel while playing", setup: []Move{join("2")}, move: control(models.MessageCancel, "1"), wantErr: ErrRejected},
+		{
+			name:  "cancel while paused",
+			setup: []Move{join("2"), control(models.MessagePause, "1")},
+			move:  control(models.MessageCancel, "2"),
+			check: wantStatus(models.StatusCancelled),
+		},
+		{name: "move after cancelling", setup: []Move{control(models.MessageCancel, "1")}, move: join("2"), wantErr: ErrRejected},
+	})
+}
+
+func TestApplyStateError(t *testing.T) {
+	session := applyAll(t, newSession(t, models.SessionOptions{}), join("2"), control(models.MessagePause, "1"))
+
+	_, _, err := Apply(session, choice("1", "rock"))
+	var stateErr *StateError
+	if !errors.As(err, &stateErr) || stateErr.Status != models.StatusPaused || stateErr.Command != models.MessageChoice {
+		t.Fatalf("Apply() error = %v, want a StateError for a choice in a paused session", err)
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    models.SessionOptions
+		wantErr bool
+	}{
+		{name: "defaults", opts: models.SessionOptions{}},
+		{name: "bot opponent", opts: models.SessionOptions{Opponent: "bot:markov:2"}},
+		{name: "not a bot", opts: models.SessionOptions{Opponent: "alice"}, wantErr: true},
+		{name: "unknown bot", opts: models.SessionOptions{Opponent: "bot:unknown"}, wantErr: true},
+		{name: "bot in a commit-reveal session", opts: models.SessionOptions{Opponent: "bot:random", Mode: models.ModeCommitReveal}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := ValidateOptions(tt.opts); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateOptions() error = %v, want an error: %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestApplyNextOffsets(t *testing.T) {
+	// The same offsets in two partitions are different messages
+	at := func(move Move, partition int, offset int64) Move {
+		move.Partition, move.Offset = partition, &offset
+		return move
+	}
+	original := applyAll(t, newSession(t, models.SessionOptions{}), at(join("2"), 0, 5))
+	session := applyAll(t, original, at(choice("1", "rock"), 1, 2))
+
+	if !session.Applied(0, 5) || session.Applied(0, 6) {
+		t.Errorf("partition 0: applied 5 = %v, 6 = %v, want only the offsets up to 5", session.Applied(0, 5), session.Applied(0, 6))
+	}
+	if !session.Applied(1, 2) || session.Applied(1, 3) || session.Applied(2, 0) {
+		t.Errorf("next offsets = %v, want 3 in partition 1 and none in partition 2", session.NextOffsets)
+	}
+	if original.Applied(1, 2) {
+		t.Errorf("Apply recorded the offset in the session it was given")
+	}
+}
+
+// Salts of the commit-reveal moves, long enough for models.MinSaltLength
+const (
+	salt1 = "0123456789abcdef"
+	salt2 = "fedcba9876543210"
+)
+
+func commit(playerID, move, salt string) Move {
+	return Move{Type: models.MessageCommit, PlayerID: playerID, Commitment: models.Commitment(move, salt), At: t0}
+}
+
+func reveal(playerID, move, salt string) Move {
+	return Move{Type: models.MessageReveal, PlayerID: playerID, Choice: move, Salt: salt, At: t0}
+}
+
+func TestApplyCommitReveal(t *testing.T) {
+	opts := models.SessionOptions{Mode: models.ModeCommitReveal}
+	committed := []Move{join("2"), commit("1", "rock", salt1), commit("2", "scissors", salt2)}
+
+	runApplyCases(t, []applyCase{
+		{
+			name:  "first commitment",
+			opts:  opts,
+			setup: []Move{join("2")},
+			move:  commit("1", "rock", salt1),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				if s.Phase != models.PhaseCommit || !s.Players[0].HasCommitted || s.Players[0].HasPlayed {
+					t.Errorf("phase = %s, player 1 = %+v, want committed in the commit phase", s.Phase, s.Players[0])
+				}
+			},
+		},
+		{
+			name:  "last commitment opens the reveal phase",
+			opts:  opts,
+			setup: []Move{join("2"), commit("1", "rock", salt1)},
+			move:  commit("2", "scissors", salt2),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				if s.Phase != models.PhaseReveal || !hasEvent(events, EventRevealStarted) {
+					t.Errorf("phase = %s, events = %v, want the reveal phase", s.Phase, events)
+				}
+			},
+		},
+		{name: "plaintext choice", opts: opts, setup: []Move{join("2")}, move: choice("1", "rock"), wantErr: ErrWrongMode},
+		{name: "commitment in an open session", setup: []Move{join("2")}, move: commit("1", "rock", salt1), wantErr: ErrWrongMode},
+		{name: "reveal before every commitment is in", opts: opts, setup: []Move{join("2"), commit("1", "rock", salt1)}, move: reveal("1", "rock", salt1), wantErr: ErrWrongPhase},
+		{name: "commit during the reveal phase", opts: opts, setup: committed, move: commit("1", "paper", salt1), wantErr: ErrWrongPhase},
+		{name: "commit twice", opts: opts, setup: []Move{join("2"), commit("1", "rock", salt1)}, move: commit("1", "paper", salt1), wantErr: ErrCannotPlay},
+		{
+			name:    "malformed commitment",
+			opts:    opts,
+			setup:   []Move{join("2")},
+			move:    Move{Type: models.MessageCommit, PlayerID: "1", Commitment: "not-a-hash", At: t0},
+			wantErr: ErrInvalidMove,
+		},
+		{name: "commitment of another player", opts: opts, setup: []Move{join("2"), commit("1", "rock", salt1)}, move: commit("2", "rock", salt1), wantErr: ErrInvalidMove},
+		{name: "reveal not matching the commitment", opts: opts, setup: committed, move: reveal("1", "paper", salt1), wantErr: ErrInvalidMove},
+		{
+			name:    "salt too short",
+			opts:    opts,
+			setup:   []Move{join("2"), commit("1", "rock", "short"), commit("2", "scissors", salt2)},
+			move:    reveal("1", "rock", "short"),
+			wantErr: ErrInvalidMove,
+		},
+		{
+			name:  "first reveal",
+			opts:  opts,
+			setup: committed,
+			move:  reveal("1", "rock", salt1),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				if !s.Players[0].HasPlayed || !hasEvent(events, EventMoveRevealed) || hasEvent(events, EventRoundResolved) {
+					t.Errorf("player 1 = %+v, events = %v, want revealed and the round still open", s.Players[0], events)
+				}
+			},
+		},
+		{
+			name:  "last reveal resolves the round",
+			opts:  opts,
+			setup: append(committed, reveal("1", "rock", salt1)),
+			move:  reveal("2", "scissors", salt2),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				if s.Results[0].WinnerID != "1" || s.Phase != models.PhaseCommit || s.Players[0].Commitment != "" {
+					t.Errorf("winner = %q, phase = %s, want player 1 and a new commit phase", s.Results[0].WinnerID, s.Phase)
+				}
+			},
+		},
+	})
+}
+
+// deadline is the deadline of the first round of the sessions with a round timeout of 10 seconds
+var deadline = t0.Add(10 * time.Second)
+
+func timeout(round int, phase string, at time.Time) Move {
+	return Move{Type: models.MessageTimeout, Round: round, Phase: phase, Deadline: deadline, At: at}
+}
+
+func TestApplyTimeout(t *testing.T) {
+	timed := models.SessionOptions{RoundTimeout: 10}
+	random := models.SessionOptions{RoundTimeout: 10, TimeoutPolicy: models.TimeoutRandom}
+	dropAtOnce := models.SessionOptions{RoundTimeout: 10, MaxMissedRounds: 1}
+	commitReveal := models.SessionOptions{RoundTimeout: 10, TimeoutPolicy: models.TimeoutRandom, Mode: models.ModeCommitReveal}
+
+	runApplyCases(t, []applyCase{
+		{name: "before the deadline", opts: timed, setup: []Move{join("2")}, move: timeout(1, "", t0.Add(5*time.Second)), wantErr: ErrStaleTimeout},
+		{name: "deadline of another round", opts: timed, setup: []Move{join("2")}, move: timeout(2, "", deadline), wantErr: ErrStaleTimeout},
+		{name: "session without deadlines", setup: []Move{join("2")}, move: timeout(1, "", deadline), wantErr: ErrStaleTimeout},
+		{
+			name:  "missing player forfeits",
+			opts:  timed,
+			setup: []Move{join("2"), choice("1", "rock")},
+			move:  timeout(1, "", deadline),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				round := s.Results[0]
+				if round.WinnerID != "1" || !reflect.DeepEqual(round.Forfeited, []string{"2"}) || s.Players[1].MissedRounds != 1 {
+					t.Errorf("winner = %q, forfeited = %v, missed rounds = %d, want player 2 forfeiting to player 1",
+						round.WinnerID, round.Forfeited, s.Players[1].MissedRounds)
+				}
+				if !s.RoundDeadline.Equal(deadline.Add(10 * time.Second)) {
+					t.Errorf("next deadline = %v, want the clock restarted at the timeout", s.RoundDeadline)
+				}
+			},
+		},
+		{
+			name:  "random move for the missing player",
+			opts:  random,
+			setup: []Move{join("2"), choice("1", "rock")},
+			move:  timeout(1, "", deadline),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				round := s.Results[0]
+				if round.Choice("2") == nil || len(round.Forfeited) != 0 {
+					t.Errorf("choices = %v, forfeited = %v, want a random move for player 2", round.Choices, round.Forfeited)
+				}
+			},
+		},
+		{
+			name:  "player dropped after too many missed deadlines",
+			opts:  dropAtOnce,
+			setup: []Move{join("2"), choice("1", "rock")},
+			move:  timeout(1, "", deadline),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				wantStatus(models.StatusAbandoned)(t, s, events)
+				if !s.Players[1].Eliminated || !hasEvent(events, EventPlayerDropped) || !hasEvent(events, EventSessionAbandoned) {
+					t.Errorf("player 2 = %+v, events = %v, want player 2 dropped and the session abandoned", s.Players[1], events)
+				}
+				if s.RoundDeadline != nil {
+					t.Errorf("round deadline = %v, want none once abandoned", s.RoundDeadline)
+				}
+			},
+		},
+		{
+			name:  "missed commitment gets a random move",
+			opts:  commitReveal,
+			setup: []Move{join("2"), commit("1", "rock", salt1)},
+			move:  timeout(1, models.PhaseCommit, deadline),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				if s.Phase != models.PhaseReveal || !s.Players[1].HasPlayed {
+					t.Errorf("phase = %s, player 2 = %+v, want a random move and the reveal phase", s.Phase, s.Players[1])
+				}
+			},
+		},
+		{
+			name:  "missed reveal forfeits even with random moves",
+			opts:  commitReveal,
+			setup: []Move{join("2"), commit("1", "rock", salt1), commit("2", "scissors", salt2), reveal("1", "rock", salt1)},
+			move:  timeout(1, models.PhaseReveal, deadline),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				round := s.Results[0]
+				if round.WinnerID != "1" || !reflect.DeepEqual(round.Forfeited, []string{"2"}) {
+					t.Errorf("winner = %q, forfeited = %v, want player 2 forfeiting the round", round.WinnerID, round.Forfeited)
+				}
+			},
+		},
+	})
+}
+
+func TestApplyTimeoutIsDeterministic(t *testing.T) {
+	session := applyAll(t, newSession(t, models.SessionOptions{RoundTimeout: 10, TimeoutPolicy: models.TimeoutRandom}), join("2"))
+
+	first, _, err := Apply(session, timeout(1, "", deadline))
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	second, _, err := Apply(session, timeout(1, "", deadline))
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("replaying a timeout gave different random moves: %v and %v", first.Results[0].Choices, second.Results[0].Choices)
+	}
+}
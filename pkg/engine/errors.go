@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"shifumi-game/pkg/models"
+)
+
+// ErrRejected is wrapped by every error returned for a move that is not allowed. The session is left unchanged.
+var ErrRejected = errors.New("move rejected")
+
+// Reasons of a MoveError
+var (
+	ErrSessionFull   = errors.New("all the seats are taken")
+	ErrNotSeated     = errors.New("player has no seat in the session")
+	ErrAlreadySeated = errors.New("player already has a seat in the session")
+	ErrNotInvited    = errors.New("player is not invited to the session")
+	ErrCannotPlay    = errors.New("player cannot play this round")
+	ErrWrongMode     = errors.New("move does not match the mode of the session")
+	ErrWrongPhase    = errors.New("move does not match the phase of the round")
+	ErrInvalidMove   = errors.New("invalid move")
+	ErrStaleTimeout  = errors.New("stale round timeout")
+)
+
+// StateError is returned when a command is not allowed in the current status of the session
+type StateError struct {
+	Command string
+	Status  models.Status
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("%s is not allowed when the session is %s", e.Command, e.Status)
+}
+
+func (e *StateError) Unwrap() error {
+	return ErrRejected
+}
+
+// MoveError is returned when a command is allowed in the current status but not for this player
+// or with these values. Reason is one of the Err* reasons above.
+type MoveError struct {
+	Command  string
+	PlayerID string
+	Reason   error
+	Detail   string
+}
+
+func (e *MoveError) Error() string {
+	msg := fmt.Sprintf("%s rejected: %v", e.Command, e.Reason)
+	if e.PlayerID != "" {
+		msg = fmt.Sprintf("%s from %s rejected: %v", e.Command, models.PlayerName(e.PlayerID), e.Reason)
+	}
+	if e.Detail != "" {
+		msg += " (" + e.Detail + ")"
+	}
+	return msg
+}
+
+func (e *MoveError) Unwrap() []error {
+	return []error{ErrRejected, e.Reason}
+}
+
+// TransitionError is returned when a command would move the session to a status it cannot reach
+// from its current one
+type TransitionError struct {
+	From models.Status
+	To   models.Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("illegal transition from %s to %s", e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrRejected
+}
@@ -0,0 +1,30 @@
+package engine
+
+// EventType is the kind of change an engine command made to a session
+type EventType string
+
+const (
+	EventSessionCreated   EventType = "session-created"
+	EventPlayerJoined     EventType = "player-joined"
+	EventMovePlayed       EventType = "move-played"    // Detail: the move
+	EventMoveCommitted    EventType = "move-committed" // Detail: the commitment
+	EventMoveRevealed     EventType = "move-revealed"  // Detail: the move
+	EventRevealStarted    EventType = "reveal-started"
+	EventDeadlineMissed   EventType = "deadline-missed" // Detail: the random move played, empty when the player forfeits
+	EventPlayerDropped    EventType = "player-dropped"
+	EventRoundResolved    EventType = "round-resolved" // Detail: the round result
+	EventRoundStarted     EventType = "round-started"
+	EventSessionFinished  EventType = "session-finished" // PlayerID: the winner, empty for a draw
+	EventSessionAbandoned EventType = "session-abandoned"
+	EventSessionPaused    EventType = "session-paused"  // PlayerID: who paused
+	EventSessionResumed   EventType = "session-resumed" // PlayerID: who resumed
+	EventSessionCancelled EventType = "session-cancelled"
+)
+
+// Event describes a change made to a session, in the order the changes happened
+type Event struct {
+	Type     EventType `json:"type"`
+	Round    int       `json:"round"`
+	PlayerID string    `json:"player_id,omitempty"`
+	Detail   string    `json:"detail,omitempty"`
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"fmt"
+	"shifumi-game/pkg/models"
+	"time"
+)
+
+// RecordType is the kind of entry of the event log of a session
+type RecordType string
+
+const (
+	RecordSessionCreated RecordType = "session-created" // Session: the new session
+	RecordPlayerJoined   RecordType = "player-joined"   // Move: the join
+	RecordMoveSubmitted  RecordType = "move-submitted"  // Move: any other command, including pauses and missed deadlines
+	RecordRoundResolved  RecordType = "round-resolved"  // Round: the resolved round
+	RecordGameFinished   RecordType = "game-finished"   // Winner: the winner, empty for a draw
+)
+
+// Record is an entry of the event log of a session. The log holds the commands that were accepted,
+// from which the session is rebuilt with Fold, and the outcomes they had, for the history of the
+// session.
+type Record struct {
+	SessionID string     `json:"session_id"`
+	Seq       int64      `json:"seq"` // Version of the session once the record is applied, from 1
+	Type      RecordType `json:"type"`
+	At        time.Time  `json:"at"`
+
+	Session *models.GameSession `json:"session,omitempty"`
+	Move    *Move               `json:"move,omitempty"`
+	Round   *models.RoundResult `json:"round,omitempty"`
+	Winner  string              `json:"winner,omitempty"`
+}
+
+// CreationRecord returns the record of a new session. The sequence numbers of records are set when
+// they are stored.
+func CreationRecord(session *models.GameSession, at time.Time) Record {
+	return Record{SessionID: session.SessionID, Type: RecordSessionCreated, At: at, Session: session.Clone()}
+}
+
+// MoveRecords returns the records of a move applied to a session: the move, then the round it
+// resolved and the end of the game, if any. session is the session returned by Apply, with its events.
+func MoveRecords(session *models.GameSession, move Move, events []Event) []Record {
+	recordType := RecordMoveSubmitted
+	if move.Type == models.MessageJoin {
+		recordType = RecordPlayerJoined
+	}
+	records := []Record{{SessionID: session.SessionID, Type: recordType, At: move.At, Move: &move}}
+	for _, e := range events {
+		switch e.Type {
+		case EventRoundResolved:
+			round := session.Results[e.Round-1]
+			records = append(records, Record{SessionID: session.SessionID, Type: RecordRoundResolved, At: move.At, Round: &round})
+		case EventSessionFinished:
+			records = append(records, Record{SessionID: session.SessionID, Type: RecordGameFinished, At: move.At, Winner: e.PlayerID})
+		}
+	}
+	return records
+}
+
+// Fold rebuilds a session from its log: it applies the records that follow a snapshot of the session,
+// nil to start from the session-created record, and returns the session at the version of the last
+// record. The snapshot is not modified. Records the snapshot already includes are skipped. Moves are
+// applied with Apply, which is deterministic, so the round results and the end of the game come out
+// of the moves again; their records are only kept for the history.
+func Fold(snapshot *models.GameSession, records []Record) (*models.GameSession, error) {
+	session := snapshot
+	for _, r := range records {
+		version := int64(0)
+		if session != nil {
+			version = session.Version
+		}
+		if r.Seq <= version {
+			continue
+		}
+		if r.Seq != version+1 {
+			return nil, fmt.Errorf("record %d of session %s follows version %d", r.Seq, r.SessionID, version)
+		}
+
+		switch r.Type {
+		case RecordSessionCreated:
+			if session != nil || r.Session == nil {
+				return nil, fmt.Errorf("record %d of session %s creates it again", r.Seq, r.SessionID)
+			}
+			session = r.Session.Clone()
+		case RecordPlayerJoined, RecordMoveSubmitted:
+			if session == nil || r.Move == nil {
+				return nil, fmt.Errorf("record %d of session %s has no session or move to apply", r.Seq, r.SessionID)
+			}
+			updated, _, err := Apply(session, *r.Move)
+			if err != nil {
+				return nil, fmt.Errorf("record %d of session %s: %w", r.Seq, r.SessionID, err)
+			}
+			session = updated
+		default:
+			// Outcomes of the moves already applied
+			if session == nil {
+				return nil, fmt.Errorf("record %d of session %s precedes its creation", r.Seq, r.SessionID)
+			}
+			session = session.Clone()
+		}
+		session.Version = r.Seq
+	}
+	if session == nil {
+		return nil, fmt.Errorf("no session-created record")
+	}
+	return session, nil
+}
@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"reflect"
+	"shifumi-game/pkg/models"
+	"strings"
+	"testing"
+)
+
+// logMoves applies moves to a new session and returns the log a store would keep, with the session
+// at every version
+func logMoves(t *testing.T, opts models.SessionOptions, moves ...Move) ([]Record, []*models.GameSession) {
+	t.Helper()
+	session := newSession(t, opts)
+	session.Version = 1
+	records := []Record{CreationRecord(session, t0)}
+	records[0].Seq = 1
+	versions := []*models.GameSession{nil, session}
+
+	for _, move := range moves {
+		updated, events, err := Apply(session, move)
+		if err != nil {
+			t.Fatalf("Apply(%s from %s) error = %v", move.Type, move.PlayerID, err)
+		}
+		for _, r := range MoveRecords(updated, move, events) {
+			r.Seq = int64(len(records) + 1)
+			records = append(records, r)
+			version := updated.Clone()
+			version.Version = r.Seq
+			versions = append(versions, version)
+		}
+		session = versions[len(versions)-1]
+	}
+	return records, versions
+}
+
+func TestMoveRecords(t *testing.T) {
+	records, _ := logMoves(t, models.SessionOptions{}, join("2"), choice("1", "rock"), choice("2", "scissors"))
+
+	var types []RecordType
+	for _, r := range records {
+		types = append(types, r.Type)
+	}
+	want := []RecordType{RecordSessionCreated, RecordPlayerJoined, RecordMoveSubmitted, RecordMoveSubmitted, RecordRoundResolved}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("record types = %v, want %v", types, want)
+	}
+	if round := records[4].Round; round == nil || round.RoundNumber != 1 || round.WinnerID != "1" {
+		t.Errorf("round-resolved record = %+v, want round 1 won by player 1", round)
+	}
+}
+
+func TestFold(t *testing.T) {
+	moves := []Move{
+		join("2"),
+		choice("1", "rock"), choice("2", "scissors"),
+		choice("1", "paper"), choice("2", "paper"),
+		choice("1", "paper"), choice("2", "rock"),
+		choice("1", "scissors"), choice("2", "paper"),
+	}
+	records, versions := logMoves(t, models.SessionOptions{}, moves...)
+	last := versions[len(versions)-1]
+	if last.Status != models.StatusFinished || records[len(records)-1].Type != RecordGameFinished {
+		t.Fatalf("status = %s, want a finished game to fold", last.Status)
+	}
+
+	tests := []struct {
+		name     string
+		snapshot *models.GameSession
+		records  []Record
+		want     *models.GameSession
+		wantErr  string
+	}{
+		{name: "whole log", records: records, want: last},
+		{name: "from a snapshot", snapshot: versions[4], records: records, want: last},
+		{name: "records after a snapshot", snapshot: versions[4], records: records[4:], want: last},
+		{name: "up to a version", records: records[:6], want: versions[6]},
+		{name: "snapshot at the last version", snapshot: last, records: records, want: last},
+		{name: "no records", wantErr: "no session-created record"},
+		{name: "no creation", records: records[1:], wantErr: "follows version 0"},
+		{name: "gap in the log", snapshot: versions[2], records: records[3:], wantErr: "record 4 of session session-1 follows version 2"},
+		{
+			name:    "created twice",
+			records: []Record{records[0], {SessionID: sessionID, Seq: 2, Type: RecordSessionCreated, Session: versions[1]}},
+			wantErr: "creates it again",
+		},
+		{
+			name:    "move without a session",
+			records: []Record{{SessionID: sessionID, Seq: 1, Type: RecordMoveSubmitted, Move: &moves[1]}},
+			wantErr: "no session or move to apply",
+		},
+		{
+			name:    "rejected move",
+			records: []Record{records[0], {SessionID: sessionID, Seq: 2, Type: RecordMoveSubmitted, Move: &Move{Type: models.MessageChoice, PlayerID: "1", Choice: "lizard"}}},
+			wantErr: "record 2 of session session-1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before *models.GameSession
+			if tt.snapshot != nil {
+				before = tt.snapshot.Clone()
+			}
+			got, err := Fold(tt.snapshot, tt.records)
+			if tt.snapshot != nil && !reflect.DeepEqual(tt.snapshot, before) {
+				t.Fatalf("Fold modified the snapshot")
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Fold() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fold() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fold() = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
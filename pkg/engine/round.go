@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"shifumi-game/pkg/match"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/render"
+	"shifumi-game/pkg/rules"
+)
+
+// resolveRound scores the current round once every active player has played, ends the session
+// if the match is decided, and starts the next round otherwise
+func (a *applier) resolveRound() error {
+	s := a.session
+	currentRound := &s.Results[s.CurrentRound-1]
+
+	// Compare the moves of the players still in the game, in seat order
+	active := s.ActivePlayers()
+	moves := make([]string, len(active))
+	for i, p := range active {
+		if choice := currentRound.Choice(p.ID); choice != nil {
+			moves[i] = choice.Choice
+		} else {
+			moves[i] = match.Forfeit
+			currentRound.Forfeited = append(currentRound.Forfeited, p.ID)
+		}
+	}
+	// Moves are validated when they are recorded, so the round always scores
+	score, _ := match.ScoreRound(a.rs, moves)
+
+	if s.Scoring == match.Elimination {
+		for _, i := range score.Eliminated {
+			active[i].Eliminated = true
+			currentRound.Eliminated = append(currentRound.Eliminated, active[i].ID)
+		}
+	} else {
+		for i, p := range active {
+			p.Points += score.Points[i]
+		}
+	}
+	if score.Winner != match.NoWinner {
+		active[score.Winner].Wins++
+		currentRound.WinnerID = active[score.Winner].ID
+		currentRound.WinningMove = moves[score.Winner]
+		for _, move := range moves {
+			if move == match.Forfeit {
+				continue
+			}
+			if outcome, _ := a.rs.Outcome(currentRound.WinningMove, move); outcome == rules.Win {
+				currentRound.LosingMoves = append(currentRound.LosingMoves, move)
+			}
+		}
+		if distinct(currentRound.LosingMoves) == 1 {
+			currentRound.LosingMove = currentRound.LosingMoves[0]
+		}
+	} else {
+		// Knocking players out settles an elimination round, even without an outright winner
+		if s.Scoring != match.Elimination || len(score.Eliminated) == 0 {
+			s.Draws++
+		}
+		currentRound.WinnerID = models.Draw
+	}
+	resolvedAt := a.at
+	currentRound.ResolvedAt = &resolvedAt
+	currentRound.Result = render.Default().Round(a.rs, currentRound)
+	a.emit(EventRoundResolved, "", currentRound.Result)
+
+	// Check if the game has finished: last player standing for elimination, the match format otherwise
+	finished, winner := false, match.NoWinner
+	if s.Scoring == match.Elimination {
+		if remaining := s.ActivePlayers(); len(remaining) == 1 {
+			finished = true
+			winner = seatIndex(s, remaining[0].ID)
+		}
+	} else {
+		scores := make([]int, len(s.Players))
+		for i, p := range s.Players {
+			scores[i] = p.Points
+		}
+		finished, winner = s.Format.Decide(scores, s.CurrentRound)
+	}
+	next := models.StatusRoundResolved
+	if finished {
+		next = models.StatusFinished
+	}
+	if err := a.transition(next); err != nil {
+		return err
+	}
+	if finished {
+		if winner == match.NoWinner {
+			s.SetWinner("")
+			a.emit(EventSessionFinished, "", "")
+		} else {
+			s.SetWinner(models.PlayerName(s.Players[winner].ID))
+			a.emit(EventSessionFinished, s.Players[winner].ID, "")
+		}
+	}
+
+	// Prepare for the next round. Finished sessions keep an empty last round, as they always have.
+	s.CurrentRound++
+	s.Results = append(s.Results, models.RoundResult{RoundNumber: s.CurrentRound})
+	s.ResetPlayed()
+	s.StartClock(a.at)
+	if !finished {
+		a.emit(EventRoundStarted, "", "")
+	}
+	return nil
+}
+
+// seatIndex returns the index of a player in the session roster
+func seatIndex(session *models.GameSession, playerID string) int {
+	for i, p := range session.Players {
+		if p.ID == playerID {
+			return i
+		}
+	}
+	return match.NoWinner
+}
+
+// distinct returns the number of distinct values
+func distinct(values []string) int {
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		seen[v] = true
+	}
+	return len(seen)
+}
@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"shifumi-game/pkg/match"
+	"shifumi-game/pkg/models"
+	"testing"
+)
+
+func TestApplyMatchFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     match.Format
+		rounds     [][2]string // Moves of players 1 and 2
+		wantWinner string
+		wantDraws  int
+	}{
+		{
+			name:       "first to two",
+			format:     match.Format{Type: match.FirstTo, Target: 2},
+			rounds:     [][2]string{{"rock", "scissors"}, {"rock", "rock"}, {"paper", "scissors"}, {"paper", "rock"}},
+			wantWinner: "Player 1",
+			wantDraws:  1,
+		},
+		{
+			name:       "best of three",
+			format:     match.Format{Type: match.BestOf, Target: 3},
+			rounds:     [][2]string{{"rock", "paper"}, {"rock", "paper"}},
+			wantWinner: "Player 2",
+		},
+		{
+			name:      "fixed rounds ending level",
+			format:    match.Format{Type: match.Rounds, Target: 2},
+			rounds:    [][2]string{{"rock", "scissors"}, {"rock", "paper"}},
+			wantDraws: 0,
+		},
+		{
+			name:       "fixed rounds with sudden death",
+			format:     match.Format{Type: match.Rounds, Target: 2, Tiebreak: match.TiebreakSuddenDeath},
+			rounds:     [][2]string{{"rock", "scissors"}, {"rock", "paper"}, {"rock", "rock"}, {"scissors", "paper"}},
+			wantWinner: "Player 1",
+			wantDraws:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format := tt.format
+			session := newSession(t, models.SessionOptions{Format: &format})
+			for i, round := range tt.rounds {
+				if session.IsOver() {
+					t.Fatalf("session finished after %d rounds, want %d", i, len(tt.rounds))
+				}
+				session = applyAll(t, session, choice("1", round[0]), choice("2", round[1]))
+			}
+			if session.Status != models.StatusFinished {
+				t.Fatalf("status = %s, want %s", session.Status, models.StatusFinished)
+			}
+			if session.Winner != tt.wantWinner || session.Draws != tt.wantDraws {
+				t.Errorf("winner = %q, draws = %d, want %q and %d", session.Winner, session.Draws, tt.wantWinner, tt.wantDraws)
+			}
+			if _, _, err := Apply(session, choice("1", "rock")); !errors.Is(err, ErrRejected) {
+				t.Errorf("move after the end: error = %v, want %v", err, ErrRejected)
+			}
+		})
+	}
+}
+
+func TestApplyElimination(t *testing.T) {
+	opts := models.SessionOptions{Players: 3, Scoring: match.Elimination}
+	seated := []Move{join("2"), join("3")}
+
+	runApplyCases(t, []applyCase{
+		{
+			name:  "last player standing wins",
+			opts:  opts,
+			setup: append(seated, choice("1", "rock"), choice("2", "scissors")),
+			move:  choice("3", "scissors"),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				wantStatus(models.StatusFinished)(t, s, events)
+				if s.Winner != "Player 1" || !reflect.DeepEqual(s.Results[0].Eliminated, []string{"2", "3"}) {
+					t.Errorf("winner = %q, eliminated = %v, want player 1 knocking out players 2 and 3", s.Winner, s.Results[0].Eliminated)
+				}
+			},
+		},
+		{
+			name:  "elimination without an outright winner is not a draw",
+			opts:  opts,
+			setup: append(seated, choice("1", "rock"), choice("2", "rock")),
+			move:  choice("3", "scissors"),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				wantStatus(models.StatusRoundResolved)(t, s, events)
+				if !s.Players[2].Eliminated || s.Draws != 0 {
+					t.Errorf("player 3 eliminated = %t, draws = %d, want player 3 out and no draw", s.Players[2].Eliminated, s.Draws)
+				}
+			},
+		},
+		{
+			name:  "same moves are a draw",
+			opts:  opts,
+			setup: append(seated, choice("1", "rock"), choice("2", "rock")),
+			move:  choice("3", "rock"),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				if s.Draws != 1 || len(s.ActivePlayers()) != 3 {
+					t.Errorf("draws = %d, active players = %d, want a draw with nobody out", s.Draws, len(s.ActivePlayers()))
+				}
+			},
+		},
+		{
+			name:  "every move beaten once is a draw",
+			opts:  opts,
+			setup: append(seated, choice("1", "rock"), choice("2", "paper")),
+			move:  choice("3", "scissors"),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				if s.Draws != 1 || len(s.ActivePlayers()) != 3 {
+					t.Errorf("draws = %d, active players = %d, want a draw with nobody out", s.Draws, len(s.ActivePlayers()))
+				}
+			},
+		},
+		{
+			name:    "eliminated player cannot play",
+			opts:    opts,
+			setup:   append(seated, choice("1", "rock"), choice("2", "rock"), choice("3", "scissors")),
+			move:    choice("3", "rock"),
+			wantErr: ErrCannotPlay,
+		},
+		{
+			name:  "round resolves without the eliminated player",
+			opts:  opts,
+			setup: append(seated, choice("1", "rock"), choice("2", "rock"), choice("3", "scissors"), choice("1", "paper")),
+			move:  choice("2", "rock"),
+			check: func(t *testing.T, s *models.GameSession, events []Event) {
+				wantStatus(models.StatusFinished)(t, s, events)
+				if s.Winner != "Player 1" {
+					t.Errorf("winner = %q, want Player 1", s.Winner)
+				}
+			},
+		},
+	})
+}
@@ -0,0 +1,40 @@
+package engine
+
+import "shifumi-game/pkg/models"
+
+// commands lists the commands each status accepts. It is the single place deciding whether a
+// command can be applied to a session; the terminal statuses accept none.
+var commands = map[models.Status][]string{
+	models.StatusWaiting: {
+		models.MessageJoin, models.MessageChoice, models.MessageCommit, models.MessageCancel,
+	},
+	models.StatusAwaitingMoves: {
+		models.MessageChoice, models.MessageCommit, models.MessageReveal, models.MessageTimeout, models.MessagePause,
+	},
+	models.StatusRoundResolved: {
+		models.MessageChoice, models.MessageCommit, models.MessageReveal, models.MessageTimeout, models.MessagePause,
+	},
+	models.StatusPaused: {
+		models.MessageResume, models.MessageCancel,
+	},
+}
+
+// Allowed returns whether a command can be applied to a session in the given status
+func Allowed(status models.Status, command string) bool {
+	for _, allowed := range commands[status] {
+		if allowed == command {
+			return true
+		}
+	}
+	return false
+}
+
+// transition moves the session to the next status, or fails if the status machine does not allow it
+func (a *applier) transition(next models.Status) error {
+	current := a.session.CurrentStatus()
+	if !current.CanTransitionTo(next) {
+		return &TransitionError{From: current, To: next}
+	}
+	a.session.Status = next
+	return nil
+}
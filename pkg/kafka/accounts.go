@@ -0,0 +1,45 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"shifumi-game/pkg/accounts"
+)
+
+// AccountsTopic is the compacted topic holding the player accounts, keyed by account ID
+const AccountsTopic = "player-accounts"
+
+// SaveAccount publishes an account to the account registry
+func SaveAccount(kafkaBroker string, account accounts.Account) error {
+	value, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+	return WriteRecord(kafkaBroker, AccountsTopic, account.ID, value)
+}
+
+// DeleteAccount removes an account from the account registry
+func DeleteAccount(kafkaBroker string, id string) error {
+	return WriteRecord(kafkaBroker, AccountsTopic, id, nil)
+}
+
+// WatchAccounts keeps the accounts of this instance in sync with the account registry until ctx is cancelled
+func WatchAccounts(ctx context.Context, kafkaBroker string) error {
+	return TailTopic(ctx, kafkaBroker, AccountsTopic, func(key, value []byte) error {
+		if value == nil {
+			accounts.Delete(string(key))
+			return nil
+		}
+		var account accounts.Account
+		if err := json.Unmarshal(value, &account); err != nil {
+			return err
+		}
+		if !accounts.Put(account) {
+			log.Printf(Yellow+"[INFO] Player account skipped, its name was registered first by another account | AccountID: %s | Name: %s"+Reset, account.ID, account.Name)
+			return nil
+		}
+		log.Printf(Green+"[INFO] Player account loaded | AccountID: %s | Name: %s"+Reset, account.ID, account.Name)
+		return nil
+	})
+}
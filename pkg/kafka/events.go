@@ -0,0 +1,256 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"shifumi-game/pkg/engine"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// SessionEventsTopic is the topic holding the event log of every game session, keyed by session ID.
+// It is never compacted nor expired, as the log is the history of the sessions. Each message is the
+// batch of records of one session update.
+const SessionEventsTopic = "session-events"
+
+// Headers of a batch: the instance that appended it, and the offset of the previous batch of the
+// session, so that the batches of a session can be read without scanning the topic
+const (
+	writerHeader   = "writer"
+	previousHeader = "previous"
+)
+
+// CreateSessionEventsTopic creates the session events topic, keeping its records forever
+func CreateSessionEventsTopic(kafkaBroker string, replicationFactor int) error {
+	conn, err := kafka.DialLeader(context.Background(), "tcp", kafkaBroker, SessionEventsTopic, 0)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.CreateTopics(kafka.TopicConfig{
+		Topic:             SessionEventsTopic,
+		NumPartitions:     1,
+		ReplicationFactor: replicationFactor,
+		ConfigEntries: []kafka.ConfigEntry{
+			{ConfigName: "retention.ms", ConfigValue: "-1"},
+		},
+	})
+	if err != nil && err != kafka.TopicAlreadyExists {
+		return err
+	}
+	log.Printf("Topic %s is available.", SessionEventsTopic)
+	return nil
+}
+
+// AppendRecords writes the records of a session update to the session events topic as a single
+// message, so that readers accept or skip them as a whole, and returns its offset. writer names the
+// instance appending them, and previous is the offset of the update they follow, -1 for a new session.
+func AppendRecords(ctx context.Context, kafkaBroker string, writer string, previous int64, records []engine.Record) (int64, error) {
+	if len(records) == 0 {
+		return 0, fmt.Errorf("no records to append")
+	}
+	value, err := json.Marshal(records)
+	if err != nil {
+		return 0, err
+	}
+	batch := kafka.Record{
+		Key:     kafka.NewBytes([]byte(records[0].SessionID)),
+		Value:   kafka.NewBytes(value),
+		Headers: []kafka.Header{{Key: writerHeader, Value: []byte(writer)}},
+	}
+	if previous >= 0 {
+		batch.Headers = append(batch.Headers, kafka.Header{Key: previousHeader, Value: []byte(strconv.FormatInt(previous, 10))})
+	}
+
+	client := kafka.Client{
+		Addr: kafka.TCP(kafkaBroker),
+	}
+	res, err := client.Produce(ctx, &kafka.ProduceRequest{
+		Topic:        SessionEventsTopic,
+		Partition:    0,
+		RequiredAcks: kafka.RequireAll,
+		Records:      kafka.NewRecordReader(batch),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return res.BaseOffset, nil
+}
+
+// DecodeRecords decodes a message of the session events topic into its batch of records
+func DecodeRecords(value []byte) ([]engine.Record, error) {
+	var records []engine.Record
+	return records, json.Unmarshal(value, &records)
+}
+
+// batchWriter returns the instance that appended a batch, empty when it is not known
+func batchWriter(msg kafka.Message) string {
+	for _, h := range msg.Headers {
+		if h.Key == writerHeader {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// batchPrevious returns the offset of the batch a batch follows, -1 when it is the first batch of its session
+func batchPrevious(msg kafka.Message) int64 {
+	for _, h := range msg.Headers {
+		if h.Key == previousHeader {
+			if offset, err := strconv.ParseInt(string(h.Value), 10, 64); err == nil {
+				return offset
+			}
+		}
+	}
+	return -1
+}
+
+// LastOffset returns the offset the next message of a single-partition topic will get
+func LastOffset(ctx context.Context, kafkaBroker string, topic string) (int64, error) {
+	conn, err := kafka.DialLeader(ctx, "tcp", kafkaBroker, topic, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return conn.ReadLastOffset()
+}
+
+// TailRecords reads the session events topic from an offset, then follows it until ctx is cancelled,
+// handing every batch to handleBatch with its offset and writer. caughtUp is called once the batches
+// written before the call have all been handed over.
+func TailRecords(ctx context.Context, kafkaBroker string, from int64, handleBatch func(offset int64, writer string, records []engine.Record), caughtUp func()) error {
+	end, err := LastOffset(ctx, kafkaBroker, SessionEventsTopic)
+	if err != nil {
+		return err
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   []string{kafkaBroker},
+		Topic:     SessionEventsTopic,
+		Partition: 0,
+		MinBytes:  1,
+		MaxBytes:  10e6,
+	})
+	defer reader.Close()
+	if err := reader.SetOffset(from); err != nil {
+		return err
+	}
+
+	if from >= end {
+		caughtUp()
+	}
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return err
+		}
+		records, err := DecodeRecords(msg.Value)
+		if err != nil || len(records) == 0 {
+			log.Printf(Red+"[ERROR] Error unmarshalling session records | SessionID: %s | Offset: %d | Error: %v"+Reset, msg.Key, msg.Offset, err)
+		} else {
+			handleBatch(msg.Offset, batchWriter(msg), records)
+		}
+		if msg.Offset == end-1 {
+			caughtUp()
+		}
+	}
+}
+
+// ReadSessionRecords returns the batches of records of a session, oldest first, reading back from the
+// batch at offset last through the offset of the previous batch each one carries. The batches that
+// lost to a concurrent update are not included.
+func ReadSessionRecords(ctx context.Context, kafkaBroker string, last int64) ([][]engine.Record, error) {
+	conn, err := kafka.DialLeader(ctx, "tcp", kafkaBroker, SessionEventsTopic, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+	}
+
+	var batches [][]engine.Record
+	for offset := last; offset >= 0; {
+		if _, err := conn.Seek(offset, kafka.SeekAbsolute); err != nil {
+			return nil, err
+		}
+		msg, err := conn.ReadMessage(10e6)
+		if err != nil {
+			return nil, err
+		}
+		if msg.Offset != offset {
+			return nil, fmt.Errorf("read offset %d instead of %d", msg.Offset, offset)
+		}
+		records, err := DecodeRecords(msg.Value)
+		if err != nil || len(records) == 0 {
+			return nil, fmt.Errorf("error unmarshalling records at offset %d: %v", msg.Offset, err)
+		}
+		batches = append([][]engine.Record{records}, batches...)
+		offset = batchPrevious(msg)
+	}
+	if len(batches) > 0 && batches[0][0].Type != engine.RecordSessionCreated {
+		return nil, fmt.Errorf("the updates read back from offset %d do not start with the creation of the session", last)
+	}
+	return batches, nil
+}
+
+// ReplayGroup is the consumer group whose committed offset of the session events topic is where the
+// session stores start replaying it: every batch before it is included in the snapshot of its session
+// in the game-results topic. It is only used for its committed offset, nobody joins it.
+const ReplayGroup = "session-replay"
+
+// ReplayOffset returns the committed replay offset of the session events topic, 0 when none was committed
+func ReplayOffset(ctx context.Context, kafkaBroker string) (int64, error) {
+	client := kafka.Client{
+		Addr: kafka.TCP(kafkaBroker),
+	}
+	res, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: ReplayGroup,
+		Topics:  map[string][]int{SessionEventsTopic: {0}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	for _, p := range res.Topics[SessionEventsTopic] {
+		if p.Error != nil {
+			return 0, p.Error
+		}
+		if p.Partition == 0 && p.CommittedOffset > 0 {
+			return p.CommittedOffset, nil
+		}
+	}
+	return 0, nil
+}
+
+// CommitReplayOffset commits the replay offset of the session events topic. writer names the instance
+// committing it.
+func CommitReplayOffset(ctx context.Context, kafkaBroker string, writer string, offset int64) error {
+	client := kafka.Client{
+		Addr: kafka.TCP(kafkaBroker),
+	}
+	// Commits outside of a group generation, as the group has no members
+	res, err := client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      ReplayGroup,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{SessionEventsTopic: {{Partition: 0, Offset: offset, Metadata: writer}}},
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range res.Topics[SessionEventsTopic] {
+		if p.Error != nil {
+			return p.Error
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"shifumi-game/pkg/models"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// FinishedGamesTopic is the compacted topic holding the last snapshot of every finished session, keyed by session ID
+const FinishedGamesTopic = "finished-games"
+
+// PublishFinishedGame publishes the last snapshot of a finished session
+func PublishFinishedGame(kafkaBroker string, session *models.GameSession) error {
+	value, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return WriteRecord(kafkaBroker, FinishedGamesTopic, session.SessionID, value)
+}
+
+// FinishedGameIDs reads the finished-games topic up to its last session, and returns the IDs of the
+// sessions it holds
+func FinishedGameIDs(ctx context.Context, kafkaBroker string) (map[string]bool, error) {
+	end, err := LastOffset(ctx, kafkaBroker, FinishedGamesTopic)
+	if err != nil {
+		return nil, err
+	}
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   []string{kafkaBroker},
+		Topic:     FinishedGamesTopic,
+		Partition: 0,
+		MinBytes:  1,
+		MaxBytes:  10e6,
+	})
+	defer reader.Close()
+
+	sessionIDs := map[string]bool{}
+	for offset := int64(-1); offset < end-1; {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		offset = msg.Offset
+		if msg.Value == nil {
+			delete(sessionIDs, string(msg.Key))
+		} else {
+			sessionIDs[string(msg.Key)] = true
+		}
+	}
+	return sessionIDs, nil
+}
+
+// WatchFinishedGames replays the finished sessions, then hands every newly finished one to handleGame,
+// until ctx is cancelled. The same session can be handed more than once.
+func WatchFinishedGames(ctx context.Context, kafkaBroker string, handleGame func(*models.GameSession)) error {
+	return TailTopic(ctx, kafkaBroker, FinishedGamesTopic, func(key, value []byte) error {
+		if value == nil {
+			return nil
+		}
+		var session models.GameSession
+		if err := json.Unmarshal(value, &session); err != nil {
+			return err
+		}
+		handleGame(&session)
+		return nil
+	})
+}
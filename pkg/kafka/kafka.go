@@ -3,8 +3,6 @@ package kafka
 import (
 	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
 	"log"
 	"shifumi-game/pkg/models"
 	"time"
@@ -12,6 +10,9 @@ import (
 	"github.com/segmentio/kafka-go"
 )
 
+// PlayerChoicesTopic is the topic carrying the player messages to the game-logic service
+const PlayerChoicesTopic = "player-choices"
+
 const (
 	Reset  = "\033[0m"
 	Red    = "\033[31m"
@@ -33,14 +34,16 @@ func WriteMessages(writer *kafka.Writer, key, value []byte) error {
 	return nil
 }
 
-// ReadMessages reads messages from Kafka using a given reader and processes them using the provided handler function
-func ReadMessages(reader *kafka.Reader, handleMessage func(key, value []byte) error) error {
+// FetchMessages reads messages from Kafka using a given reader and processes them using the provided
+// handler function, until ctx is cancelled. Offsets are not committed: the handler commits them with
+// the reader once the messages are processed.
+func FetchMessages(ctx context.Context, reader *kafka.Reader, handleMessage func(msg kafka.Message) error) error {
 	for {
-		msg, err := reader.ReadMessage(context.Background())
+		msg, err := reader.FetchMessage(ctx)
 		if err != nil {
 			return err
 		}
-		if err := handleMessage(msg.Key, msg.Value); err != nil {
+		if err := handleMessage(msg); err != nil {
 			return err
 		}
 	}
@@ -117,141 +120,33 @@ func MonitorKafkaAvailability(kafkaBroker string, topics []string, partitions, r
 	}
 }
 
-func FetchGameSession(sessionID string, kafkaBroker string, prefix string) (*models.GameSession, kafka.Message, *kafka.Reader, error) {
-	// Build different consumer group for client/server per sessionID
-	groupID := prefix + "-game-session-group-" + sessionID
-	sessionTopic := "game-results-" + sessionID
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        []string{kafkaBroker},
-		Topic:          sessionTopic,
-		GroupID:        groupID,
-		MinBytes:       1,                     // Fetch immediately
-		MaxBytes:       1e6,                   // 1MB max fetch size
-		MaxWait:        10 * time.Millisecond, // Wait 10ms max
-		CommitInterval: 0,                     // Disable auto-commit to handle commits manually
-	})
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	msg, err := reader.FetchMessage(ctx)
-	if err != nil {
-		reader.Close()
-		if errors.Is(err, context.DeadlineExceeded) {
-			log.Printf(Yellow+"[INFO] No message found within timeout for topic %s"+Reset, sessionTopic)
-			return nil, kafka.Message{}, nil, nil // No message found within the timeout
-		}
-		log.Printf(Red+"[ERROR] Error fetching message: %v"+Reset, err)
-		return nil, kafka.Message{}, nil, fmt.Errorf("error fetching message: %w", err)
-	}
-
-	log.Printf(Green+"[INFO] Message fetched from Kafka: %s in topic %s"+Reset, string(msg.Value), sessionTopic) // Log the entire message
-
-	var gameSession models.GameSession
-	if err := json.Unmarshal(msg.Value, &gameSession); err != nil {
-		reader.Close()
-		log.Printf(Red+"[ERROR] Error unmarshalling message: %v"+Reset, err)
-		return nil, kafka.Message{}, nil, fmt.Errorf("error unmarshalling message: %w", err)
-	}
-
-	log.Printf(Green+"[INFO] Unmarshalled GameSession: %+v"+Reset, gameSession) // Log the unmarshalled session
-
-	// Ensure the message is for the correct session
-	if gameSession.SessionID == sessionID {
-		log.Printf(Green+"[INFO] Game session found: %s"+Reset, gameSession.SessionID)
-		return &gameSession, msg, reader, nil
-	}
-
-	log.Printf(Yellow+"[INFO] Session ID mismatch: %s vs %s"+Reset, sessionID, gameSession.SessionID)
-	reader.Close()
-	return nil, kafka.Message{}, nil, nil
-}
-
-// ReadGameSession reads a GameSession from Kafka based on the sessionID.
-func ReadGameSession(topic string, sessionID string, kafkaBroker string, prefix string) (*models.GameSession, error) {
-	// Build different consumer group for client/server per sessionID
-	groupID := prefix + "-game-session-group-" + sessionID
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        []string{kafkaBroker},
-		Topic:          topic,
-		GroupID:        groupID,
-		MinBytes:       1,                      // Fetch immediately
-		MaxBytes:       1e6,                    // 1MB max fetch size
-		MaxWait:        10 * time.Millisecond,  // Wait 10ms max
-		CommitInterval: 100 * time.Millisecond, // Commit offsets frequently
-	})
-
-	defer reader.Close()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	for {
-		msg, err := reader.ReadMessage(ctx)
-		if err != nil {
-			if errors.Is(err, context.DeadlineExceeded) {
-				log.Printf(Yellow + "[INFO] No message found within timeout" + Reset)
-				return nil, nil // No message found within the timeout
-			}
-			log.Printf(Red+"[ERROR] Error reading message: %v"+Reset, err)
-			return nil, fmt.Errorf("error reading message: %w", err)
-		}
-
-		log.Printf(Green+"[INFO] Message read from Kafka: %s"+Reset, string(msg.Value)) // Log the entire message
-
-		var gameSession models.GameSession
-		if err := json.Unmarshal(msg.Value, &gameSession); err != nil {
-			log.Printf(Red+"[ERROR] Error unmarshalling message: %v"+Reset, err)
-			return nil, fmt.Errorf("error unmarshalling message: %w", err)
-		}
-
-		log.Printf(Green+"[INFO] Unmarshalled GameSession: %+v"+Reset, gameSession) // Log the unmarshalled session
-
-		// Ensure the message is for the correct session
-		if gameSession.SessionID == sessionID {
-			log.Printf(Green+"[INFO] Game session found: %s"+Reset, gameSession.SessionID)
-			return &gameSession, nil
-		}
-
-		log.Printf(Yellow+"[INFO] Session ID mismatch: %s vs %s"+Reset, sessionID, gameSession.SessionID)
-	}
-}
-
-// updateSession publishes the updated game session to the Kafka game-results topic
-func UpdateSession(topic string, session *models.GameSession, kafkaBroker string) error {
-	log.Printf(Orange+"[INFO] Updating session | SessionID: %s"+Reset, session.SessionID)
-
+// PublishPlayerMessage writes a player message (choice, commit, reveal or timeout) to the player-choices
+// topic. The messages of a session all go to the partition its session ID hashes to, so that they are
+// read in order.
+func PublishPlayerMessage(kafkaBroker string, envelope models.Envelope, message interface{}) error {
 	writer := kafka.NewWriter(kafka.WriterConfig{
-		Brokers:      []string{kafkaBroker},
-		Topic:        topic,
-		Balancer:     &kafka.LeastBytes{},
-		BatchSize:    1,                    // Send each message individually
-		BatchBytes:   1e6,                  // 1MB max batch size
-		BatchTimeout: 5 * time.Millisecond, // Send immediately
+		Brokers:  []string{kafkaBroker},
+		Topic:    PlayerChoicesTopic,
+		Balancer: &kafka.Hash{},
 	})
 	defer writer.Close()
 
-	sessionBytes, err := json.Marshal(session)
+	value, err := json.Marshal(message)
 	if err != nil {
-		log.Printf(Red+"[ERROR] Failed to marshal session | SessionID: %s | Error: %v"+Reset, session.SessionID, err)
+		log.Printf(Red+"[ERROR] Failed to marshal player %s: %v"+Reset, envelope.Type, err)
 		return err
 	}
 
-	if err := writer.WriteMessages(context.Background(), kafka.Message{
-		Key:   []byte(session.SessionID),
-		Value: sessionBytes,
-	}); err != nil {
-		log.Printf(Orange+"[ERROR] Failed to write message to Kafka topic %s | SessionID: %s | Error: %v"+Reset, topic, session.SessionID, err)
+	err = writer.WriteMessages(context.Background(), kafka.Message{
+		Key:   []byte(envelope.SessionID),
+		Value: value,
+	})
+	if err != nil {
+		log.Printf(Red+"[ERROR] Failed to write player %s to Kafka: %v"+Reset, envelope.Type, err)
 		return err
 	}
-	log.Printf(Orange+"[INFO] Successfully wrote session update to Kafka topic | SessionID: %s"+Reset, session.SessionID)
-	log.Printf(Green+"[INFO] Message written to Kafka topic %s: %s"+Reset, topic, sessionBytes) // Log the entire message
 
+	// The message itself carries the player token, so it is not logged
+	log.Printf(Green+"[INFO] Successfully published player %s | SessionID: %s | PlayerID: %s"+Reset, envelope.Type, envelope.SessionID, envelope.PlayerID)
 	return nil
 }
-
-// Function to create a Kafka topic
-func CreateTopicForSession(kafkaBroker string, sessionID string, partitions int, replicationFactor int) error {
-	topicName := "game-results-" + sessionID
-	return CreateKafkaTopic([]string{kafkaBroker}, topicName, partitions, replicationFactor)
-}
@@ -0,0 +1,173 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/rules"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/topics"
+)
+
+// SessionTopicPrefix is the prefix of the per-session topics that held the game session snapshots
+// before the game-results topic. They are only read to migrate their sessions.
+const SessionTopicPrefix = "game-results-"
+
+// ListSessionTopics returns the IDs of the sessions that have a per-session topic
+func ListSessionTopics(ctx context.Context, kafkaBroker string) ([]string, error) {
+	client := kafka.Client{
+		Addr: kafka.TCP(kafkaBroker),
+	}
+	matchingTopics, err := topics.ListRe(ctx, &client, regexp.MustCompile("^"+SessionTopicPrefix+".*"))
+	if err != nil {
+		return nil, err
+	}
+	sessionIDs := make([]string, 0, len(matchingTopics))
+	for _, topic := range matchingTopics {
+		sessionIDs = append(sessionIDs, strings.TrimPrefix(topic.Name, SessionTopicPrefix))
+	}
+	return sessionIDs, nil
+}
+
+// ReadSessionTopic reads the last snapshot of the per-session topic of a session. It returns nil if the
+// topic is empty.
+func ReadSessionTopic(kafkaBroker string, sessionID string) (*models.GameSession, error) {
+	topic := SessionTopicPrefix + sessionID
+	conn, err := kafka.DialLeader(context.Background(), "tcp", kafkaBroker, topic, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	first, last, err := conn.ReadOffsets()
+	if err != nil {
+		return nil, err
+	}
+	if last <= first {
+		return nil, nil
+	}
+	if _, err := conn.Seek(last-1, kafka.SeekAbsolute); err != nil {
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	msg, err := conn.ReadMessage(1e6)
+	if err != nil {
+		return nil, fmt.Errorf("error reading message: %w", err)
+	}
+
+	return DecodeLegacySession(sessionID, msg.Value)
+}
+
+// legacySession is a snapshot of a per-session topic: a classic game between Player 1 and Player 2,
+// first to three round wins
+type legacySession struct {
+	Status           string        `json:"status"`
+	CurrentRound     int           `json:"round"`
+	Player1HasPlayed bool          `json:"player_1_has_played"`
+	Player2HasPlayed bool          `json:"player_2_has_played"`
+	Results          []legacyRound `json:"results"`
+	Player1Wins      int           `json:"player1_wins"`
+	Player2Wins      int           `json:"player2_wins"`
+	Draws            int           `json:"draws"`
+	Winner           string        `json:"winner"`
+}
+
+type legacyRound struct {
+	RoundNumber int           `json:"round_number"`
+	Player1     *legacyChoice `json:"player1"`
+	Player2     *legacyChoice `json:"player2"`
+	Result      string        `json:"result"`
+}
+
+type legacyChoice struct {
+	PlayerID string `json:"player_id"`
+	Choice   string `json:"choice"`
+}
+
+// DecodeLegacySession converts a snapshot of a per-session topic into a session: two seats, the classic
+// variant and the default match format, which are the rules the game had before they could be picked
+func DecodeLegacySession(sessionID string, value []byte) (*models.GameSession, error) {
+	var legacy legacySession
+	if err := json.Unmarshal(value, &legacy); err != nil {
+		return nil, fmt.Errorf("error unmarshalling message: %w", err)
+	}
+	if legacy.CurrentRound < 1 || len(legacy.Results) < legacy.CurrentRound {
+		return nil, fmt.Errorf("session %s is at round %d with %d round results", sessionID, legacy.CurrentRound, len(legacy.Results))
+	}
+
+	session := models.NewGameSession(sessionID, models.SessionOptions{Variant: rules.Default})
+	session.Players = []models.Player{
+		{ID: "1", HasPlayed: legacy.Player1HasPlayed, Wins: legacy.Player1Wins, Points: legacy.Player1Wins},
+		{ID: "2", HasPlayed: legacy.Player2HasPlayed, Wins: legacy.Player2Wins, Points: legacy.Player2Wins},
+	}
+	session.Status = models.StatusAwaitingMoves
+	if legacy.Status == string(models.StatusFinished) {
+		session.Status = models.StatusFinished
+	}
+	session.CurrentRound = legacy.CurrentRound
+	session.Draws = legacy.Draws
+	session.Winner = legacy.Winner
+
+	rs := rules.Classic()
+	session.Results = make([]models.RoundResult, len(legacy.Results))
+	for i, r := range legacy.Results {
+		round := models.RoundResult{RoundNumber: r.RoundNumber, Result: r.Result}
+		for _, c := range []*legacyChoice{r.Player1, r.Player2} {
+			if c == nil {
+				continue
+			}
+			round.Choices = append(round.Choices, models.PlayerChoice{
+				Envelope: models.Envelope{Type: models.MessageChoice, PlayerID: c.PlayerID, SessionID: sessionID},
+				Choice:   c.Choice,
+			})
+		}
+		// Rounds both players played were resolved
+		if r.Player1 != nil && r.Player2 != nil {
+			outcome, err := rs.Outcome(r.Player1.Choice, r.Player2.Choice)
+			if err != nil {
+				return nil, fmt.Errorf("session %s, round %d: %w", sessionID, r.RoundNumber, err)
+			}
+			switch outcome {
+			case rules.Win:
+				round.WinnerID, round.WinningMove, round.LosingMove = "1", r.Player1.Choice, r.Player2.Choice
+			case rules.Lose:
+				round.WinnerID, round.WinningMove, round.LosingMove = "2", r.Player2.Choice, r.Player1.Choice
+			default:
+				round.WinnerID = models.Draw
+			}
+			if round.LosingMove != "" {
+				round.LosingMoves = []string{round.LosingMove}
+			}
+		}
+		session.Results[i] = round
+	}
+	return session, nil
+}
+
+// DeleteSessionTopic deletes the per-session topic of a session
+func DeleteSessionTopic(kafkaBroker string, sessionID string) error {
+	conn, err := kafka.Dial("tcp", kafkaBroker)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Topics are deleted by the controller broker
+	controller, err := conn.Controller()
+	if err != nil {
+		return err
+	}
+	controllerConn, err := kafka.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	if err != nil {
+		return err
+	}
+	defer controllerConn.Close()
+	return controllerConn.DeleteTopics(SessionTopicPrefix + sessionID)
+}
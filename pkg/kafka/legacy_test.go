@@ -0,0 +1,113 @@
+package kafka
+
+import (
+	"reflect"
+	"shifumi-game/pkg/engine"
+	"shifumi-game/pkg/match"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/rules"
+	"testing"
+	"time"
+)
+
+// legacySnapshot is a session written to a per-session topic by the first version of the game: Player 1
+// won round 1, round 2 was a draw and Player 1 has played round 3
+const legacySnapshot = `{
+	"session_id": "abc123",
+	"status": "in progress",
+	"round": 3,
+	"player_1_has_played": true,
+	"player_2_has_played": false,
+	"results": [
+		{"round_number": 1, "player1": {"player_id": "1", "session_id": "abc123", "choice": "rock", "init_session": true}, "player2": {"player_id": "2", "session_id": "abc123", "choice": "scissors", "init_session": false}, "result": "Player 1 wins 🪨X→ 🥇"},
+		{"round_number": 2, "player1": {"player_id": "1", "session_id": "abc123", "choice": "paper", "init_session": false}, "player2": {"player_id": "2", "session_id": "abc123", "choice": "paper", "init_session": false}, "result": "Draw 📄📄 → 🤝"},
+		{"round_number": 3, "player1": {"player_id": "1", "session_id": "abc123", "choice": "scissors", "init_session": false}, "player2": null, "result": ""}
+	],
+	"player1_wins": 1,
+	"player2_wins": 0,
+	"draws": 1,
+	"winner": ""
+}`
+
+func TestDecodeLegacySession(t *testing.T) {
+	session, err := DecodeLegacySession("abc123", []byte(legacySnapshot))
+	if err != nil {
+		t.Fatalf("DecodeLegacySession() error = %v", err)
+	}
+
+	if session.SessionID != "abc123" || session.Status != models.StatusAwaitingMoves || session.Version != 0 {
+		t.Errorf("session = %s, status %s, version %d, want abc123 awaiting moves at version 0", session.SessionID, session.Status, session.Version)
+	}
+	if session.Variant != rules.Default || session.Format != match.Default() || session.Scoring != match.Points || session.Mode != models.ModeOpen {
+		t.Errorf("rules = %s, %v, %s, %s, want the classic rules of the first version", session.Variant, session.Format, session.Scoring, session.Mode)
+	}
+	wantPlayers := []models.Player{
+		{ID: "1", HasPlayed: true, Wins: 1, Points: 1},
+		{ID: "2"},
+	}
+	if session.NumPlayers != 2 || !reflect.DeepEqual(session.Players, wantPlayers) {
+		t.Errorf("players = %d seats, %+v, want %+v", session.NumPlayers, session.Players, wantPlayers)
+	}
+	if session.CurrentRound != 3 || session.Draws != 1 || len(session.Results) != 3 {
+		t.Fatalf("round = %d, draws = %d, results = %d, want round 3 with 1 draw and 3 results", session.CurrentRound, session.Draws, len(session.Results))
+	}
+
+	rounds := []struct {
+		choices []string
+		winner  string
+	}{
+		{choices: []string{"rock", "scissors"}, winner: "1"},
+		{choices: []string{"paper", "paper"}, winner: models.Draw},
+		{choices: []string{"scissors"}},
+	}
+	for i, want := range rounds {
+		round := session.Results[i]
+		var choices []string
+		for _, c := range round.Choices {
+			choices = append(choices, c.Choice)
+		}
+		if round.RoundNumber != i+1 || !reflect.DeepEqual(choices, want.choices) || round.WinnerID != want.winner {
+			t.Errorf("round %d = %+v, want choices %v won by %q", i+1, round, want.choices, want.winner)
+		}
+	}
+	if round := session.Results[0]; round.WinningMove != "rock" || round.LosingMove != "scissors" || round.Result == "" {
+		t.Errorf("round 1 = %+v, want rock beating scissors with its result kept", round)
+	}
+
+	// The migrated session goes on where it stopped
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	updated, _, err := engine.Apply(session, engine.Move{Type: models.MessageChoice, PlayerID: "2", Choice: "paper", At: at})
+	if err != nil {
+		t.Fatalf("Apply() on the migrated session error = %v", err)
+	}
+	if updated.Results[2].WinnerID != "1" || updated.Players[0].Wins != 2 || updated.CurrentRound != 4 {
+		t.Errorf("round 3 winner = %q, player 1 wins = %d, round = %d, want player 1 with 2 wins in round 4",
+			updated.Results[2].WinnerID, updated.Players[0].Wins, updated.CurrentRound)
+	}
+}
+
+func TestDecodeLegacySessionFinished(t *testing.T) {
+	snapshot := `{"session_id": "done", "status": "finished", "round": 4, "results": [
+		{"round_number": 1, "player1": {"player_id": "1", "choice": "rock"}, "player2": {"player_id": "2", "choice": "paper"}},
+		{"round_number": 2, "player1": {"player_id": "1", "choice": "rock"}, "player2": {"player_id": "2", "choice": "paper"}},
+		{"round_number": 3, "player1": {"player_id": "1", "choice": "rock"}, "player2": {"player_id": "2", "choice": "paper"}},
+		{"round_number": 4}
+	], "player2_wins": 3, "winner": "Player 2"}`
+
+	session, err := DecodeLegacySession("done", []byte(snapshot))
+	if err != nil {
+		t.Fatalf("DecodeLegacySession() error = %v", err)
+	}
+	if session.Status != models.StatusFinished || session.Winner != "Player 2" || session.Players[1].Wins != 3 {
+		t.Errorf("status = %s, winner = %q, player 2 wins = %d, want a game won by Player 2", session.Status, session.Winner, session.Players[1].Wins)
+	}
+	if _, _, err := engine.Apply(session, engine.Move{Type: models.MessageChoice, PlayerID: "1", Choice: "rock"}); err == nil {
+		t.Errorf("Apply() on a finished migrated session: want an error")
+	}
+
+	for _, bad := range []string{`not json`, `{"round": 2, "results": [{"round_number": 1}]}`} {
+		if _, err := DecodeLegacySession("bad", []byte(bad)); err == nil {
+			t.Errorf("DecodeLegacySession(%s): want an error", bad)
+		}
+	}
+}
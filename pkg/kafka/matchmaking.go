@@ -0,0 +1,134 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"shifumi-game/pkg/matchmaking"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// MatchmakingTopic is the compacted topic holding the matchmaking tickets, keyed by ticket ID
+const MatchmakingTopic = "matchmaking-queue"
+
+// MatchmakerGroup is the consumer group electing the client instance that pairs the players: the
+// member assigned the single partition of the matchmaking topic
+const MatchmakerGroup = "matchmaker"
+
+// SaveTicket publishes a matchmaking ticket
+func SaveTicket(kafkaBroker string, ticket matchmaking.Ticket) error {
+	value, err := json.Marshal(ticket)
+	if err != nil {
+		return err
+	}
+	return WriteRecord(kafkaBroker, MatchmakingTopic, ticket.ID, value)
+}
+
+// SaveTickets publishes matchmaking tickets as a single batch, so that either all of them or none are
+// written
+func SaveTickets(ctx context.Context, kafkaBroker string, tickets ...matchmaking.Ticket) error {
+	records := make([]kafka.Record, len(tickets))
+	for i, ticket := range tickets {
+		value, err := json.Marshal(ticket)
+		if err != nil {
+			return err
+		}
+		records[i] = kafka.Record{Key: kafka.NewBytes([]byte(ticket.ID)), Value: kafka.NewBytes(value)}
+	}
+
+	client := kafka.Client{
+		Addr: kafka.TCP(kafkaBroker),
+	}
+	res, err := client.Produce(ctx, &kafka.ProduceRequest{
+		Topic:        MatchmakingTopic,
+		Partition:    0,
+		RequiredAcks: kafka.RequireAll,
+		Records:      kafka.NewRecordReader(records...),
+	})
+	if err != nil {
+		return err
+	}
+	return res.Error
+}
+
+// DeleteTicket removes a matchmaking ticket
+func DeleteTicket(kafkaBroker string, id string) error {
+	return WriteRecord(kafkaBroker, MatchmakingTopic, id, nil)
+}
+
+// LoadTickets reads the matchmaking topic up to its last ticket into a queue
+func LoadTickets(ctx context.Context, kafkaBroker string, queue *matchmaking.Queue) error {
+	end, err := LastOffset(ctx, kafkaBroker, MatchmakingTopic)
+	if err != nil {
+		return err
+	}
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   []string{kafkaBroker},
+		Topic:     MatchmakingTopic,
+		Partition: 0,
+		MinBytes:  1,
+		MaxBytes:  10e6,
+	})
+	defer reader.Close()
+
+	for offset := int64(-1); offset < end-1; {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return err
+		}
+		offset = msg.Offset
+		if err := putTicket(queue, msg.Key, msg.Value); err != nil {
+			return fmt.Errorf("error loading ticket at offset %d: %w", msg.Offset, err)
+		}
+	}
+	return nil
+}
+
+// LeadMatchmaking joins the matchmaker group and runs lead whenever this instance is the one elected
+// to pair the players, until ctx is cancelled. The ctx of lead is cancelled when the group rebalances,
+// and the instance only rejoins the group once lead has returned, so that two instances never pair
+// players at the same time.
+func LeadMatchmaking(ctx context.Context, kafkaBroker string, lead func(ctx context.Context)) error {
+	group, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:      MatchmakerGroup,
+		Brokers: []string{kafkaBroker},
+		Topics:  []string{MatchmakingTopic},
+	})
+	if err != nil {
+		return err
+	}
+	defer group.Close()
+
+	for {
+		gen, err := group.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if len(gen.Assignments[MatchmakingTopic]) > 0 {
+			gen.Start(lead)
+		}
+	}
+}
+
+// WatchTickets keeps a matchmaking queue in sync with the matchmaking topic until ctx is cancelled,
+// so that the queue survives a restart of the client service
+func WatchTickets(ctx context.Context, kafkaBroker string, queue *matchmaking.Queue) error {
+	return TailTopic(ctx, kafkaBroker, MatchmakingTopic, func(key, value []byte) error {
+		return putTicket(queue, key, value)
+	})
+}
+
+// putTicket applies a record of the matchmaking topic to a queue
+func putTicket(queue *matchmaking.Queue, key, value []byte) error {
+	if value == nil {
+		queue.Remove(string(key))
+		return nil
+	}
+	var ticket matchmaking.Ticket
+	if err := json.Unmarshal(value, &ticket); err != nil {
+		return err
+	}
+	queue.Put(ticket)
+	return nil
+}
@@ -0,0 +1,106 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"shifumi-game/pkg/bot"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// BotRegistryTopic is the compacted topic holding the external bot registrations, keyed by bot name
+const BotRegistryTopic = "bot-registry"
+
+// CreateCompactedTopic creates a single-partition topic that only keeps the latest value of each key
+func CreateCompactedTopic(kafkaBroker string, topic string, replicationFactor int) error {
+	conn, err := kafka.DialLeader(context.Background(), "tcp", kafkaBroker, topic, 0)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.CreateTopics(kafka.TopicConfig{
+		Topic:             topic,
+		NumPartitions:     1,
+		ReplicationFactor: replicationFactor,
+		ConfigEntries: []kafka.ConfigEntry{
+			{ConfigName: "cleanup.policy", ConfigValue: "compact"},
+		},
+	})
+	if err != nil && err != kafka.TopicAlreadyExists {
+		return err
+	}
+	log.Printf("Topic %s is available.", topic)
+	return nil
+}
+
+// WriteRecord writes the value of a key to a compacted topic. A nil value deletes the key.
+func WriteRecord(kafkaBroker string, topic string, key string, value []byte) error {
+	writer := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:  []string{kafkaBroker},
+		Topic:    topic,
+		Balancer: &kafka.LeastBytes{},
+	})
+	defer writer.Close()
+
+	return writer.WriteMessages(context.Background(), kafka.Message{Key: []byte(key), Value: value})
+}
+
+// TailTopic replays a topic from its first offset, then follows it until ctx is cancelled.
+// It reads without a consumer group, so every instance gets the whole topic.
+func TailTopic(ctx context.Context, kafkaBroker string, topic string, handleRecord func(key, value []byte) error) error {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   []string{kafkaBroker},
+		Topic:     topic,
+		Partition: 0,
+		MinBytes:  1,
+		MaxBytes:  10e6,
+	})
+	defer reader.Close()
+
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return err
+		}
+		if err := handleRecord(msg.Key, msg.Value); err != nil {
+			log.Printf(Red+"[ERROR] Error handling record | Topic: %s | Key: %s | Error: %v"+Reset, topic, msg.Key, err)
+		}
+	}
+}
+
+// SaveBotRegistration publishes an external bot registration to the bot registry
+func SaveBotRegistration(kafkaBroker string, reg bot.Registration) error {
+	value, err := json.Marshal(reg)
+	if err != nil {
+		return err
+	}
+	return WriteRecord(kafkaBroker, BotRegistryTopic, reg.Name, value)
+}
+
+// DeleteBotRegistration removes an external bot from the bot registry
+func DeleteBotRegistration(kafkaBroker string, name string) error {
+	return WriteRecord(kafkaBroker, BotRegistryTopic, name, nil)
+}
+
+// WatchBotRegistry keeps the external bots of this instance in sync with the bot registry
+// until ctx is cancelled
+func WatchBotRegistry(ctx context.Context, kafkaBroker string) error {
+	return TailTopic(ctx, kafkaBroker, BotRegistryTopic, func(key, value []byte) error {
+		if value == nil {
+			bot.Unregister(string(key))
+			log.Printf(Yellow+"[INFO] External bot unregistered | Bot: %s"+Reset, key)
+			return nil
+		}
+		var reg bot.Registration
+		if err := json.Unmarshal(value, &reg); err != nil {
+			return err
+		}
+		if err := bot.Register(reg); err != nil {
+			return err
+		}
+		log.Printf(Green+"[INFO] External bot registered | Bot: %s | URL: %s"+Reset, reg.Name, reg.URL)
+		return nil
+	})
+}
@@ -0,0 +1,98 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"shifumi-game/pkg/models"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// GameResultsTopic is the compacted topic holding the latest snapshot of every game session, keyed by
+// session ID
+const GameResultsTopic = "game-results"
+
+// eventsOffsetHeader is the header of a snapshot holding the offset, in the session events topic, of
+// the last record the snapshot includes
+const eventsOffsetHeader = "events-offset"
+
+// SaveGameSession publishes a snapshot of a game session, including the records of the session
+// events topic up to eventsOffset
+func SaveGameSession(kafkaBroker string, session *models.GameSession, eventsOffset int64) error {
+	value, err := json.Marshal(session)
+	if err != nil {
+		log.Printf(Red+"[ERROR] Failed to marshal session | SessionID: %s | Error: %v"+Reset, session.SessionID, err)
+		return err
+	}
+	msg := kafka.Message{
+		Key:     []byte(session.SessionID),
+		Value:   value,
+		Headers: []kafka.Header{{Key: eventsOffsetHeader, Value: []byte(strconv.FormatInt(eventsOffset, 10))}},
+	}
+
+	writer := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:  []string{kafkaBroker},
+		Topic:    GameResultsTopic,
+		Balancer: &kafka.LeastBytes{},
+	})
+	defer writer.Close()
+	if err := writer.WriteMessages(context.Background(), msg); err != nil {
+		log.Printf(Red+"[ERROR] Failed to write session to Kafka topic %s | SessionID: %s | Error: %v"+Reset, GameResultsTopic, session.SessionID, err)
+		return err
+	}
+	log.Printf(Orange+"[INFO] Successfully wrote session snapshot to Kafka topic | SessionID: %s | Version: %d"+Reset, session.SessionID, session.Version)
+	return nil
+}
+
+// WatchGameSessions replays the game-results topic, then follows it until ctx is cancelled, handing
+// every snapshot to handleSession with the offset of the last record of the session events topic it
+// includes. A deleted session is handed over as nil, with the offset -1. caughtUp is called once the
+// snapshots written before the call have all been handed over.
+func WatchGameSessions(ctx context.Context, kafkaBroker string, handleSession func(sessionID string, session *models.GameSession, eventsOffset int64), caughtUp func()) error {
+	end, err := LastOffset(ctx, kafkaBroker, GameResultsTopic)
+	if err != nil {
+		return err
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   []string{kafkaBroker},
+		Topic:     GameResultsTopic,
+		Partition: 0,
+		MinBytes:  1,
+		MaxBytes:  10e6,
+	})
+	defer reader.Close()
+
+	if end == 0 {
+		caughtUp()
+	}
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return err
+		}
+		eventsOffset := int64(-1)
+		for _, h := range msg.Headers {
+			if h.Key == eventsOffsetHeader {
+				if offset, err := strconv.ParseInt(string(h.Value), 10, 64); err == nil {
+					eventsOffset = offset
+				}
+			}
+		}
+		if msg.Value == nil {
+			handleSession(string(msg.Key), nil, eventsOffset)
+		} else {
+			var session models.GameSession
+			if err := json.Unmarshal(msg.Value, &session); err != nil {
+				log.Printf(Red+"[ERROR] Error unmarshalling game session | SessionID: %s | Error: %v"+Reset, msg.Key, err)
+			} else {
+				handleSession(string(msg.Key), &session, eventsOffset)
+			}
+		}
+		if msg.Offset == end-1 {
+			caughtUp()
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package leaderboard
+
+import (
+	"fmt"
+	"shifumi-game/pkg/rating"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Time windows of the tables
+const (
+	Daily   = "daily"    // Games of the last 24 hours
+	Weekly  = "weekly"   // Games of the last 7 days
+	AllTime = "all-time" // Every game
+)
+
+// Ranking orders of the tables
+const (
+	ByWins    = "wins"
+	ByWinRate = "win-rate"
+	ByRating  = "rating"
+	ByStreak  = "streak" // Longest winning streak within the window
+)
+
+// DefaultLimit is the number of entries of a table page when no limit is asked for
+const DefaultLimit = 20
+
+// MaxLimit is the largest number of entries of a table page
+const MaxLimit = 100
+
+// Query selects a page of a table
+type Query struct {
+	Window   string
+	SortBy   string
+	Offset   int
+	Limit    int
+	MinGames int // Players with fewer games in the window are left out
+}
+
+// Validate checks the query and fills in the defaults of unset fields
+func (q *Query) Validate() error {
+	if q.Window == "" {
+		q.Window = AllTime
+	}
+	if q.SortBy == "" {
+		q.SortBy = ByWins
+	}
+	if q.Limit == 0 {
+		q.Limit = DefaultLimit
+	}
+	switch q.Window {
+	case Daily, Weekly, AllTime:
+	default:
+		return fmt.Errorf("unknown window %q (available: %s, %s, %s)", q.Window, Daily, Weekly, AllTime)
+	}
+	switch q.SortBy {
+	case ByWins, ByWinRate, ByRating, ByStreak:
+	default:
+		return fmt.Errorf("unknown ranking %q (available: %s, %s, %s, %s)", q.SortBy, ByWins, ByWinRate, ByRating, ByStreak)
+	}
+	if q.Offset < 0 || q.Limit < 0 || q.Limit > MaxLimit || q.MinGames < 0 {
+		return fmt.Errorf("offset and min games cannot be negative, and limit must be between 1 and %d", MaxLimit)
+	}
+	return nil
+}
+
+// since returns the start of the window at the given time, the zero time for all-time tables
+func since(window string, now time.Time) time.Time {
+	switch window {
+	case Daily:
+		return now.Add(-24 * time.Hour)
+	case Weekly:
+		return now.Add(-7 * 24 * time.Hour)
+	}
+	return time.Time{}
+}
+
+// Entry is the row of a player in a table
+type Entry struct {
+	Rank       int     `json:"rank"`
+	PlayerID   string  `json:"player_id"`
+	Name       string  `json:"name,omitempty"`
+	Games      int     `json:"games"`
+	Wins       int     `json:"wins"`
+	Losses     int     `json:"losses"`
+	Draws      int     `json:"draws"`
+	WinRate    float64 `json:"win_rate"`
+	Rating     float64 `json:"rating"`      // Current rating, whatever the window
+	Streak     int     `json:"streak"`      // Current winning streak
+	BestStreak int     `json:"best_streak"` // Longest winning streak within the window
+}
+
+// Page is a page of a table
+type Page struct {
+	Window  string  `json:"window"`
+	SortBy  string  `json:"sort_by"`
+	Total   int     `json:"total"` // Number of players in the whole table
+	Offset  int     `json:"offset"`
+	Limit   int     `json:"limit"`
+	Entries []Entry `json:"entries"`
+}
+
+// record is a game of a player
+type record struct {
+	sessionID string
+	at        time.Time
+	score     float64 // 1 for a win, 0.5 for a draw, 0 for a loss
+}
+
+// Board is the materialized view of the finished games behind the tables. It is rebuilt by adding every
+// finished game again, each game being counted once.
+type Board struct {
+	mu      sync.RWMutex
+	ratings *rating.Store
+	games   map[string][]record // Games of each player, oldest first
+}
+
+// NewBoard returns an empty board rating players with the given system
+func NewBoard(system rating.System) *Board {
+	return &Board{ratings: rating.NewStore(system), games: map[string][]record{}}
+}
+
+// Add records a finished game. It returns false, without changing anything, if the game was already added.
+func (b *Board) Add(game rating.Game) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.ratings.Apply(game) {
+		return false
+	}
+	for _, id := range game.Players {
+		score := 0.5
+		switch game.Winner {
+		case id:
+			score = 1
+		case "":
+		default:
+			score = 0
+		}
+		games := append(b.games[id], record{sessionID: game.SessionID, at: game.At, score: score})
+		// Games mostly come in order, keep them sorted for the streaks
+		sort.SliceStable(games, func(i, j int) bool { return games[i].at.Before(games[j].at) })
+		b.games[id] = games
+	}
+	return true
+}
+
+// Table returns a page of the table selected by a validated query
+func (b *Board) Table(q Query, now time.Time) Page {
+	b.mu.RLock()
+	start := since(q.Window, now)
+	var entries []Entry
+	for id, games := range b.games {
+		entry := Entry{PlayerID: id}
+		if r, ok := b.ratings.Get(id); ok {
+			entry.Rating = r.Rating
+		}
+		for _, g := range games {
+			if g.at.Before(start) {
+				continue
+			}
+			entry.Games++
+			switch g.score {
+			case 1:
+				entry.Wins++
+				entry.Streak++
+			case 0:
+				entry.Losses++
+				entry.Streak = 0
+			default:
+				entry.Draws++
+				entry.Streak = 0
+			}
+			if entry.Streak > entry.BestStreak {
+				entry.BestStreak = entry.Streak
+			}
+		}
+		if entry.Games == 0 || entry.Games < q.MinGames {
+			continue
+		}
+		entry.WinRate = float64(entry.Wins) / float64(entry.Games)
+		entries = append(entries, entry)
+	}
+	b.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, c := entries[i], entries[j]
+		switch q.SortBy {
+		case ByWinRate:
+			if a.WinRate != c.WinRate {
+				return a.WinRate > c.WinRate
+			}
+		case ByRating:
+			if a.Rating != c.Rating {
+				return a.Rating > c.Rating
+			}
+		case ByStreak:
+			if a.BestStreak != c.BestStreak {
+				return a.BestStreak > c.BestStreak
+			}
+		}
+		if a.Wins != c.Wins {
+			return a.Wins > c.Wins
+		}
+		if a.Games != c.Games {
+			return a.Games < c.Games
+		}
+		return a.PlayerID < c.PlayerID
+	})
+
+	page := Page{Window: q.Window, SortBy: q.SortBy, Total: len(entries), Offset: q.Offset, Limit: q.Limit, Entries: []Entry{}}
+	for i := q.Offset; i < len(entries) && i < q.Offset+q.Limit; i++ {
+		entries[i].Rank = i + 1
+		page.Entries = append(page.Entries, entries[i])
+	}
+	return page
+}
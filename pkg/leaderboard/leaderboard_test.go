@@ -0,0 +1,135 @@
+package leaderboard
+
+import (
+	"shifumi-game/pkg/rating"
+	"sort"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestQueryValidate(t *testing.T) {
+	q := Query{}
+	if err := q.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if q.Window != AllTime || q.SortBy != ByWins || q.Limit != DefaultLimit {
+		t.Errorf("Validate() = %+v, want the all-time table by wins, %d entries", q, DefaultLimit)
+	}
+
+	invalid := []Query{
+		{Window: "monthly"},
+		{SortBy: "losses"},
+		{Offset: -1},
+		{Limit: -1},
+		{Limit: MaxLimit + 1},
+		{MinGames: -1},
+	}
+	for _, q := range invalid {
+		if err := q.Validate(); err == nil {
+			t.Errorf("Validate(%+v): want an error", q)
+		}
+	}
+}
+
+// board returns a board with the games of alice, bob and carol, added out of order
+func board(t *testing.T) *Board {
+	t.Helper()
+	b := NewBoard(rating.EloSystem{K: 32})
+	games := []rating.Game{
+		{SessionID: "3", Players: []string{"alice", "bob"}, Winner: "bob", At: t0.Add(-2 * time.Hour)},
+		{SessionID: "1", Players: []string{"alice", "bob"}, Winner: "alice", At: t0.Add(-10 * 24 * time.Hour)},
+		{SessionID: "2", Players: []string{"alice", "bob"}, Winner: "alice", At: t0.Add(-3 * 24 * time.Hour)},
+		{SessionID: "4", Players: []string{"bob", "carol"}, At: t0.Add(-time.Hour)},
+	}
+	for _, g := range games {
+		if !b.Add(g) {
+			t.Fatalf("Add(%s) = false for a new game", g.SessionID)
+		}
+	}
+	return b
+}
+
+// players returns the player IDs of the entries of a page, in order
+func players(page Page) []string {
+	ids := make([]string, len(page.Entries))
+	for i, e := range page.Entries {
+		ids[i] = e.PlayerID
+	}
+	return ids
+}
+
+func TestBoardTable(t *testing.T) {
+	b := board(t)
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{name: "all-time by wins", query: Query{}, want: []string{"alice", "bob", "carol"}},
+		{name: "weekly by wins, fewer games first", query: Query{Window: Weekly}, want: []string{"alice", "bob", "carol"}},
+		{name: "daily by wins, by player ID last", query: Query{Window: Daily}, want: []string{"bob", "alice", "carol"}},
+		{name: "daily by win rate", query: Query{Window: Daily, SortBy: ByWinRate}, want: []string{"bob", "alice", "carol"}},
+		{name: "all-time by streak", query: Query{SortBy: ByStreak}, want: []string{"alice", "bob", "carol"}},
+		{name: "min games", query: Query{MinGames: 2}, want: []string{"alice", "bob"}},
+		{name: "page", query: Query{Offset: 1, Limit: 1}, want: []string{"bob"}},
+		{name: "past the last page", query: Query{Offset: 5}, want: []string{}},
+	}
+	for _, tt := range tests {
+		if err := tt.query.Validate(); err != nil {
+			t.Fatalf("%s: Validate() error = %v", tt.name, err)
+		}
+		page := b.Table(tt.query, t0)
+		got := players(page)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: Table() = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] || page.Entries[i].Rank != tt.query.Offset+i+1 {
+				t.Errorf("%s: Table() = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+
+	page := b.Table(Query{Offset: 1, Limit: 1, Window: AllTime, SortBy: ByWins}, t0)
+	if page.Total != 3 || page.Offset != 1 || page.Limit != 1 {
+		t.Errorf("Table() page = %d of %d from %d, want 1 of 3 from 1", page.Limit, page.Total, page.Offset)
+	}
+}
+
+func TestBoardEntries(t *testing.T) {
+	b := board(t)
+	entries := map[string]Entry{}
+	for _, e := range b.Table(Query{Window: AllTime, SortBy: ByWins, Limit: DefaultLimit}, t0).Entries {
+		entries[e.PlayerID] = e
+	}
+
+	// The games are counted in the order they were played, not the order they were added
+	alice := entries["alice"]
+	if alice.Games != 3 || alice.Wins != 2 || alice.Losses != 1 || alice.Streak != 0 || alice.BestStreak != 2 {
+		t.Errorf("alice = %+v, want 2 wins then a loss", alice)
+	}
+	bob := entries["bob"]
+	if bob.Games != 4 || bob.Wins != 1 || bob.Losses != 2 || bob.Draws != 1 || bob.WinRate != 0.25 {
+		t.Errorf("bob = %+v, want 1 win, 2 losses and 1 draw", bob)
+	}
+	if r, _ := b.ratings.Get("alice"); alice.Rating != r.Rating {
+		t.Errorf("alice rating = %.1f, want %.1f", alice.Rating, r.Rating)
+	}
+
+	// A game added again is counted once
+	if b.Add(rating.Game{SessionID: "4", Players: []string{"bob", "carol"}, At: t0.Add(-time.Hour)}) {
+		t.Errorf("Add() = true for a game already added")
+	}
+	if carol := b.Table(Query{Window: AllTime, SortBy: ByWins, Limit: DefaultLimit}, t0).Entries[2]; carol.Games != 1 {
+		t.Errorf("carol = %+v, want 1 game", carol)
+	}
+
+	byRating := b.Table(Query{Window: AllTime, SortBy: ByRating, Limit: DefaultLimit}, t0).Entries
+	if !sort.SliceIsSorted(byRating, func(i, j int) bool { return byRating[i].Rating > byRating[j].Rating }) {
+		t.Errorf("Table() by rating = %+v, want the highest rating first", byRating)
+	}
+}
@@ -0,0 +1,174 @@
+package match
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Type is the kind of match format
+type Type string
+
+const (
+	// FirstTo ends the match when a player reaches Target round wins
+	FirstTo Type = "first-to"
+	// BestOf ends the match when a player holds a majority of Target rounds; drawn rounds are replayed
+	BestOf Type = "best-of"
+	// Rounds plays exactly Target rounds, draws included, then applies the tiebreak policy
+	Rounds Type = "rounds"
+)
+
+// Tiebreak decides what happens when a fixed-round match ends level
+type Tiebreak string
+
+const (
+	// TiebreakDraw ends a level match as a draw
+	TiebreakDraw Tiebreak = "draw"
+	// TiebreakSuddenDeath keeps playing rounds until a single player leads
+	TiebreakSuddenDeath Tiebreak = "sudden-death"
+)
+
+// NoWinner is the winner index returned by Decide when a finished match is drawn
+const NoWinner = -1
+
+// Format is the match format picked by the first player when creating a session
+type Format struct {
+	Type     Type     `json:"type"`
+	Target   int      `json:"target"`
+	Tiebreak Tiebreak `json:"tiebreak,omitempty"`
+}
+
+// Default returns the historical format of the game: first to three round wins
+func Default() Format {
+	return Format{Type: FirstTo, Target: 3}
+}
+
+// IsZero reports whether the format was left unset
+func (f Format) IsZero() bool {
+	return f == Format{}
+}
+
+// Normalize returns the format with defaults applied: the default format when unset,
+// and the draw tiebreak for fixed-round matches that do not specify one
+func (f Format) Normalize() Format {
+	if f.IsZero() {
+		return Default()
+	}
+	if f.Type == Rounds && f.Tiebreak == "" {
+		f.Tiebreak = TiebreakDraw
+	}
+	return f
+}
+
+// Validate checks that the format can be played
+func (f Format) Validate() error {
+	f = f.Normalize()
+	if f.Target < 1 {
+		return fmt.Errorf("match format %s: target must be at least 1", f.Type)
+	}
+	switch f.Type {
+	case FirstTo:
+	case BestOf:
+		if f.Target%2 == 0 {
+			return fmt.Errorf("match format %s: target must be odd so that a majority exists", f.Type)
+		}
+	case Rounds:
+		if f.Tiebreak != TiebreakDraw && f.Tiebreak != TiebreakSuddenDeath {
+			return fmt.Errorf("match format %s: unknown tiebreak %q", f.Type, f.Tiebreak)
+		}
+	default:
+		return fmt.Errorf("unknown match format %q", f.Type)
+	}
+	if f.Type != Rounds && f.Tiebreak != "" {
+		return fmt.Errorf("match format %s: tiebreak only applies to %s", f.Type, Rounds)
+	}
+	return nil
+}
+
+// ParseFormat parses the compact form of a format, "<type>:<target>[:<tiebreak>]",
+// e.g. "best-of:5" or "rounds:10:sudden-death"
+func ParseFormat(s string) (Format, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Format{}, fmt.Errorf("invalid match format %q, expected <type>:<target>[:<tiebreak>]", s)
+	}
+	target, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Format{}, fmt.Errorf("invalid match format %q: target must be a number", s)
+	}
+	f := Format{Type: Type(parts[0]), Target: target}
+	if len(parts) == 3 {
+		f.Tiebreak = Tiebreak(parts[2])
+	}
+	if err := f.Validate(); err != nil {
+		return Format{}, err
+	}
+	return f.Normalize(), nil
+}
+
+// WinsNeeded returns the number of round wins that ends the match, or 0 for fixed-round matches
+func (f Format) WinsNeeded() int {
+	f = f.Normalize()
+	switch f.Type {
+	case FirstTo:
+		return f.Target
+	case BestOf:
+		return f.Target/2 + 1
+	}
+	return 0
+}
+
+// String returns the display text of the format, e.g. "best of 5"
+func (f Format) String() string {
+	f = f.Normalize()
+	switch f.Type {
+	case FirstTo:
+		return fmt.Sprintf("first to %d", f.Target)
+	case BestOf:
+		return fmt.Sprintf("best of %d", f.Target)
+	case Rounds:
+		return fmt.Sprintf("%d rounds (tiebreak: %s)", f.Target, f.Tiebreak)
+	}
+	return string(f.Type)
+}
+
+// Decide reports whether the match is over given the score of each player and the number
+// of rounds played so far. winner is the index of the winning player, or NoWinner when the
+// match is not over or ends in a draw.
+func (f Format) Decide(scores []int, roundsPlayed int) (finished bool, winner int) {
+	f = f.Normalize()
+	leader, unique := lead(scores)
+
+	if f.Type == Rounds {
+		if roundsPlayed < f.Target {
+			return false, NoWinner
+		}
+		if unique {
+			return true, leader
+		}
+		if f.Tiebreak == TiebreakSuddenDeath {
+			return false, NoWinner
+		}
+		return true, NoWinner
+	}
+
+	// A shared lead at the target is settled by the next decisive round
+	if unique && scores[leader] >= f.WinsNeeded() {
+		return true, leader
+	}
+	return false, NoWinner
+}
+
+// lead returns the index of the highest score and whether no other player shares it
+func lead(scores []int) (leader int, unique bool) {
+	leader = NoWinner
+	for i, score := range scores {
+		switch {
+		case leader == NoWinner || score > scores[leader]:
+			leader, unique = i, true
+		case score == scores[leader]:
+			unique = false
+		}
+	}
+	return leader, unique
+}
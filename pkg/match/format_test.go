@@ -0,0 +1,73 @@
+package match
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecide(t *testing.T) {
+	tests := []struct {
+		name         string
+		format       Format
+		scores       []int
+		roundsPlayed int
+		wantFinished bool
+		wantWinner   int
+	}{
+		{name: "default format under way", format: Format{}, scores: []int{2, 1}, roundsPlayed: 4, wantWinner: NoWinner},
+		{name: "default format won", format: Format{}, scores: []int{1, 3}, roundsPlayed: 5, wantFinished: true, wantWinner: 1},
+		{name: "first to reached", format: Format{Type: FirstTo, Target: 2}, scores: []int{2, 0, 1}, roundsPlayed: 3, wantFinished: true, wantWinner: 0},
+		{name: "first to with a shared lead", format: Format{Type: FirstTo, Target: 2}, scores: []int{2, 2, 0}, roundsPlayed: 4, wantWinner: NoWinner},
+		{name: "best of majority", format: Format{Type: BestOf, Target: 5}, scores: []int{1, 3}, roundsPlayed: 4, wantFinished: true, wantWinner: 1},
+		{name: "best of short of a majority", format: Format{Type: BestOf, Target: 5}, scores: []int{2, 2}, roundsPlayed: 6, wantWinner: NoWinner},
+		{name: "rounds under way", format: Format{Type: Rounds, Target: 3}, scores: []int{2, 0}, roundsPlayed: 2, wantWinner: NoWinner},
+		{name: "rounds won", format: Format{Type: Rounds, Target: 3}, scores: []int{1, 2}, roundsPlayed: 3, wantFinished: true, wantWinner: 1},
+		{name: "rounds level ends in a draw", format: Format{Type: Rounds, Target: 3}, scores: []int{1, 1}, roundsPlayed: 3, wantFinished: true, wantWinner: NoWinner},
+		{name: "rounds level with sudden death", format: Format{Type: Rounds, Target: 3, Tiebreak: TiebreakSuddenDeath}, scores: []int{1, 1}, roundsPlayed: 3, wantWinner: NoWinner},
+		{name: "sudden death decided", format: Format{Type: Rounds, Target: 3, Tiebreak: TiebreakSuddenDeath}, scores: []int{2, 1}, roundsPlayed: 4, wantFinished: true, wantWinner: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			finished, winner := tt.format.Decide(tt.scores, tt.roundsPlayed)
+			if finished != tt.wantFinished || winner != tt.wantWinner {
+				t.Errorf("Decide(%v, %d) = %t, %d, want %t, %d", tt.scores, tt.roundsPlayed, finished, winner, tt.wantFinished, tt.wantWinner)
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Format
+		wantErr string
+	}{
+		{in: "first-to:3", want: Format{Type: FirstTo, Target: 3}},
+		{in: "best-of:5", want: Format{Type: BestOf, Target: 5}},
+		{in: "rounds:10", want: Format{Type: Rounds, Target: 10, Tiebreak: TiebreakDraw}},
+		{in: "rounds:10:sudden-death", want: Format{Type: Rounds, Target: 10, Tiebreak: TiebreakSuddenDeath}},
+		{in: "best-of", wantErr: "expected <type>:<target>"},
+		{in: "best-of:five", wantErr: "target must be a number"},
+		{in: "best-of:4", wantErr: "target must be odd"},
+		{in: "first-to:0", wantErr: "target must be at least 1"},
+		{in: "sudden:3", wantErr: "unknown match format"},
+		{in: "first-to:3:draw", wantErr: "tiebreak only applies to rounds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseFormat(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseFormat() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFormat() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFormat() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
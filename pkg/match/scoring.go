@@ -0,0 +1,85 @@
+package match
+
+import (
+	"fmt"
+	"shifumi-game/pkg/rules"
+)
+
+// Scoring is how the moves of a round are turned into scores
+type Scoring string
+
+const (
+	// Points credits each move once for every opponent it beats; the match format is applied to the points
+	Points Scoring = "points"
+	// Elimination knocks out every player whose move beats nobody and is beaten; the last player standing wins
+	Elimination Scoring = "elimination"
+)
+
+// Forfeit is the move of a player who missed the round deadline: it beats nothing and is beaten by every move
+const Forfeit = ""
+
+// ValidateScoring checks that the scoring mode is known. An empty mode means Points.
+func ValidateScoring(s Scoring) error {
+	switch s {
+	case "", Points, Elimination:
+		return nil
+	}
+	return fmt.Errorf("unknown scoring %q", s)
+}
+
+// RoundScore is the outcome of a round, indexed like the moves it was computed from
+type RoundScore struct {
+	Points     []int // Number of opponents beaten by each move
+	Beaten     []int // Number of opponents that beat each move
+	Winner     int   // Index of the player who beat the most opponents, or NoWinner if that is shared
+	Eliminated []int // Indexes of the players whose move beats nobody and is beaten
+}
+
+// ScoreRound compares every move of a round against all the others. Forfeited moves lose to every move.
+func ScoreRound(rs rules.Ruleset, moves []string) (RoundScore, error) {
+	score := RoundScore{
+		Points: make([]int, len(moves)),
+		Beaten: make([]int, len(moves)),
+	}
+	for i := range moves {
+		for j := i + 1; j < len(moves); j++ {
+			outcome, err := compare(rs, moves[i], moves[j])
+			if err != nil {
+				return RoundScore{}, err
+			}
+			switch outcome {
+			case rules.Win:
+				score.Points[i]++
+				score.Beaten[j]++
+			case rules.Lose:
+				score.Points[j]++
+				score.Beaten[i]++
+			}
+		}
+	}
+
+	leader, unique := lead(score.Points)
+	score.Winner = NoWinner
+	if unique && score.Points[leader] > 0 {
+		score.Winner = leader
+	}
+	for i := range moves {
+		if score.Points[i] == 0 && score.Beaten[i] > 0 {
+			score.Eliminated = append(score.Eliminated, i)
+		}
+	}
+	return score, nil
+}
+
+// compare returns the outcome of move a against move b, taking forfeits into account
+func compare(rs rules.Ruleset, a, b string) (rules.Outcome, error) {
+	switch {
+	case a == Forfeit && b == Forfeit:
+		return rules.Draw, nil
+	case a == Forfeit:
+		return rules.Lose, nil
+	case b == Forfeit:
+		return rules.Win, nil
+	}
+	return rs.Outcome(a, b)
+}
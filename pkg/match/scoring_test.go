@@ -0,0 +1,61 @@
+package match
+
+import (
+	"reflect"
+	"shifumi-game/pkg/rules"
+	"testing"
+)
+
+func TestScoreRound(t *testing.T) {
+	tests := []struct {
+		name  string
+		moves []string
+		want  RoundScore
+	}{
+		{
+			name:  "two players",
+			moves: []string{"rock", "scissors"},
+			want:  RoundScore{Points: []int{1, 0}, Beaten: []int{0, 1}, Winner: 0, Eliminated: []int{1}},
+		},
+		{
+			name:  "same moves",
+			moves: []string{"paper", "paper", "paper"},
+			want:  RoundScore{Points: []int{0, 0, 0}, Beaten: []int{0, 0, 0}, Winner: NoWinner},
+		},
+		{
+			name:  "every move played",
+			moves: []string{"rock", "paper", "scissors"},
+			want:  RoundScore{Points: []int{1, 1, 1}, Beaten: []int{1, 1, 1}, Winner: NoWinner},
+		},
+		{
+			name:  "shared lead",
+			moves: []string{"rock", "rock", "scissors"},
+			want:  RoundScore{Points: []int{1, 1, 0}, Beaten: []int{0, 0, 2}, Winner: NoWinner, Eliminated: []int{2}},
+		},
+		{
+			name:  "forfeit loses to every move",
+			moves: []string{Forfeit, "scissors", "paper"},
+			want:  RoundScore{Points: []int{0, 2, 1}, Beaten: []int{2, 0, 1}, Winner: 1, Eliminated: []int{0}},
+		},
+		{
+			name:  "every player forfeits",
+			moves: []string{Forfeit, Forfeit},
+			want:  RoundScore{Points: []int{0, 0}, Beaten: []int{0, 0}, Winner: NoWinner},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ScoreRound(rules.Classic(), tt.moves)
+			if err != nil {
+				t.Fatalf("ScoreRound() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ScoreRound(%q) = %+v, want %+v", tt.moves, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ScoreRound(rules.Classic(), []string{"rock", "lizard"}); err == nil {
+		t.Errorf("ScoreRound() with an invalid move: want an error")
+	}
+}
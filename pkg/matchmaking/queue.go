@@ -0,0 +1,254 @@
+package matchmaking
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"shifumi-game/pkg/match"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/rules"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Statuses of a ticket
+const (
+	StatusWaiting = "waiting"
+	StatusMatched = "matched"
+)
+
+// Rating band within which two waiting players can be paired. It widens the longer a player waits.
+const (
+	BaseBand     = 100.0 // Rating difference accepted right away
+	BandPerSec   = 25.0  // Widening of the band per second of waiting
+	MaxBand      = 400.0
+	TicketMaxAge = 10 * time.Minute // Tickets are dropped after waiting this long, or this long after their match
+)
+
+// Ticket is the place of a player in the matchmaking queue. Once the player is paired, it carries
+// the session and seat they were given. The player token of the seat is issued when the player
+// collects it, so that it is never stored in the matchmaking topic.
+type Ticket struct {
+	ID        string                `json:"id"`
+	AccountID string                `json:"account_id,omitempty"` // Empty for anonymous players
+	Rating    float64               `json:"rating"`
+	Options   models.SessionOptions `json:"options"` // Variant, format and mode the player wants to play
+	Status    string                `json:"status"`
+	CreatedAt time.Time             `json:"created_at"`
+
+	// Set once the player is paired
+	SessionID string     `json:"session_id,omitempty"`
+	PlayerID  string     `json:"player_id,omitempty"`
+	MatchedAt *time.Time `json:"matched_at,omitempty"`
+}
+
+// NewTicket returns a waiting ticket with a random ID
+func NewTicket(accountID string, rating float64, opts models.SessionOptions, now time.Time) Ticket {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("matchmaking: cannot read random bytes: %v", err))
+	}
+	return Ticket{
+		ID:        "mm_" + hex.EncodeToString(b),
+		AccountID: accountID,
+		Rating:    rating,
+		Options:   opts,
+		Status:    StatusWaiting,
+		CreatedAt: now.UTC(),
+	}
+}
+
+// Band returns the rating difference the ticket accepts after waiting until now
+func (t Ticket) Band(now time.Time) float64 {
+	return math.Min(BaseBand+BandPerSec*now.Sub(t.CreatedAt).Seconds(), MaxBand)
+}
+
+// Expired returns whether the ticket has waited, or has been matched, for longer than TicketMaxAge
+func (t Ticket) Expired(now time.Time) bool {
+	if t.MatchedAt != nil {
+		return now.Sub(*t.MatchedAt) > TicketMaxAge
+	}
+	return now.Sub(t.CreatedAt) > TicketMaxAge
+}
+
+// preferences are the settings of the session a ticket wants to play, with their defaults applied,
+// so that a ticket leaving a setting out is paired with the tickets asking for its default value
+type preferences struct {
+	variant         string
+	format          match.Format
+	scoring         match.Scoring
+	mode            string
+	numPlayers      int
+	roundTimeout    int
+	timeoutPolicy   string
+	maxMissedRounds int
+	noSpectators    bool
+}
+
+// preferences returns the settings of the session the ticket wants to play
+func (t Ticket) preferences() preferences {
+	session := models.NewGameSession("", t.Options)
+	variant := session.Variant
+	if variant == "" {
+		variant = rules.Default
+	}
+	return preferences{
+		variant:         variant,
+		format:          session.Format,
+		scoring:         session.Scoring,
+		mode:            session.Mode,
+		numPlayers:      session.NumPlayers,
+		roundTimeout:    session.RoundTimeout,
+		timeoutPolicy:   session.TimeoutPolicy,
+		maxMissedRounds: session.MaxMissedRounds,
+		noSpectators:    session.NoSpectators,
+	}
+}
+
+// Queue holds the tickets of the players looking for an opponent, and of the players recently paired
+// until they have collected their seat
+type Queue struct {
+	mu      sync.Mutex
+	tickets map[string]Ticket
+	waiters map[string][]chan Ticket // Requests waiting for a ticket to be matched
+}
+
+// NewQueue returns an empty queue
+func NewQueue() *Queue {
+	return &Queue{tickets: map[string]Ticket{}, waiters: map[string][]chan Ticket{}}
+}
+
+// Put adds or replaces a ticket, and wakes up the requests waiting for it if it is matched. A matched
+// ticket is never put back to waiting, e.g. when the matchmaking topic catches up with an older copy.
+func (q *Queue) Put(t Ticket) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if previous, ok := q.tickets[t.ID]; ok && previous.Status == StatusMatched && t.Status != StatusMatched {
+		return
+	}
+	q.tickets[t.ID] = t
+	if t.Status == StatusMatched {
+		for _, waiter := range q.waiters[t.ID] {
+			waiter <- t
+		}
+		delete(q.waiters, t.ID)
+	}
+}
+
+// Remove drops a ticket
+func (q *Queue) Remove(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.tickets, id)
+}
+
+// Get returns a ticket
+func (q *Queue) Get(id string) (Ticket, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t, ok := q.tickets[id]
+	return t, ok
+}
+
+// Waiting returns the waiting ticket of an account, if any
+func (q *Queue) Waiting(accountID string) (Ticket, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, t := range q.tickets {
+		if accountID != "" && t.AccountID == accountID && t.Status == StatusWaiting {
+			return t, true
+		}
+	}
+	return Ticket{}, false
+}
+
+// Wait returns a ticket once it is matched, or as it is when ctx is done. It returns false if the
+// ticket is not in the queue.
+func (q *Queue) Wait(ctx context.Context, id string) (Ticket, bool) {
+	q.mu.Lock()
+	t, ok := q.tickets[id]
+	if !ok || t.Status == StatusMatched {
+		q.mu.Unlock()
+		return t, ok
+	}
+	waiter := make(chan Ticket, 1)
+	q.waiters[id] = append(q.waiters[id], waiter)
+	q.mu.Unlock()
+
+	select {
+	case t = <-waiter:
+		return t, true
+	case <-ctx.Done():
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		waiters := q.waiters[id]
+		for i := range waiters {
+			if waiters[i] == waiter {
+				q.waiters[id] = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+		t, ok = q.tickets[id]
+		return t, ok
+	}
+}
+
+// Expired returns the tickets that have expired at the given time
+func (q *Queue) Expired(now time.Time) []Ticket {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var expired []Ticket
+	for _, t := range q.tickets {
+		if t.Expired(now) {
+			expired = append(expired, t)
+		}
+	}
+	return expired
+}
+
+// Pairs returns the waiting tickets that can play together at the given time, without changing the
+// queue. Players are paired first come, first served, each with the closest rating among the
+// players who want the same kind of session and are within both rating bands.
+func (q *Queue) Pairs(now time.Time) [][2]Ticket {
+	q.mu.Lock()
+	var waiting []Ticket
+	for _, t := range q.tickets {
+		if t.Status == StatusWaiting && !t.Expired(now) {
+			waiting = append(waiting, t)
+		}
+	}
+	q.mu.Unlock()
+
+	sort.Slice(waiting, func(i, j int) bool {
+		if !waiting[i].CreatedAt.Equal(waiting[j].CreatedAt) {
+			return waiting[i].CreatedAt.Before(waiting[j].CreatedAt)
+		}
+		return waiting[i].ID < waiting[j].ID
+	})
+	var pairs [][2]Ticket
+	paired := map[string]bool{}
+	for i, a := range waiting {
+		if paired[a.ID] {
+			continue
+		}
+		best, bestGap := -1, math.Inf(1)
+		for j := i + 1; j < len(waiting); j++ {
+			b := waiting[j]
+			if paired[b.ID] || a.preferences() != b.preferences() || (a.AccountID != "" && a.AccountID == b.AccountID) {
+				continue
+			}
+			gap := math.Abs(a.Rating - b.Rating)
+			if gap <= a.Band(now) && gap <= b.Band(now) && gap < bestGap {
+				best, bestGap = j, gap
+			}
+		}
+		if best >= 0 {
+			paired[a.ID], paired[waiting[best].ID] = true, true
+			pairs = append(pairs, [2]Ticket{a, waiting[best]})
+		}
+	}
+	return pairs
+}
@@ -0,0 +1,221 @@
+package matchmaking
+
+import (
+	"context"
+	"shifumi-game/pkg/match"
+	"shifumi-game/pkg/models"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// ticket returns a waiting ticket queued at t0 plus a number of seconds
+func ticket(id, accountID string, rating float64, opts models.SessionOptions, seconds int) Ticket {
+	t := NewTicket(accountID, rating, opts, t0.Add(time.Duration(seconds)*time.Second))
+	t.ID = id
+	return t
+}
+
+func TestTicketBandAndExpiry(t *testing.T) {
+	tk := ticket("a", "", 1500, models.SessionOptions{}, 0)
+	bands := []struct {
+		after time.Duration
+		want  float64
+	}{
+		{0, BaseBand},
+		{4 * time.Second, BaseBand + 4*BandPerSec},
+		{time.Hour, MaxBand},
+	}
+	for _, b := range bands {
+		if got := tk.Band(t0.Add(b.after)); got != b.want {
+			t.Errorf("Band() after %s = %.0f, want %.0f", b.after, got, b.want)
+		}
+	}
+
+	if tk.Expired(t0.Add(TicketMaxAge)) || !tk.Expired(t0.Add(TicketMaxAge+time.Second)) {
+		t.Errorf("waiting ticket should expire %s after it was queued", TicketMaxAge)
+	}
+	matchedAt := t0.Add(9 * time.Minute)
+	tk.Status, tk.MatchedAt = StatusMatched, &matchedAt
+	if tk.Expired(t0.Add(TicketMaxAge+time.Second)) || !tk.Expired(matchedAt.Add(TicketMaxAge+time.Second)) {
+		t.Errorf("matched ticket should expire %s after its match", TicketMaxAge)
+	}
+}
+
+func TestPreferences(t *testing.T) {
+	commitReveal := models.SessionOptions{Mode: models.ModeCommitReveal}
+	tests := []struct {
+		name string
+		a, b models.SessionOptions
+		same bool
+	}{
+		{name: "defaults", same: true},
+		{name: "default variant spelled out", b: models.SessionOptions{Variant: "classic"}, same: true},
+		{name: "default format spelled out", b: models.SessionOptions{Format: &match.Format{Type: match.FirstTo, Target: 3}}, same: true},
+		{name: "default players, scoring and mode spelled out", b: models.SessionOptions{Players: 2, Scoring: match.Points, Mode: models.ModeOpen}, same: true},
+		{name: "timeout policy without a round timeout", b: models.SessionOptions{TimeoutPolicy: models.TimeoutRandom}, same: true},
+		{name: "default timeout policy spelled out", a: models.SessionOptions{RoundTimeout: 30}, b: models.SessionOptions{RoundTimeout: 30, TimeoutPolicy: models.TimeoutForfeit}, same: true},
+		{name: "other variant", b: models.SessionOptions{Variant: "rpsls"}},
+		{name: "other format", b: models.SessionOptions{Format: &match.Format{Type: match.BestOf, Target: 5}}},
+		{name: "other mode", b: commitReveal},
+		{name: "other round timeout", a: models.SessionOptions{RoundTimeout: 30}, b: models.SessionOptions{RoundTimeout: 60}},
+		{name: "no spectators", b: models.SessionOptions{NoSpectators: true}},
+	}
+	for _, tt := range tests {
+		a, b := ticket("a", "", 0, tt.a, 0), ticket("b", "", 0, tt.b, 0)
+		if same := a.preferences() == b.preferences(); same != tt.same {
+			t.Errorf("%s: same preferences = %v, want %v", tt.name, same, tt.same)
+		}
+	}
+}
+
+func TestPairs(t *testing.T) {
+	rpsls := models.SessionOptions{Variant: "rpsls"}
+	tests := []struct {
+		name    string
+		tickets []Ticket
+		now     time.Duration
+		want    [][2]string
+	}{
+		{
+			name:    "within the band",
+			tickets: []Ticket{ticket("a", "alice", 1500, models.SessionOptions{}, 0), ticket("b", "bob", 1580, models.SessionOptions{}, 1)},
+			now:     time.Second,
+			want:    [][2]string{{"a", "b"}},
+		},
+		{
+			name:    "outside the band",
+			tickets: []Ticket{ticket("a", "alice", 1500, models.SessionOptions{}, 0), ticket("b", "bob", 1700, models.SessionOptions{}, 0)},
+		},
+		{
+			name:    "band widened by waiting",
+			tickets: []Ticket{ticket("a", "alice", 1500, models.SessionOptions{}, 0), ticket("b", "bob", 1700, models.SessionOptions{}, 0)},
+			now:     4 * time.Second,
+			want:    [][2]string{{"a", "b"}},
+		},
+		{
+			name:    "band of the newer player",
+			tickets: []Ticket{ticket("a", "alice", 1500, models.SessionOptions{}, 0), ticket("b", "bob", 1700, models.SessionOptions{}, 8)},
+			now:     8 * time.Second,
+		},
+		{
+			name:    "different preferences",
+			tickets: []Ticket{ticket("a", "alice", 1500, models.SessionOptions{}, 0), ticket("b", "bob", 1500, rpsls, 0)},
+		},
+		{
+			name:    "same account",
+			tickets: []Ticket{ticket("a", "alice", 1500, models.SessionOptions{}, 0), ticket("b", "alice", 1500, models.SessionOptions{}, 0)},
+		},
+		{
+			name:    "anonymous players",
+			tickets: []Ticket{ticket("a", "", 1500, models.SessionOptions{}, 0), ticket("b", "", 1500, models.SessionOptions{}, 0)},
+			want:    [][2]string{{"a", "b"}},
+		},
+		{
+			name: "first come, closest rating",
+			tickets: []Ticket{
+				ticket("a", "alice", 1500, models.SessionOptions{}, 0),
+				ticket("b", "bob", 1590, models.SessionOptions{}, 1),
+				ticket("c", "carol", 1520, models.SessionOptions{}, 2),
+				ticket("d", "dave", 1600, models.SessionOptions{}, 3),
+			},
+			now:  3 * time.Second,
+			want: [][2]string{{"a", "c"}, {"b", "d"}},
+		},
+		{
+			name:    "expired ticket",
+			tickets: []Ticket{ticket("a", "alice", 1500, models.SessionOptions{}, 0), ticket("b", "bob", 1500, models.SessionOptions{}, 700)},
+			now:     700 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQueue()
+			for _, tk := range tt.tickets {
+				q.Put(tk)
+			}
+			var got [][2]string
+			for _, pair := range q.Pairs(t0.Add(tt.now)) {
+				got = append(got, [2]string{pair[0].ID, pair[1].ID})
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Pairs() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Pairs() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestQueue(t *testing.T) {
+	q := NewQueue()
+	waiting := ticket("a", "alice", 1500, models.SessionOptions{}, 0)
+	q.Put(waiting)
+	if got, ok := q.Waiting("alice"); !ok || got.ID != "a" {
+		t.Errorf("Waiting(alice) = %v, %v, want ticket a", got.ID, ok)
+	}
+	if _, ok := q.Waiting(""); ok {
+		t.Errorf("Waiting() found a ticket for an anonymous player")
+	}
+
+	// A request waiting for the ticket gets it once matched
+	got := make(chan Ticket, 1)
+	go func() {
+		t, _ := q.Wait(context.Background(), "a")
+		got <- t
+	}()
+	matched := waiting
+	matchedAt := t0.Add(5 * time.Minute)
+	matched.Status, matched.SessionID, matched.PlayerID, matched.MatchedAt = StatusMatched, "session-1", "2", &matchedAt
+	for {
+		// The waiter is registered asynchronously
+		q.mu.Lock()
+		registered := len(q.waiters["a"]) > 0
+		q.mu.Unlock()
+		if registered {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	q.Put(matched)
+	select {
+	case tk := <-got:
+		if tk.Status != StatusMatched || tk.SessionID != "session-1" || tk.PlayerID != "2" {
+			t.Errorf("Wait() = %+v, want the seat of the match", tk)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Wait() did not return once the ticket was matched")
+	}
+
+	// An older copy of the ticket does not put it back to waiting
+	q.Put(waiting)
+	if tk, _ := q.Get("a"); tk.Status != StatusMatched {
+		t.Errorf("status = %s after putting back the waiting ticket, want %s", tk.Status, StatusMatched)
+	}
+	if _, ok := q.Waiting("alice"); ok {
+		t.Errorf("Waiting(alice) found the matched ticket")
+	}
+
+	// Waiting for a ticket that is not matched returns it as it is once ctx is done
+	q.Put(ticket("b", "bob", 1500, models.SessionOptions{}, 0))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if tk, ok := q.Wait(ctx, "b"); !ok || tk.Status != StatusWaiting {
+		t.Errorf("Wait(b) = %s, %v, want the waiting ticket", tk.Status, ok)
+	}
+	if _, ok := q.Wait(ctx, "unknown"); ok {
+		t.Errorf("Wait(unknown) found a ticket")
+	}
+
+	if expired := q.Expired(t0.Add(TicketMaxAge + 2*time.Second)); len(expired) != 1 || expired[0].ID != "b" {
+		t.Errorf("Expired() = %v, want ticket b", expired)
+	}
+	q.Remove("b")
+	if _, ok := q.Get("b"); ok {
+		t.Errorf("Get(b) found a removed ticket")
+	}
+}
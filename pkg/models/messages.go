@@ -0,0 +1,76 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Types of the messages published on the player-choices topic
+const (
+	MessageChoice  = "choice"
+	MessageCommit  = "commit"
+	MessageReveal  = "reveal"
+	MessageTimeout = "timeout" // Published by the game-logic service when a round deadline passes
+	MessageJoin    = "join"    // Takes a seat without moving
+	MessagePause   = "pause"
+	MessageResume  = "resume"
+	MessageCancel  = "cancel"
+)
+
+// Envelope is the common part of every message published on the player-choices topic.
+// An empty Type is a choice, as published before message types existed.
+type Envelope struct {
+	Type        string `json:"type,omitempty"`
+	PlayerID    string `json:"player_id"`
+	SessionID   string `json:"session_id"`
+	InitSession bool   `json:"init_session"`
+	AccountID   string `json:"account_id,omitempty"` // Account of the player, empty for anonymous players
+	Token       string `json:"token,omitempty"`      // Player token issued by the client service, see pkg/auth
+	SessionOptions
+}
+
+// PlayerChoice is a move submitted in plaintext
+type PlayerChoice struct {
+	Envelope
+	Choice string `json:"choice"`
+}
+
+// PlayerCommit is the commitment to a move in a commit-reveal session
+type PlayerCommit struct {
+	Envelope
+	Commitment string `json:"commitment"` // See Commitment
+}
+
+// PlayerReveal discloses a committed move once every player has committed
+type PlayerReveal struct {
+	Envelope
+	Choice string `json:"choice"`
+	Salt   string `json:"salt"`
+}
+
+// RoundTimeout signals that the deadline of a round (or phase) has passed. It is ignored if the
+// session has moved on since the deadline was set.
+type RoundTimeout struct {
+	Envelope
+	Round    int       `json:"round"`
+	Phase    string    `json:"phase,omitempty"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// MinSaltLength is the minimum length of the salt of a commitment, in bytes. The commitments are public
+// and there are only a handful of moves, so a short salt would let the opponents find the move by
+// brute force before committing their own.
+const MinSaltLength = 16
+
+// Commitment returns the commitment to a choice: the hex-encoded SHA-256 of "<choice>:<salt>"
+func Commitment(choice, salt string) string {
+	sum := sha256.Sum256([]byte(choice + ":" + salt))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsValidCommitment reports whether commitment looks like the output of Commitment
+func IsValidCommitment(commitment string) bool {
+	b, err := hex.DecodeString(commitment)
+	return err == nil && len(b) == sha256.Size
+}
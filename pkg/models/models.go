@@ -1,32 +1,261 @@
 package models
 
-const MaxPlayers = 2
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"shifumi-game/pkg/match"
+	"shifumi-game/pkg/rules"
+	"strconv"
+	"strings"
+	"time"
+)
 
-type PlayerChoice struct {
-	PlayerID    string `json:"player_id"`
-	SessionID   string `json:"session_id"`
-	Choice      string `json:"choice"`
-	InitSession bool   `json:"init_session"`
+const (
+	MinPlayers = 2
+	MaxPlayers = 8
+)
+
+// Status is the lifecycle state of a game session
+type Status string
+
+const (
+	StatusWaiting       Status = "waiting-for-opponent" // Some seats are still free
+	StatusAwaitingMoves Status = "awaiting-moves"       // Every seat is taken and the current round is waiting for moves
+	StatusRoundResolved Status = "round-resolved"       // A round just ended and nobody has moved in the next one yet
+	StatusPaused        Status = "paused"               // A player paused the game, the round clock is stopped
+	StatusFinished      Status = "finished"
+	StatusAbandoned     Status = "abandoned" // A player missed too many round deadlines
+	StatusCancelled     Status = "cancelled" // A player called the game off before it started or while it was paused
+)
+
+// statusInProgress is the status of the sessions saved before the lifecycle states existed
+const statusInProgress Status = "in progress"
+
+// transitions lists the statuses a session can move to from each status. Staying in the same
+// status is always allowed, and the terminal statuses lead nowhere.
+var transitions = map[Status][]Status{
+	StatusWaiting:       {StatusAwaitingMoves, StatusCancelled},
+	StatusAwaitingMoves: {StatusRoundResolved, StatusPaused, StatusFinished, StatusAbandoned},
+	StatusRoundResolved: {StatusAwaitingMoves, StatusPaused, StatusFinished, StatusAbandoned},
+	StatusPaused:        {StatusAwaitingMoves, StatusCancelled},
+}
+
+// IsTerminal returns whether the session has ended: finished, abandoned or cancelled
+func (s Status) IsTerminal() bool {
+	return s == StatusFinished || s == StatusAbandoned || s == StatusCancelled
+}
+
+// CanTransitionTo returns whether a session can move from status s to next
+func (s Status) CanTransitionTo(next Status) bool {
+	if s == next {
+		return !s.IsTerminal()
+	}
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
 }
 
+// What happens to a player who misses a round deadline
+const (
+	TimeoutForfeit = "forfeit" // The player loses the round
+	TimeoutRandom  = "random"  // A random move is played for the player
+)
+
+// DefaultMaxMissedRounds is the number of consecutive missed deadlines after which a player is dropped
+const DefaultMaxMissedRounds = 3
+
+// Move protocols of a session
+const (
+	ModeOpen         = "open"          // Players submit their choice in plaintext
+	ModeCommitReveal = "commit-reveal" // Players commit to a salted hash, then reveal once every commitment is in
+)
+
+// Round phases of commit-reveal sessions
+const (
+	PhaseCommit = "commit" // Waiting for the commitment of every player
+	PhaseReveal = "reveal" // Every commitment is in, waiting for the reveals
+)
+
+// SessionOptions are the settings Player 1 picks when creating a session
+type SessionOptions struct {
+	Variant string        `json:"variant,omitempty"` // Ruleset of the session
+	Format  *match.Format `json:"format,omitempty"`  // Match format of the session
+	Players int           `json:"players,omitempty"` // Number of players, 2 by default
+	Scoring match.Scoring `json:"scoring,omitempty"` // Scoring mode, points by default
+	Mode    string        `json:"mode,omitempty"`    // Move protocol, open by default
+
+	RoundTimeout    int    `json:"round_timeout,omitempty"`     // Seconds each player has to move in a round, no deadline by default
+	TimeoutPolicy   string `json:"timeout_policy,omitempty"`    // What happens to a player who misses a deadline, forfeit by default
+	MaxMissedRounds int    `json:"max_missed_rounds,omitempty"` // Consecutive missed deadlines before a player is dropped
+
+	Opponent string `json:"opponent,omitempty"` // "bot:<strategy>" or "bot:<external bot>" to play against a bot as Player 2
+
+	// Join policy
+	Private         bool     `json:"private,omitempty"`          // Players need the invite code to take a seat
+	InviteCode      string   `json:"invite_code,omitempty"`      // Invite code or passphrase of a private session, also sent by the players joining it
+	InviteHash      string   `json:"invite_hash,omitempty"`      // See InviteHash: published by the client service in place of the invite code
+	AllowedAccounts []string `json:"allowed_accounts,omitempty"` // Accounts that can take a seat without the invite code
+	NoSpectators    bool     `json:"no_spectators,omitempty"`    // Keeps the session out of the live stats
+}
+
+// IsZero returns whether no option is set. The invite code and its hash are left out, as they are also
+// sent to join a session.
+func (o SessionOptions) IsZero() bool {
+	o.InviteCode, o.InviteHash = "", ""
+	return reflect.DeepEqual(o, SessionOptions{})
+}
+
+// Validate checks the options picked by Player 1. Unset options take their default value. Whether the
+// opponent names a bot that exists is up to the game logic, see engine.ValidateOptions.
+func (o SessionOptions) Validate() error {
+	if _, err := rules.Get(o.Variant); err != nil {
+		return fmt.Errorf("%w (available: %s)", err, strings.Join(rules.Names(), ", "))
+	}
+	if o.Format != nil {
+		if err := o.Format.Validate(); err != nil {
+			return err
+		}
+		// Elimination sessions play until a single player is left
+		if o.Scoring == match.Elimination && o.Format.Normalize() != match.Default() {
+			return fmt.Errorf("match formats do not apply to elimination scoring, which plays until one player is left")
+		}
+	}
+	if o.Players != 0 && (o.Players < MinPlayers || o.Players > MaxPlayers) {
+		return fmt.Errorf("number of players must be between %d and %d", MinPlayers, MaxPlayers)
+	}
+	switch o.Mode {
+	case "", ModeOpen, ModeCommitReveal:
+	default:
+		return fmt.Errorf("unknown mode %q", o.Mode)
+	}
+	if o.RoundTimeout < 0 || o.MaxMissedRounds < 0 {
+		return fmt.Errorf("round timeout and max missed rounds cannot be negative")
+	}
+	switch o.TimeoutPolicy {
+	case "", TimeoutForfeit, TimeoutRandom:
+	default:
+		return fmt.Errorf("unknown timeout policy %q", o.TimeoutPolicy)
+	}
+	if o.Opponent != "" {
+		if o.Players > MinPlayers {
+			return fmt.Errorf("bot opponents can only play 2-player sessions")
+		}
+		if o.Mode == ModeCommitReveal {
+			return fmt.Errorf("bot opponents cannot play commit-reveal sessions")
+		}
+	}
+	if o.InviteCode != "" && (len(o.InviteCode) < 4 || len(o.InviteCode) > 64) {
+		return fmt.Errorf("invite code must be 4 to 64 characters")
+	}
+	for _, accountID := range o.AllowedAccounts {
+		if accountID == "" {
+			return fmt.Errorf("allowed accounts cannot be empty")
+		}
+	}
+	return match.ValidateScoring(o.Scoring)
+}
+
+// Draw is the WinnerID of a round that nobody won outright
+const Draw = "draw"
+
 type RoundResult struct {
-	RoundNumber int           `json:"round_number"`
-	Player1     *PlayerChoice `json:"player1"`
-	Player2     *PlayerChoice `json:"player2"`
-	Result      string        `json:"result"` // Outcome message after each round
+	RoundNumber int            `json:"round_number"`
+	Choices     []PlayerChoice `json:"choices"`
+	Result      string         `json:"result"` // Outcome message after each round, see pkg/render
+
+	// Structured outcome, set once the round is resolved
+	WinnerID    string     `json:"winner_id,omitempty"`    // Player ID of the round winner, Draw when nobody won outright
+	WinningMove string     `json:"winning_move,omitempty"` // Move of the round winner
+	LosingMove  string     `json:"losing_move,omitempty"`  // Move beaten by the winning move, when every beaten player played the same
+	LosingMoves []string   `json:"losing_moves,omitempty"` // Moves beaten by the winning move, one per beaten player in seat order
+	Eliminated  []string   `json:"eliminated,omitempty"`   // Players eliminated in the round
+	Forfeited   []string   `json:"forfeited,omitempty"`    // Players who missed the deadline of the round
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Choice returns the choice made by a player in the round, or nil if the player has not played
+func (r *RoundResult) Choice(playerID string) *PlayerChoice {
+	for i := range r.Choices {
+		if r.Choices[i].PlayerID == playerID {
+			return &r.Choices[i]
+		}
+	}
+	return nil
+}
+
+// Player is the per-player state of a game session
+type Player struct {
+	ID         string `json:"id"`
+	AccountID  string `json:"account_id,omitempty"` // Account of the player, empty for anonymous players and bots
+	Bot        string `json:"bot,omitempty"`        // Strategy of the bot playing this seat, empty for humans
+	HasPlayed  bool   `json:"has_played"`
+	Wins       int    `json:"wins"`   // Rounds won outright
+	Points     int    `json:"points"` // Opponents beaten across all rounds
+	Eliminated bool   `json:"eliminated,omitempty"`
+
+	// Commit-reveal sessions only
+	HasCommitted bool   `json:"has_committed,omitempty"`
+	Commitment   string `json:"commitment,omitempty"`
+
+	// Sessions with round deadlines only
+	HasForfeited bool `json:"has_forfeited,omitempty"` // Missed the deadline of the current round
+	MissedRounds int  `json:"missed_rounds,omitempty"` // Consecutive missed deadlines
 }
 
 type GameSession struct {
-	SessionID        string        `json:"session_id"`
-	Status           string        `json:"status"`
-	CurrentRound     int           `json:"round"`
-	Player1HasPlayed bool          `json:"player_1_has_played"`
-	Player2HasPlayed bool          `json:"player_2_has_played"`
-	Results          []RoundResult `json:"results"`
-	Player1Wins      int           `json:"player1_wins"`
-	Player2Wins      int           `json:"player2_wins"`
-	Draws            int           `json:"draws"`
-	Winner           string        `json:"winner"`
+	SessionID    string        `json:"session_id"`
+	Status       Status        `json:"status"`
+	Variant      string        `json:"variant"`
+	Format       match.Format  `json:"format"`
+	Scoring      match.Scoring `json:"scoring"`
+	Mode         string        `json:"mode"`
+	Phase        string        `json:"phase,omitempty"` // Round phase of commit-reveal sessions
+	NumPlayers   int           `json:"num_players"`     // Number of seats, the game starts once they are all taken
+	Players      []Player      `json:"players"`
+	CurrentRound int           `json:"round"`
+	Results      []RoundResult `json:"results"`
+	Draws        int           `json:"draws"`
+	Winner       string        `json:"winner"`
+
+	RoundTimeout    int        `json:"round_timeout,omitempty"` // Seconds, 0 when rounds have no deadline
+	TimeoutPolicy   string     `json:"timeout_policy,omitempty"`
+	MaxMissedRounds int        `json:"max_missed_rounds,omitempty"`
+	RoundDeadline   *time.Time `json:"round_deadline,omitempty"` // Deadline of the current round (or phase)
+
+	Private         bool     `json:"private,omitempty"`
+	InviteHash      string   `json:"invite_hash,omitempty"` // See InviteHash
+	AllowedAccounts []string `json:"allowed_accounts,omitempty"`
+	NoSpectators    bool     `json:"no_spectators,omitempty"`
+
+	Version     int64         `json:"version"`                // Number of times the session has been stored, see store.SessionStore
+	NextOffsets map[int]int64 `json:"next_offsets,omitempty"` // Offset following the last player message applied, by partition of the player-choices topic
+}
+
+// InviteHash returns the hash of the invite code of a private session, salted with the session ID
+func InviteHash(sessionID, inviteCode string) string {
+	sum := sha256.Sum256([]byte(sessionID + ":" + inviteCode))
+	return hex.EncodeToString(sum[:])
+}
+
+// Admits returns whether a player can take a seat: any player in a public session without an
+// allow-list, an allowed account, or a player with the invite code of a private session, given by
+// its hash (see InviteHash)
+func (s *GameSession) Admits(accountID, inviteHash string) bool {
+	if !s.Private && len(s.AllowedAccounts) == 0 {
+		return true
+	}
+	for _, allowed := range s.AllowedAccounts {
+		if accountID != "" && accountID == allowed {
+			return true
+		}
+	}
+	return s.Private && inviteHash != "" && subtle.ConstantTimeCompare([]byte(inviteHash), []byte(s.InviteHash)) == 1
 }
 
 // Setter for the winner
@@ -39,34 +268,243 @@ func (gs *GameSession) GetWinner() string {
 	return gs.Winner
 }
 
-// NewGameSession creates a new GameSession with default values
-func NewGameSession(sessionID string) *GameSession {
+// NewGameSession creates a new GameSession from the options picked by Player 1, who takes the first seat
+func NewGameSession(sessionID string, opts SessionOptions) *GameSession {
+	format := match.Default()
+	if opts.Format != nil {
+		format = *opts.Format
+	}
+	numPlayers := opts.Players
+	if numPlayers == 0 {
+		numPlayers = MinPlayers
+	}
+	scoring := opts.Scoring
+	if scoring == "" {
+		scoring = match.Points
+	}
+	timeoutPolicy, maxMissedRounds := "", 0
+	if opts.RoundTimeout > 0 {
+		timeoutPolicy, maxMissedRounds = opts.TimeoutPolicy, opts.MaxMissedRounds
+		if timeoutPolicy == "" {
+			timeoutPolicy = TimeoutForfeit
+		}
+		if maxMissedRounds == 0 {
+			maxMissedRounds = DefaultMaxMissedRounds
+		}
+	}
+	players := []Player{{ID: "1"}}
+	if opts.Opponent != "" {
+		players = append(players, Player{ID: "2", Bot: opts.Opponent})
+	}
+	mode, phase := opts.Mode, ""
+	if mode == "" {
+		mode = ModeOpen
+	}
+	if mode == ModeCommitReveal {
+		phase = PhaseCommit
+	}
+	// A passphrase makes the session private. The game-logic service only gets its hash.
+	private, inviteHash := opts.Private || opts.InviteCode != "" || opts.InviteHash != "", opts.InviteHash
+	if private && inviteHash == "" {
+		inviteHash = InviteHash(sessionID, opts.InviteCode)
+	}
+	status := StatusWaiting
+	if len(players) >= numPlayers {
+		status = StatusAwaitingMoves
+	}
 	return &GameSession{
-		SessionID:        sessionID,
-		Status:           "in progress",
-		Results:           []RoundResult{{RoundNumber: 1}},
-		CurrentRound:     1,
-		Player1HasPlayed: false,
-		Player2HasPlayed: false,
+		SessionID: sessionID,
+		Status:    status,
+		Variant:   opts.Variant,
+		Format:    format.Normalize(),
+		Scoring:   scoring,
+		Mode:      mode,
+		Phase:     phase,
+
+		RoundTimeout:    opts.RoundTimeout,
+		TimeoutPolicy:   timeoutPolicy,
+		MaxMissedRounds: maxMissedRounds,
+
+		Private:         private,
+		InviteHash:      inviteHash,
+		AllowedAccounts: opts.AllowedAccounts,
+		NoSpectators:    opts.NoSpectators,
+
+		NumPlayers:   numPlayers,
+		Players:      players,
+		Results:      []RoundResult{{RoundNumber: 1}},
+		CurrentRound: 1,
 	}
 }
 
-// HasPlayer1Played returns whether Player 1 has played this round
-func (s *GameSession) HasPlayer1Played() bool {
-	return s.Player1HasPlayed
+// PlayerName returns the display name of a player, e.g. "Player 1"
+func PlayerName(playerID string) string {
+	return "Player " + playerID
 }
 
-// SetPlayer1HasPlayed sets whether Player 1 has played this round
-func (s *GameSession) SetPlayer1HasPlayed(hasPlayed bool) {
-	s.Player1HasPlayed = hasPlayed
+// Player returns the state of a player, or nil if the player has not joined the session
+func (s *GameSession) Player(playerID string) *Player {
+	for i := range s.Players {
+		if s.Players[i].ID == playerID {
+			return &s.Players[i]
+		}
+	}
+	return nil
 }
 
-// HasPlayer2Played returns whether Player 2 has played this round
-func (s *GameSession) HasPlayer2Played() bool {
-	return s.Player2HasPlayed
+// NextPlayerID returns the ID of the next free seat, or an empty string if the session is full
+func (s *GameSession) NextPlayerID() string {
+	if s.IsFull() {
+		return ""
+	}
+	return strconv.Itoa(len(s.Players) + 1)
 }
 
-// SetPlayer2HasPlayed sets whether Player 2 has played this round
-func (s *GameSession) SetPlayer2HasPlayed(hasPlayed bool) {
-	s.Player2HasPlayed = hasPlayed
+// IsFull returns whether all the seats of the session are taken
+func (s *GameSession) IsFull() bool {
+	return len(s.Players) >= s.NumPlayers
+}
+
+// AddPlayer seats a new player and returns its state
+func (s *GameSession) AddPlayer(playerID string) *Player {
+	s.Players = append(s.Players, Player{ID: playerID})
+	return &s.Players[len(s.Players)-1]
+}
+
+// PlayerByAccount returns the player seated with an account, or nil if the account has no seat in the session
+func (s *GameSession) PlayerByAccount(accountID string) *Player {
+	for i := range s.Players {
+		if accountID != "" && s.Players[i].AccountID == accountID {
+			return &s.Players[i]
+		}
+	}
+	return nil
+}
+
+// ActivePlayers returns the players that have not been eliminated, in seat order
+func (s *GameSession) ActivePlayers() []*Player {
+	var active []*Player
+	for i := range s.Players {
+		if !s.Players[i].Eliminated {
+			active = append(active, &s.Players[i])
+		}
+	}
+	return active
+}
+
+// HaveAllPlayed returns whether every seat is taken and every active player has played this round
+func (s *GameSession) HaveAllPlayed() bool {
+	if !s.IsFull() {
+		return false
+	}
+	for _, p := range s.ActivePlayers() {
+		if !p.HasPlayed && !p.HasForfeited {
+			return false
+		}
+	}
+	return true
+}
+
+// HaveAllCommitted returns whether every seat is taken and every active player has committed this round
+func (s *GameSession) HaveAllCommitted() bool {
+	if !s.IsFull() {
+		return false
+	}
+	for _, p := range s.ActivePlayers() {
+		if !p.HasCommitted && !p.HasForfeited {
+			return false
+		}
+	}
+	return true
+}
+
+// IsCommitmentTaken returns whether another player already committed to the same hash this round
+func (s *GameSession) IsCommitmentTaken(playerID, commitment string) bool {
+	for _, p := range s.Players {
+		if p.ID != playerID && p.HasCommitted && p.Commitment == commitment {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOver returns whether the session has ended: finished, abandoned or cancelled
+func (s *GameSession) IsOver() bool {
+	return s.Status.IsTerminal()
+}
+
+// CurrentStatus returns the status of the session, mapping the status of sessions saved before the
+// lifecycle states existed to the matching state
+func (s *GameSession) CurrentStatus() Status {
+	if s.Status != statusInProgress {
+		return s.Status
+	}
+	if s.IsFull() {
+		return StatusAwaitingMoves
+	}
+	return StatusWaiting
+}
+
+// StartClock sets the deadline of the current round (or phase) when the session has round deadlines
+// and every seat is taken. It clears the deadline otherwise.
+func (s *GameSession) StartClock(now time.Time) {
+	s.RoundDeadline = nil
+	if s.RoundTimeout > 0 && s.IsFull() && !s.IsOver() {
+		deadline := now.Add(time.Duration(s.RoundTimeout) * time.Second)
+		s.RoundDeadline = &deadline
+	}
+}
+
+// ResetPlayed clears the played and committed state of every player for the next round
+func (s *GameSession) ResetPlayed() {
+	for i := range s.Players {
+		s.Players[i].HasPlayed = false
+		s.Players[i].HasForfeited = false
+		s.Players[i].HasCommitted = false
+		s.Players[i].Commitment = ""
+	}
+	if s.Mode == ModeCommitReveal {
+		s.Phase = PhaseCommit
+	}
+}
+
+// Clone returns a deep copy of the session
+func (s *GameSession) Clone() *GameSession {
+	clone := *s
+	clone.Players = append([]Player(nil), s.Players...)
+	clone.AllowedAccounts = append([]string(nil), s.AllowedAccounts...)
+	clone.Results = make([]RoundResult, len(s.Results))
+	for i, r := range s.Results {
+		clone.Results[i] = r
+		clone.Results[i].Choices = append([]PlayerChoice(nil), r.Choices...)
+		clone.Results[i].LosingMoves = append([]string(nil), r.LosingMoves...)
+		clone.Results[i].Eliminated = append([]string(nil), r.Eliminated...)
+		clone.Results[i].Forfeited = append([]string(nil), r.Forfeited...)
+	}
+	if s.RoundDeadline != nil {
+		deadline := *s.RoundDeadline
+		clone.RoundDeadline = &deadline
+	}
+	if s.NextOffsets != nil {
+		clone.NextOffsets = make(map[int]int64, len(s.NextOffsets))
+		for partition, offset := range s.NextOffsets {
+			clone.NextOffsets[partition] = offset
+		}
+	}
+	return &clone
+}
+
+// Applied returns whether the player message at an offset of a partition of the player-choices topic
+// has already been applied to the session. Offsets are only ordered within a partition.
+func (s *GameSession) Applied(partition int, offset int64) bool {
+	return offset < s.NextOffsets[partition]
+}
+
+// SetNextOffset records the offset following the last player message applied from a partition of the
+// player-choices topic
+func (s *GameSession) SetNextOffset(partition int, offset int64) {
+	if s.NextOffsets == nil {
+		s.NextOffsets = map[int]int64{}
+	}
+	s.NextOffsets[partition] = offset
 }
@@ -0,0 +1,172 @@
+package rating
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Rating systems
+const (
+	Elo     = "elo"
+	Glicko2 = "glicko2"
+)
+
+// Default is the rating system used when none is configured
+const Default = Elo
+
+// Rating is the rating of a player after their last rated game
+type Rating struct {
+	PlayerID   string    `json:"player_id"`
+	Rating     float64   `json:"rating"`
+	Deviation  float64   `json:"deviation,omitempty"`  // Glicko-2 only
+	Volatility float64   `json:"volatility,omitempty"` // Glicko-2 only
+	Games      int       `json:"games"`
+	Wins       int       `json:"wins"`
+	Losses     int       `json:"losses"`
+	Draws      int       `json:"draws"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Result is the outcome of a game against one opponent: 1 for a win, 0.5 for a draw, 0 for a loss
+type Result struct {
+	Opponent Rating
+	Score    float64
+}
+
+// System computes the rating of a player after a game
+type System interface {
+	Name() string
+	// Initial returns the rating of a player before their first game
+	Initial(playerID string) Rating
+	// Update returns the rating of a player after a game against one or more opponents, rated before the game
+	Update(player Rating, results []Result) Rating
+}
+
+// New returns the rating system with the given name, the default one for an empty name
+func New(name string) (System, error) {
+	switch name {
+	case "", Elo:
+		return EloSystem{K: 32}, nil
+	case Glicko2:
+		return Glicko2System{Tau: 0.5}, nil
+	}
+	return nil, fmt.Errorf("unknown rating system %q (available: %s, %s)", name, Elo, Glicko2)
+}
+
+// EloSystem is the Elo rating system. In free-for-all games, the change is the average of the changes
+// against each opponent.
+type EloSystem struct {
+	K float64 // Maximum change of a rating in one game
+}
+
+func (e EloSystem) Name() string { return Elo }
+
+func (e EloSystem) Initial(playerID string) Rating {
+	return Rating{PlayerID: playerID, Rating: 1500}
+}
+
+func (e EloSystem) Update(player Rating, results []Result) Rating {
+	if len(results) == 0 {
+		return player
+	}
+	delta := 0.0
+	for _, r := range results {
+		expected := 1 / (1 + math.Pow(10, (r.Opponent.Rating-player.Rating)/400))
+		delta += e.K * (r.Score - expected)
+	}
+	player.Rating += delta / float64(len(results))
+	return player
+}
+
+// Glicko2System is the Glicko-2 rating system, with each game as its own rating period
+type Glicko2System struct {
+	Tau float64 // Constrains the change of volatility over time
+}
+
+// glickoScale converts between the Glicko and Glicko-2 scales
+const glickoScale = 173.7178
+
+func (g Glicko2System) Name() string { return Glicko2 }
+
+func (g Glicko2System) Initial(playerID string) Rating {
+	return Rating{PlayerID: playerID, Rating: 1500, Deviation: 350, Volatility: 0.06}
+}
+
+func (g Glicko2System) Update(player Rating, results []Result) Rating {
+	if len(results) == 0 {
+		return player
+	}
+	mu := (player.Rating - 1500) / glickoScale
+	phi := player.Deviation / glickoScale
+	sigma := player.Volatility
+
+	// Estimated variance and improvement from the game outcomes
+	variance, improvement := 0.0, 0.0
+	for _, r := range results {
+		muJ := (r.Opponent.Rating - 1500) / glickoScale
+		phiJ := r.Opponent.Deviation / glickoScale
+		gJ := 1 / math.Sqrt(1+3*phiJ*phiJ/(math.Pi*math.Pi))
+		expected := 1 / (1 + math.Exp(-gJ*(mu-muJ)))
+		variance += gJ * gJ * expected * (1 - expected)
+		improvement += gJ * (r.Score - expected)
+	}
+	variance = 1 / variance
+	delta := variance * improvement
+
+	sigma = g.volatility(phi, sigma, variance, delta)
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/variance)
+	mu += phi * phi * improvement
+
+	player.Rating = mu*glickoScale + 1500
+	player.Deviation = phi * glickoScale
+	player.Volatility = sigma
+	return player
+}
+
+// volatility returns the new volatility of a player with the Illinois algorithm
+func (g Glicko2System) volatility(phi, sigma, variance, delta float64) float64 {
+	const epsilon = 0.000001
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + variance + ex
+		return ex*(delta*delta-phi*phi-variance-ex)/(2*d*d) - (x-a)/(g.Tau*g.Tau)
+	}
+
+	// A and B bracket the root of f
+	A, B := a, 0.0
+	if delta*delta > phi*phi+variance {
+		B = math.Log(delta*delta - phi*phi - variance)
+	} else {
+		k := 1.0
+		for f(a-k*g.Tau) < 0 {
+			k++
+		}
+		B = a - k*g.Tau
+	}
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
+
+// Sort orders ratings from the highest to the lowest, by player ID for equal ratings
+func Sort(ratings []Rating) {
+	sort.Slice(ratings, func(i, j int) bool {
+		if ratings[i].Rating != ratings[j].Rating {
+			return ratings[i].Rating > ratings[j].Rating
+		}
+		return ratings[i].PlayerID < ratings[j].PlayerID
+	})
+}
@@ -0,0 +1,83 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+// near reports whether two ratings are equal to a tenth of a point
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 0.1
+}
+
+func TestNew(t *testing.T) {
+	for name, want := range map[string]string{"": Elo, Elo: Elo, Glicko2: Glicko2} {
+		system, err := New(name)
+		if err != nil || system.Name() != want {
+			t.Errorf("New(%q) = %v, %v, want %s", name, system, err, want)
+		}
+	}
+	if _, err := New("trueskill"); err == nil {
+		t.Errorf("New(trueskill): want an error")
+	}
+}
+
+func TestElo(t *testing.T) {
+	elo := EloSystem{K: 32}
+	tests := []struct {
+		name    string
+		player  float64
+		results []Result
+		want    float64
+	}{
+		{name: "win between equals", player: 1500, results: []Result{{Opponent: Rating{Rating: 1500}, Score: 1}}, want: 1516},
+		{name: "loss between equals", player: 1500, results: []Result{{Opponent: Rating{Rating: 1500}, Score: 0}}, want: 1484},
+		{name: "draw between equals", player: 1500, results: []Result{{Opponent: Rating{Rating: 1500}, Score: 0.5}}, want: 1500},
+		{name: "win against a stronger player", player: 1500, results: []Result{{Opponent: Rating{Rating: 1900}, Score: 1}}, want: 1529.1},
+		{name: "free-for-all averages the changes", player: 1500, results: []Result{
+			{Opponent: Rating{Rating: 1500}, Score: 1},
+			{Opponent: Rating{Rating: 1500}, Score: 0.5},
+		}, want: 1508},
+		{name: "no opponent", player: 1500, want: 1500},
+	}
+	for _, tt := range tests {
+		got := elo.Update(Rating{Rating: tt.player}, tt.results)
+		if !near(got.Rating, tt.want) {
+			t.Errorf("%s: Update() = %.1f, want %.1f", tt.name, got.Rating, tt.want)
+		}
+	}
+}
+
+func TestGlicko2(t *testing.T) {
+	g := Glicko2System{Tau: 0.5}
+
+	// Example of the Glicko-2 paper, by Mark Glickman
+	player := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+	got := g.Update(player, []Result{
+		{Opponent: Rating{Rating: 1400, Deviation: 30}, Score: 1},
+		{Opponent: Rating{Rating: 1550, Deviation: 100}, Score: 0},
+		{Opponent: Rating{Rating: 1700, Deviation: 300}, Score: 0},
+	})
+	if !near(got.Rating, 1464.06) || !near(got.Deviation, 151.52) || math.Abs(got.Volatility-0.05999) > 0.00001 {
+		t.Errorf("Update() = %.2f (RD %.2f, volatility %.5f), want 1464.06 (RD 151.52, volatility 0.05999)",
+			got.Rating, got.Deviation, got.Volatility)
+	}
+
+	// A first win rates the player up, and makes the rating more certain
+	initial := g.Initial("alice")
+	won := g.Update(initial, []Result{{Opponent: g.Initial("bob"), Score: 1}})
+	if won.Rating <= initial.Rating || won.Deviation >= initial.Deviation {
+		t.Errorf("Update() after a win = %.1f (RD %.1f), want above %.1f (RD below %.1f)",
+			won.Rating, won.Deviation, initial.Rating, initial.Deviation)
+	}
+}
+
+func TestSort(t *testing.T) {
+	ratings := []Rating{{PlayerID: "carol", Rating: 1500}, {PlayerID: "bob", Rating: 1600}, {PlayerID: "alice", Rating: 1500}}
+	Sort(ratings)
+	for i, want := range []string{"bob", "alice", "carol"} {
+		if ratings[i].PlayerID != want {
+			t.Errorf("Sort()[%d] = %s, want %s", i, ratings[i].PlayerID, want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package rating
+
+import (
+	"shifumi-game/pkg/models"
+	"sync"
+	"time"
+)
+
+// Game is a finished game between rated players
+type Game struct {
+	SessionID string
+	Players   []string // Account IDs of the rated players
+	Winner    string   // Account ID of the winner, empty when no rated player won
+	At        time.Time
+}
+
+// GameFromSession returns the rated game of a finished session. Only players with an account are
+// rated: the winner beats every other rated player, and the others draw with each other. It returns
+// false when the session is not finished or has fewer than two rated players.
+func GameFromSession(session *models.GameSession) (Game, bool) {
+	if session.CurrentStatus() != models.StatusFinished {
+		return Game{}, false
+	}
+	game := Game{SessionID: session.SessionID}
+	for _, p := range session.Players {
+		if p.AccountID == "" {
+			continue
+		}
+		game.Players = append(game.Players, p.AccountID)
+		if session.Winner != "" && session.Winner == models.PlayerName(p.ID) {
+			game.Winner = p.AccountID
+		}
+	}
+	for _, r := range session.Results {
+		if r.ResolvedAt != nil && r.ResolvedAt.After(game.At) {
+			game.At = *r.ResolvedAt
+		}
+	}
+	return game, len(game.Players) >= 2
+}
+
+// Change is an entry of the rating history of a player
+type Change struct {
+	SessionID string    `json:"session_id"`
+	Rating    float64   `json:"rating"` // Rating after the game
+	Delta     float64   `json:"delta"`
+	Deviation float64   `json:"deviation,omitempty"`
+	Score     float64   `json:"score"` // 1 for a win, 0.5 for a draw, 0 for a loss
+	At        time.Time `json:"at"`
+}
+
+// Store keeps the ratings of the players and applies every game once, so that replaying the
+// finished games does not count them twice. It is held in memory only: the rating service rebuilds it
+// on startup by replaying the compacted finished-games topic, which keeps the last snapshot of every
+// finished session, so a game is rated once per replay and in the order of the topic.
+type Store struct {
+	mu      sync.RWMutex
+	system  System
+	ratings map[string]Rating
+	history map[string][]Change
+	applied map[string]bool // Session IDs of the games already rated
+}
+
+// NewStore returns an empty store rating players with the given system
+func NewStore(system System) *Store {
+	return &Store{
+		system:  system,
+		ratings: map[string]Rating{},
+		history: map[string][]Change{},
+		applied: map[string]bool{},
+	}
+}
+
+// System returns the rating system of the store
+func (s *Store) System() System {
+	return s.system
+}
+
+// Apply updates the ratings of the players of a game. It returns false, without changing anything,
+// if the game was already rated.
+func (s *Store) Apply(game Game) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.applied[game.SessionID] {
+		return false
+	}
+	s.applied[game.SessionID] = true
+
+	// Every player is rated against the ratings of their opponents before the game
+	before := make(map[string]Rating, len(game.Players))
+	for _, id := range game.Players {
+		before[id] = s.rating(id)
+	}
+	for _, id := range game.Players {
+		var results []Result
+		score := 0.0
+		for _, opponent := range game.Players {
+			if opponent == id {
+				continue
+			}
+			result := Result{Opponent: before[opponent], Score: 0.5}
+			switch game.Winner {
+			case id:
+				result.Score = 1
+			case opponent:
+				result.Score = 0
+			}
+			results = append(results, result)
+			score += result.Score
+		}
+		score /= float64(len(results))
+
+		updated := s.system.Update(before[id], results)
+		updated.Games++
+		switch {
+		case game.Winner == id:
+			updated.Wins++
+		case game.Winner == "":
+			updated.Draws++
+		default:
+			updated.Losses++
+		}
+		updated.UpdatedAt = game.At
+		s.ratings[id] = updated
+		s.history[id] = append(s.history[id], Change{
+			SessionID: game.SessionID,
+			Rating:    updated.Rating,
+			Delta:     updated.Rating - before[id].Rating,
+			Deviation: updated.Deviation,
+			Score:     score,
+			At:        game.At,
+		})
+	}
+	return true
+}
+
+// rating returns the current rating of a player, or their initial rating before their first game
+func (s *Store) rating(playerID string) Rating {
+	if r, ok := s.ratings[playerID]; ok {
+		return r
+	}
+	return s.system.Initial(playerID)
+}
+
+// Get returns the rating of a player, false if the player has no rated game
+func (s *Store) Get(playerID string) (Rating, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.ratings[playerID]
+	return r, ok
+}
+
+// History returns the rating changes of a player, oldest first
+func (s *Store) History(playerID string) []Change {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Change(nil), s.history[playerID]...)
+}
+
+// All returns the ratings of every rated player, highest first
+func (s *Store) All() []Rating {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ratings := make([]Rating, 0, len(s.ratings))
+	for _, r := range s.ratings {
+		ratings = append(ratings, r)
+	}
+	Sort(ratings)
+	return ratings
+}
@@ -0,0 +1,100 @@
+package rating
+
+import (
+	"shifumi-game/pkg/models"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestGameFromSession(t *testing.T) {
+	t1 := t0.Add(time.Minute)
+	finished := func(winner string, players ...models.Player) *models.GameSession {
+		return &models.GameSession{
+			SessionID: "session-1",
+			Status:    models.StatusFinished,
+			Players:   players,
+			Winner:    winner,
+			Results:   []models.RoundResult{{RoundNumber: 1, ResolvedAt: &t0}, {RoundNumber: 2, ResolvedAt: &t1}},
+		}
+	}
+	alice, bob := models.Player{ID: "1", AccountID: "alice"}, models.Player{ID: "2", AccountID: "bob"}
+	anonymous := models.Player{ID: "3"}
+
+	tests := []struct {
+		name    string
+		session *models.GameSession
+		want    Game
+		ok      bool
+	}{
+		{
+			name:    "won",
+			session: finished(models.PlayerName("2"), alice, bob),
+			want:    Game{SessionID: "session-1", Players: []string{"alice", "bob"}, Winner: "bob", At: t1},
+			ok:      true,
+		},
+		{
+			name:    "won by an anonymous player",
+			session: finished(models.PlayerName("3"), alice, bob, anonymous),
+			want:    Game{SessionID: "session-1", Players: []string{"alice", "bob"}, At: t1},
+			ok:      true,
+		},
+		{name: "one rated player", session: finished(models.PlayerName("1"), alice, anonymous)},
+		{name: "not finished", session: &models.GameSession{SessionID: "session-1", Status: models.StatusAbandoned, Players: []models.Player{alice, bob}}},
+	}
+	for _, tt := range tests {
+		got, ok := GameFromSession(tt.session)
+		if ok != tt.ok {
+			t.Errorf("%s: GameFromSession() ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if got.SessionID != tt.want.SessionID || got.Winner != tt.want.Winner || !got.At.Equal(tt.want.At) ||
+			len(got.Players) != len(tt.want.Players) || got.Players[0] != tt.want.Players[0] || got.Players[1] != tt.want.Players[1] {
+			t.Errorf("%s: GameFromSession() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStoreApply(t *testing.T) {
+	store := NewStore(EloSystem{K: 32})
+	game := Game{SessionID: "session-1", Players: []string{"alice", "bob"}, Winner: "alice", At: t0}
+	if !store.Apply(game) {
+		t.Fatalf("Apply() = false for a new game")
+	}
+
+	// A replayed game is not rated twice
+	if store.Apply(game) {
+		t.Errorf("Apply() = true for a game already rated")
+	}
+	alice, _ := store.Get("alice")
+	bob, _ := store.Get("bob")
+	if alice.Rating != 1516 || alice.Games != 1 || alice.Wins != 1 || !alice.UpdatedAt.Equal(t0) {
+		t.Errorf("alice = %+v, want 1516 after 1 win", alice)
+	}
+	if bob.Rating != 1484 || bob.Games != 1 || bob.Losses != 1 {
+		t.Errorf("bob = %+v, want 1484 after 1 loss", bob)
+	}
+	if _, ok := store.Get("carol"); ok {
+		t.Errorf("Get(carol) found a player without a rated game")
+	}
+
+	// Every player is rated against the ratings of their opponents before the game
+	store.Apply(Game{SessionID: "session-2", Players: []string{"alice", "bob", "carol"}, At: t0.Add(time.Minute)})
+	history := store.History("alice")
+	if len(history) != 2 || history[0].SessionID != "session-1" || history[0].Delta != 16 || history[0].Score != 1 || history[1].Score != 0.5 {
+		t.Errorf("History(alice) = %+v, want a win then a draw", history)
+	}
+	carol, _ := store.Get("carol")
+	if carol.Draws != 1 || !near(carol.Rating, 1500) {
+		t.Errorf("carol = %+v, want 1500 after a draw against a 1516 and a 1484", carol)
+	}
+
+	all := store.All()
+	if len(all) != 3 || all[0].PlayerID != "alice" || all[2].PlayerID != "bob" {
+		t.Errorf("All() = %+v, want alice, carol, bob", all)
+	}
+}
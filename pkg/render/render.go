@@ -0,0 +1,239 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/rules"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Style is how moves and outcomes are drawn
+type Style string
+
+const (
+	Plain Style = "plain" // Move names, no emoji: "Player 1 wins (rock, scissors)"
+	Emoji Style = "emoji" // Move symbols and outcome emoji: "Player 1 wins 🪨✂️ → 🥇"
+)
+
+// DefaultLocale is the locale of the round results stored in the sessions
+const DefaultLocale = "en"
+
+// Templates are the text/template sources of a locale. Round templates get a RoundData.
+type Templates struct {
+	Player     string `json:"player" yaml:"player"`         // Display name of a player, from its ID
+	Win        string `json:"win" yaml:"win"`               // A player won the round outright
+	Draw       string `json:"draw" yaml:"draw"`             // Nobody won the round
+	Eliminated string `json:"eliminated" yaml:"eliminated"` // Players were eliminated in the round
+}
+
+// RoundData is what the round templates are executed with
+type RoundData struct {
+	Winner     string // Display name of the round winner
+	Eliminated string // Display names of the eliminated players, comma separated
+	Moves      string // Moves of the round, drawn in the style of the formatter
+	Emoji      bool   // Whether the formatter uses the emoji style
+}
+
+var builtinTemplates = map[string]Templates{
+	"en": {
+		Player:     `Player {{.}}`,
+		Win:        `{{.Winner}} wins {{.Moves}}{{if .Emoji}} → 🥇{{end}}`,
+		Draw:       `Draw {{.Moves}}{{if .Emoji}} → 🤝{{end}}`,
+		Eliminated: `{{.Eliminated}} eliminated {{.Moves}}{{if .Emoji}} → 🚪{{end}}`,
+	},
+	"fr": {
+		Player:     `Joueur {{.}}`,
+		Win:        `{{.Winner}} gagne {{.Moves}}{{if .Emoji}} → 🥇{{end}}`,
+		Draw:       `Égalité {{.Moves}}{{if .Emoji}} → 🤝{{end}}`,
+		Eliminated: `{{.Eliminated}} éliminé(s) {{.Moves}}{{if .Emoji}} → 🚪{{end}}`,
+	},
+}
+
+// locale holds the parsed templates of a locale
+type locale struct {
+	player, win, draw, eliminated *template.Template
+}
+
+var (
+	mu      sync.RWMutex
+	locales = map[string]*locale{}
+)
+
+func init() {
+	for name, t := range builtinTemplates {
+		if err := RegisterLocale(name, t); err != nil {
+			panic(fmt.Sprintf("render: invalid built-in templates for %s: %v", name, err))
+		}
+	}
+}
+
+// RegisterLocale adds or replaces the templates of a locale
+func RegisterLocale(name string, t Templates) error {
+	l := &locale{}
+	for _, tmpl := range []struct {
+		dst  **template.Template
+		name string
+		src  string
+	}{
+		{&l.player, "player", t.Player},
+		{&l.win, "win", t.Win},
+		{&l.draw, "draw", t.Draw},
+		{&l.eliminated, "eliminated", t.Eliminated},
+	} {
+		if tmpl.src == "" {
+			return fmt.Errorf("locale %s: %s template is required", name, tmpl.name)
+		}
+		parsed, err := template.New(tmpl.name).Parse(tmpl.src)
+		if err != nil {
+			return fmt.Errorf("locale %s: %w", name, err)
+		}
+		*tmpl.dst = parsed
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	locales[name] = l
+	return nil
+}
+
+// Locales returns the names of the registered locales, sorted alphabetically
+func Locales() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(locales))
+	for name := range locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Formatter renders round outcomes in a style and locale
+type Formatter struct {
+	style  Style
+	locale *locale
+}
+
+// New returns the formatter of a style and locale. An empty style is Emoji, an empty locale is DefaultLocale.
+func New(style Style, localeName string) (*Formatter, error) {
+	switch style {
+	case "":
+		style = Emoji
+	case Plain, Emoji:
+	default:
+		return nil, fmt.Errorf("unknown style %q, expected %s or %s", style, Plain, Emoji)
+	}
+	if localeName == "" {
+		localeName = DefaultLocale
+	}
+	mu.RLock()
+	l, ok := locales[localeName]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown locale %q (available: %s)", localeName, strings.Join(Locales(), ", "))
+	}
+	return &Formatter{style: style, locale: l}, nil
+}
+
+// Default returns the formatter of the round results stored in the sessions: emoji, in English
+func Default() *Formatter {
+	f, _ := New(Emoji, DefaultLocale)
+	return f
+}
+
+// Player returns the display name of a player
+func (f *Formatter) Player(playerID string) string {
+	return execute(f.locale.player, playerID)
+}
+
+// Round renders the outcome of a resolved round
+func (f *Formatter) Round(rs rules.Ruleset, r *models.RoundResult) string {
+	data := RoundData{Moves: f.moves(rs, r), Emoji: f.style == Emoji}
+	switch {
+	case len(r.Eliminated) > 0:
+		names := make([]string, len(r.Eliminated))
+		for i, id := range r.Eliminated {
+			names[i] = f.Player(id)
+		}
+		data.Eliminated = strings.Join(names, ", ")
+		return execute(f.locale.eliminated, data)
+	case r.WinnerID != "" && r.WinnerID != models.Draw:
+		data.Winner = f.Player(r.WinnerID)
+		return execute(f.locale.win, data)
+	default:
+		return execute(f.locale.draw, data)
+	}
+}
+
+// moves draws the moves of a round in seat order, with a placeholder for the players who missed the deadline
+func (f *Formatter) moves(rs rules.Ruleset, r *models.RoundResult) string {
+	type seat struct {
+		playerID string
+		move     string
+	}
+	seats := make([]seat, 0, len(r.Choices)+len(r.Forfeited))
+	for _, c := range r.Choices {
+		seats = append(seats, seat{c.PlayerID, c.Choice})
+	}
+	for _, id := range r.Forfeited {
+		seats = append(seats, seat{id, ""})
+	}
+	sort.SliceStable(seats, func(i, j int) bool { return seatNumber(seats[i].playerID) < seatNumber(seats[j].playerID) })
+
+	if f.style == Emoji {
+		symbols := ""
+		for _, s := range seats {
+			if s.move == "" {
+				symbols += "⌛"
+			} else {
+				symbols += rs.Symbol(s.move)
+			}
+		}
+		return symbols
+	}
+	names := make([]string, len(seats))
+	for i, s := range seats {
+		names[i] = s.move
+		if s.move == "" {
+			names[i] = "-"
+		}
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+// seatNumber returns the seat of a player from its ID, "1" being the first seat
+func seatNumber(playerID string) int {
+	n, err := strconv.Atoi(playerID)
+	if err != nil {
+		return models.MaxPlayers + 1
+	}
+	return n
+}
+
+// Session returns a copy of the session with its round results rendered by the formatter
+func (f *Formatter) Session(session *models.GameSession) *models.GameSession {
+	rendered := session.Clone()
+	rs, err := rules.Get(session.Variant)
+	if err != nil {
+		return rendered
+	}
+	for i := range rendered.Results {
+		if rendered.Results[i].ResolvedAt != nil {
+			rendered.Results[i].Result = f.Round(rs, &rendered.Results[i])
+		}
+	}
+	return rendered
+}
+
+func execute(t *template.Template, data interface{}) string {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return fmt.Sprintf("%v", data)
+	}
+	return buf.String()
+}
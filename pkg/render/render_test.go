@@ -0,0 +1,124 @@
+package render
+
+import (
+	"shifumi-game/pkg/models"
+	"shifumi-game/pkg/rules"
+	"testing"
+	"time"
+)
+
+// choice returns the move of a player in a round
+func choice(playerID, move string) models.PlayerChoice {
+	return models.PlayerChoice{Envelope: models.Envelope{PlayerID: playerID}, Choice: move}
+}
+
+func TestRound(t *testing.T) {
+	rs := rules.Classic()
+	won := &models.RoundResult{Choices: []models.PlayerChoice{choice("2", "scissors"), choice("1", "rock")}, WinnerID: "1"}
+	drawn := &models.RoundResult{Choices: []models.PlayerChoice{choice("1", "rock"), choice("2", "rock")}, WinnerID: models.Draw}
+	forfeited := &models.RoundResult{Choices: []models.PlayerChoice{choice("2", "paper")}, Forfeited: []string{"1"}, WinnerID: "2"}
+	eliminated := &models.RoundResult{
+		Choices:    []models.PlayerChoice{choice("1", "rock"), choice("2", "scissors"), choice("3", "scissors")},
+		Eliminated: []string{"2", "3"},
+	}
+
+	tests := []struct {
+		style  Style
+		locale string
+		round  *models.RoundResult
+		want   string
+	}{
+		{Plain, "en", won, "Player 1 wins (rock, scissors)"},
+		{Emoji, "en", won, "Player 1 wins 🪨✂️ → 🥇"},
+		{Plain, "en", drawn, "Draw (rock, rock)"},
+		{Emoji, "en", drawn, "Draw 🪨🪨 → 🤝"},
+		{Plain, "en", forfeited, "Player 2 wins (-, paper)"},
+		{Emoji, "en", forfeited, "Player 2 wins ⌛📄 → 🥇"},
+		{Plain, "en", eliminated, "Player 2, Player 3 eliminated (rock, scissors, scissors)"},
+		{Plain, "fr", won, "Joueur 1 gagne (rock, scissors)"},
+		{Emoji, "fr", eliminated, "Joueur 2, Joueur 3 éliminé(s) 🪨✂️✂️ → 🚪"},
+	}
+	for _, tt := range tests {
+		f, err := New(tt.style, tt.locale)
+		if err != nil {
+			t.Fatalf("New(%s, %s) error = %v", tt.style, tt.locale, err)
+		}
+		if got := f.Round(rs, tt.round); got != tt.want {
+			t.Errorf("Round() in %s/%s = %q, want %q", tt.style, tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	f, err := New("", "")
+	if err != nil || f.style != Emoji || f.Player("1") != "Player 1" {
+		t.Errorf("New() = %+v, %v, want the emoji style in English", f, err)
+	}
+	if _, err := New("ascii", ""); err == nil {
+		t.Errorf("New(ascii): want an error")
+	}
+	if _, err := New(Plain, "xx"); err == nil {
+		t.Errorf("New(xx): want an error")
+	}
+}
+
+func TestRegisterLocale(t *testing.T) {
+	templates := Templates{
+		Player:     `Spieler {{.}}`,
+		Win:        `{{.Winner}} gewinnt {{.Moves}}`,
+		Draw:       `Unentschieden {{.Moves}}`,
+		Eliminated: `{{.Eliminated}} ausgeschieden {{.Moves}}`,
+	}
+	if err := RegisterLocale("de", templates); err != nil {
+		t.Fatalf("RegisterLocale() error = %v", err)
+	}
+	f, err := New(Plain, "de")
+	if err != nil {
+		t.Fatalf("New(de) error = %v", err)
+	}
+	round := &models.RoundResult{Choices: []models.PlayerChoice{choice("1", "paper"), choice("2", "rock")}, WinnerID: "1"}
+	if got := f.Round(rules.Classic(), round); got != "Spieler 1 gewinnt (paper, rock)" {
+		t.Errorf("Round() in de = %q", got)
+	}
+	found := false
+	for _, name := range Locales() {
+		found = found || name == "de"
+	}
+	if !found {
+		t.Errorf("Locales() = %v, want de", Locales())
+	}
+
+	missing := templates
+	missing.Draw = ""
+	if err := RegisterLocale("de-missing", missing); err == nil {
+		t.Errorf("RegisterLocale() without a draw template: want an error")
+	}
+	invalid := templates
+	invalid.Win = `{{.Winner`
+	if err := RegisterLocale("de-invalid", invalid); err == nil {
+		t.Errorf("RegisterLocale() with an invalid template: want an error")
+	}
+}
+
+func TestSession(t *testing.T) {
+	resolvedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	session := &models.GameSession{
+		SessionID: "session-1",
+		Variant:   rules.Default,
+		Results: []models.RoundResult{
+			{RoundNumber: 1, Choices: []models.PlayerChoice{choice("1", "rock"), choice("2", "paper")}, WinnerID: "2", Result: "stored", ResolvedAt: &resolvedAt},
+			{RoundNumber: 2, Choices: []models.PlayerChoice{choice("1", "rock")}},
+		},
+	}
+	f, _ := New(Plain, "fr")
+	rendered := f.Session(session)
+	if got := rendered.Results[0].Result; got != "Joueur 2 gagne (rock, paper)" {
+		t.Errorf("Session() resolved round = %q", got)
+	}
+	if rendered.Results[1].Result != "" {
+		t.Errorf("Session() rendered the round in progress: %q", rendered.Results[1].Result)
+	}
+	if session.Results[0].Result != "stored" {
+		t.Errorf("Session() changed the session: %q, want the stored result", session.Results[0].Result)
+	}
+}
@@ -0,0 +1,192 @@
+package rules
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed builtin/*.yaml
+var builtinFS embed.FS
+
+// Definition is the file representation of a ruleset: a list of moves plus a directed
+// "beats" graph. Beats maps a winning move to the moves it beats, each with an optional
+// verb used for display ("rock crushes scissors").
+type Definition struct {
+	Name    string                       `json:"name" yaml:"name"`
+	Moves   []string                     `json:"moves" yaml:"moves"`
+	Beats   map[string]map[string]string `json:"beats" yaml:"beats"`
+	Symbols map[string]string            `json:"symbols,omitempty" yaml:"symbols,omitempty"`
+}
+
+// Validate checks that the definition is well formed and that its graph is balanced:
+// every move beats and loses to the same number of moves, so no move is stronger than another.
+func (d *Definition) Validate() error {
+	if d.Name == "" {
+		return errors.New("ruleset name is required")
+	}
+	if len(d.Moves) < 2 {
+		return fmt.Errorf("ruleset %s: at least two moves are required", d.Name)
+	}
+
+	known := make(map[string]bool, len(d.Moves))
+	for _, move := range d.Moves {
+		if move == "" {
+			return fmt.Errorf("ruleset %s: empty move name", d.Name)
+		}
+		if known[move] {
+			return fmt.Errorf("ruleset %s: duplicate move %q", d.Name, move)
+		}
+		known[move] = true
+	}
+
+	losses := make(map[string]int, len(d.Moves))
+	for winner, losers := range d.Beats {
+		if !known[winner] {
+			return fmt.Errorf("ruleset %s: beats references unknown move %q", d.Name, winner)
+		}
+		for loser := range losers {
+			if !known[loser] {
+				return fmt.Errorf("ruleset %s: %s beats unknown move %q", d.Name, winner, loser)
+			}
+			if loser == winner {
+				return fmt.Errorf("ruleset %s: %s cannot beat itself", d.Name, winner)
+			}
+			if _, ok := d.Beats[loser][winner]; ok {
+				return fmt.Errorf("ruleset %s: %s and %s beat each other", d.Name, winner, loser)
+			}
+			losses[loser]++
+		}
+	}
+
+	wins := len(d.Beats[d.Moves[0]])
+	if wins == 0 {
+		return fmt.Errorf("ruleset %s: %s does not beat any move", d.Name, d.Moves[0])
+	}
+	for _, move := range d.Moves {
+		if len(d.Beats[move]) != wins || losses[move] != wins {
+			return fmt.Errorf("ruleset %s: graph is not balanced, %s beats %d and loses to %d moves (expected %d each)",
+				d.Name, move, len(d.Beats[move]), losses[move], wins)
+		}
+	}
+	return nil
+}
+
+// Compile validates the definition and returns the corresponding Ruleset
+func (d *Definition) Compile() (Ruleset, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+
+	g := &graph{
+		name:    d.Name,
+		moves:   append([]string(nil), d.Moves...),
+		beats:   make(map[string]map[string]string, len(d.Moves)),
+		symbols: make(map[string]string, len(d.Symbols)),
+	}
+	for _, move := range d.Moves {
+		g.beats[move] = make(map[string]string, len(d.Beats[move]))
+		for loser, verb := range d.Beats[move] {
+			g.beats[move][loser] = verb
+		}
+	}
+	for move, symbol := range d.Symbols {
+		g.symbols[move] = symbol
+	}
+	return g, nil
+}
+
+// Parse decodes a ruleset definition. The format is picked from the file extension
+// of name: .json, or .yaml/.yml.
+func Parse(name string, data []byte) (*Definition, error) {
+	var def Definition
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		if err := json.Unmarshal(data, &def); err != nil {
+			return nil, fmt.Errorf("error decoding ruleset %s: %w", name, err)
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &def); err != nil {
+			return nil, fmt.Errorf("error decoding ruleset %s: %w", name, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported ruleset file %s: expected .json, .yaml or .yml", name)
+	}
+	return &def, nil
+}
+
+// LoadFile reads, validates and registers the ruleset defined in a JSON or YAML file
+func LoadFile(filename string) (Ruleset, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	def, err := Parse(filename, data)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := def.Compile()
+	if err != nil {
+		return nil, err
+	}
+	Register(rs)
+	return rs, nil
+}
+
+// LoadDir registers every ruleset file (.json, .yaml, .yml) found in dir
+func LoadDir(dir string) ([]Ruleset, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var loaded []Ruleset
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".json", ".yaml", ".yml":
+		default:
+			continue
+		}
+		rs, err := LoadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return loaded, err
+		}
+		loaded = append(loaded, rs)
+	}
+	return loaded, nil
+}
+
+// loadBuiltins registers the rulesets shipped with the game
+func loadBuiltins() error {
+	entries, err := builtinFS.ReadDir("builtin")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		filename := path.Join("builtin", entry.Name())
+		data, err := builtinFS.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		def, err := Parse(filename, data)
+		if err != nil {
+			return err
+		}
+		rs, err := def.Compile()
+		if err != nil {
+			return err
+		}
+		Register(rs)
+	}
+	return nil
+}
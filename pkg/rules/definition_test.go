@@ -0,0 +1,162 @@
+package rules
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func classicDefinition() *Definition {
+	return &Definition{
+		Name:  "test-classic",
+		Moves: []string{"rock", "paper", "scissors"},
+		Beats: map[string]map[string]string{
+			"rock":     {"scissors": "crushes"},
+			"paper":    {"rock": "covers"},
+			"scissors": {"paper": "cuts"},
+		},
+		Symbols: map[string]string{"rock": "R"},
+	}
+}
+
+func TestDefinitionValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    func(d *Definition)
+		wantErr string
+	}{
+		{name: "balanced graph", edit: func(d *Definition) {}},
+		{
+			name: "balanced graph with five moves",
+			edit: func(d *Definition) {
+				d.Moves = []string{"a", "b", "c", "d", "e"}
+				d.Beats = map[string]map[string]string{
+					"a": {"b": "", "c": ""}, "b": {"c": "", "d": ""}, "c": {"d": "", "e": ""},
+					"d": {"e": "", "a": ""}, "e": {"a": "", "b": ""},
+				}
+			},
+		},
+		{name: "no name", edit: func(d *Definition) { d.Name = "" }, wantErr: "name is required"},
+		{name: "single move", edit: func(d *Definition) { d.Moves = []string{"rock"} }, wantErr: "at least two moves"},
+		{name: "empty move", edit: func(d *Definition) { d.Moves = append(d.Moves, "") }, wantErr: "empty move name"},
+		{name: "duplicate move", edit: func(d *Definition) { d.Moves = append(d.Moves, "rock") }, wantErr: `duplicate move "rock"`},
+		{name: "unknown winner", edit: func(d *Definition) { d.Beats["lizard"] = map[string]string{"paper": "eats"} }, wantErr: `unknown move "lizard"`},
+		{name: "unknown loser", edit: func(d *Definition) { d.Beats["rock"]["lizard"] = "crushes" }, wantErr: `rock beats unknown move "lizard"`},
+		{name: "move beating itself", edit: func(d *Definition) { d.Beats["rock"]["rock"] = "" }, wantErr: "rock cannot beat itself"},
+		{name: "moves beating each other", edit: func(d *Definition) { d.Beats["scissors"]["rock"] = "" }, wantErr: "beat each other"},
+		{name: "first move beats nothing", edit: func(d *Definition) { d.Beats = nil }, wantErr: "rock does not beat any move"},
+		{
+			name: "unbalanced graph",
+			edit: func(d *Definition) {
+				d.Beats["rock"]["paper"] = "wraps"
+				delete(d.Beats["paper"], "rock")
+			},
+			wantErr: "graph is not balanced",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := classicDefinition()
+			tt.edit(d)
+			err := d.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCompile(t *testing.T) {
+	rs, err := classicDefinition().Compile()
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	outcomes := []struct {
+		a, b string
+		want Outcome
+	}{
+		{"rock", "scissors", Win},
+		{"scissors", "rock", Lose},
+		{"paper", "rock", Win},
+		{"paper", "paper", Draw},
+	}
+	for _, o := range outcomes {
+		if got, err := rs.Outcome(o.a, o.b); err != nil || got != o.want {
+			t.Errorf("Outcome(%s, %s) = %v, %v, want %v", o.a, o.b, got, err, o.want)
+		}
+	}
+	if _, err := rs.Outcome("rock", "lizard"); !errors.Is(err, ErrInvalidMove) {
+		t.Errorf("Outcome(rock, lizard) error = %v, want %v", err, ErrInvalidMove)
+	}
+	if got := rs.Verb("rock", "scissors"); got != "crushes" {
+		t.Errorf("Verb(rock, scissors) = %q, want crushes", got)
+	}
+	if got := rs.Symbol("rock") + rs.Symbol("paper"); got != "Rpaper" {
+		t.Errorf("symbols = %q, want the symbol of rock and the name of paper", got)
+	}
+	if got := rs.Verb("paper", "rock"); got != "covers" {
+		t.Errorf("Verb(paper, rock) = %q, want covers", got)
+	}
+}
+
+func TestBuiltinRulesets(t *testing.T) {
+	for _, name := range []string{"classic", "rpsls", "rps7"} {
+		rs, err := Get(name)
+		if err != nil {
+			t.Errorf("Get(%s) error = %v", name, err)
+			continue
+		}
+		// A balanced graph gives every move as many wins as losses against the other moves
+		for _, a := range rs.Moves() {
+			wins, losses := 0, 0
+			for _, b := range rs.Moves() {
+				switch outcome, _ := rs.Outcome(a, b); outcome {
+				case Win:
+					wins++
+				case Lose:
+					losses++
+				}
+			}
+			if wins != losses || wins != (len(rs.Moves())-1)/2 {
+				t.Errorf("%s: %s wins %d and loses %d rounds", name, a, wins, losses)
+			}
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"duel.json": `{"name": "test-duel", "moves": ["fire", "water"], "beats": {"fire": {"water": "boils"}, "water": {"fire": "puts out"}}}`,
+		"trio.yaml": "name: test-trio\nmoves: [a, b, c]\nbeats:\n  a: {b: ''}\n  b: {c: ''}\n  c: {a: ''}\n",
+		"trio.txt":  "not a ruleset",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := LoadFile(filepath.Join(dir, "duel.json")); err == nil || !strings.Contains(err.Error(), "beat each other") {
+		t.Errorf("LoadFile(duel.json) error = %v, want the graph rejected", err)
+	}
+	if _, err := LoadFile(filepath.Join(dir, "trio.txt")); err == nil || !strings.Contains(err.Error(), "unsupported ruleset file") {
+		t.Errorf("LoadFile(trio.txt) error = %v, want the extension rejected", err)
+	}
+	rs, err := LoadFile(filepath.Join(dir, "trio.yaml"))
+	if err != nil {
+		t.Fatalf("LoadFile(trio.yaml) error = %v", err)
+	}
+	if registered, err := Get("test-trio"); err != nil || registered != rs {
+		t.Errorf("Get(test-trio) = %v, %v, want the loaded ruleset", registered, err)
+	}
+}
@@ -0,0 +1,165 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Default is the name of the ruleset used when a session does not pick one
+const Default = "classic"
+
+// Outcome is the result of a move played against another move
+type Outcome int
+
+const (
+	Draw Outcome = iota
+	Win
+	Lose
+)
+
+// ErrInvalidMove is returned when a move does not belong to the ruleset
+var ErrInvalidMove = errors.New("invalid move")
+
+// ErrUnknownRuleset is returned when no ruleset is registered under the requested name
+var ErrUnknownRuleset = errors.New("unknown ruleset")
+
+// Ruleset describes the moves of a game variant and how they beat each other.
+// Both the client (to validate choices) and the server (to resolve rounds) use it,
+// so a variant only has to be defined once.
+type Ruleset interface {
+	// Name returns the identifier of the variant, e.g. "classic"
+	Name() string
+	// Moves returns the valid moves in display order
+	Moves() []string
+	// IsValid reports whether move belongs to the ruleset
+	IsValid(move string) bool
+	// Outcome returns the outcome of move a played against move b
+	Outcome(a, b string) (Outcome, error)
+	// Symbol returns the display text of a move
+	Symbol(move string) string
+	// Verb returns how winner beats loser, e.g. "crushes"
+	Verb(winner, loser string) string
+}
+
+// graph is a Ruleset backed by a directed "beats" graph
+type graph struct {
+	name    string
+	moves   []string
+	beats   map[string]map[string]string // winner -> loser -> verb
+	symbols map[string]string
+}
+
+func (g *graph) Name() string {
+	return g.name
+}
+
+func (g *graph) Moves() []string {
+	moves := make([]string, len(g.moves))
+	copy(moves, g.moves)
+	return moves
+}
+
+func (g *graph) IsValid(move string) bool {
+	_, ok := g.beats[move]
+	return ok
+}
+
+func (g *graph) Outcome(a, b string) (Outcome, error) {
+	if !g.IsValid(a) {
+		return Draw, fmt.Errorf("%w: %q in ruleset %s", ErrInvalidMove, a, g.name)
+	}
+	if !g.IsValid(b) {
+		return Draw, fmt.Errorf("%w: %q in ruleset %s", ErrInvalidMove, b, g.name)
+	}
+	if _, ok := g.beats[a][b]; ok {
+		return Win, nil
+	}
+	if _, ok := g.beats[b][a]; ok {
+		return Lose, nil
+	}
+	return Draw, nil
+}
+
+func (g *graph) Symbol(move string) string {
+	if symbol, ok := g.symbols[move]; ok && symbol != "" {
+		return symbol
+	}
+	return move
+}
+
+func (g *graph) Verb(winner, loser string) string {
+	if verb := g.beats[winner][loser]; verb != "" {
+		return verb
+	}
+	return "beats"
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Ruleset{}
+)
+
+func init() {
+	if err := loadBuiltins(); err != nil {
+		panic(fmt.Sprintf("rules: invalid built-in ruleset: %v", err))
+	}
+}
+
+// Classic returns the traditional rock-paper-scissors ruleset
+func Classic() Ruleset {
+	rs, err := Get(Default)
+	if err != nil {
+		panic(err)
+	}
+	return rs
+}
+
+// Register makes a ruleset available under its name, replacing any previous one
+func Register(rs Ruleset) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[rs.Name()] = rs
+}
+
+// Get returns the ruleset registered under name. An empty name returns the default ruleset.
+func Get(name string) (Ruleset, error) {
+	if name == "" {
+		name = Default
+	}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	rs, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRuleset, name)
+	}
+	return rs, nil
+}
+
+// Names returns the names of all registered rulesets, sorted alphabetically
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DescribeMoves returns the valid moves of a ruleset as display text, e.g. "rock, paper, or scissors"
+func DescribeMoves(rs Ruleset) string {
+	moves := rs.Moves()
+	switch len(moves) {
+	case 0:
+		return ""
+	case 1:
+		return moves[0]
+	case 2:
+		return moves[0] + " or " + moves[1]
+	}
+	return strings.Join(moves[:len(moves)-1], ", ") + ", or " + moves[len(moves)-1]
+}
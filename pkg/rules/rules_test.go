@@ -0,0 +1,49 @@
+package rules
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClassic(t *testing.T) {
+	rs := Classic()
+	outcomes := []struct {
+		a, b string
+		want Outcome
+	}{
+		{"rock", "scissors", Win},
+		{"scissors", "rock", Lose},
+		{"paper", "rock", Win},
+		{"rock", "paper", Lose},
+		{"scissors", "paper", Win},
+		{"paper", "paper", Draw},
+	}
+	for _, o := range outcomes {
+		if got, err := rs.Outcome(o.a, o.b); err != nil || got != o.want {
+			t.Errorf("Outcome(%s, %s) = %v, %v, want %v", o.a, o.b, got, err, o.want)
+		}
+	}
+	for _, move := range []string{"lizard", "", "Rock"} {
+		if rs.IsValid(move) {
+			t.Errorf("IsValid(%q) = true", move)
+		}
+		if _, err := rs.Outcome("rock", move); !errors.Is(err, ErrInvalidMove) {
+			t.Errorf("Outcome(rock, %q) error = %v, want %v", move, err, ErrInvalidMove)
+		}
+	}
+	if got := rs.Verb("paper", "rock"); got != "covers" {
+		t.Errorf("Verb(paper, rock) = %q, want covers", got)
+	}
+	if got := DescribeMoves(rs); got != "rock, paper, or scissors" {
+		t.Errorf("DescribeMoves() = %q", got)
+	}
+}
+
+func TestGet(t *testing.T) {
+	if rs, err := Get(""); err != nil || rs.Name() != Default {
+		t.Errorf("Get(\"\") = %v, %v, want the default ruleset", rs, err)
+	}
+	if _, err := Get("unknown"); !errors.Is(err, ErrUnknownRuleset) {
+		t.Errorf("Get(unknown) error = %v, want %v", err, ErrUnknownRuleset)
+	}
+}
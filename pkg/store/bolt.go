@@ -0,0 +1,237 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"shifumi-game/pkg/engine"
+	"shifumi-game/pkg/models"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets of the bolt file: the snapshots of the sessions as JSON keyed by session ID, and a bucket
+// per session holding its records as JSON keyed by big-endian sequence number
+var (
+	sessionsBucket = []byte("sessions")
+	recordsBucket  = []byte("records")
+)
+
+// BoltLockTimeout is how long opening the bolt file waits for another process to release it
+const BoltLockTimeout = 5 * time.Second
+
+// BoltStore keeps the event logs and snapshots of the sessions in a local bbolt file. The file is held
+// open, and locked, by the process for as long as the store is open, so it is not shared with other
+// processes: the sessions are only written by this process, which wakes up its watchers itself.
+type BoltStore struct {
+	db *bolt.DB
+
+	mu      sync.Mutex
+	changed map[string]chan struct{} // Closed when the session is stored again
+}
+
+// NewBoltStore opens a store on a bolt file, created if needed
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: BoltLockTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(sessionsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(recordsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db, changed: map[string]chan struct{}{}}, nil
+}
+
+// Close closes the bolt file, releasing its lock
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
+
+// get rebuilds a session in a transaction from its snapshot and the records that follow it, nil if
+// it has never been stored
+func get(tx *bolt.Tx, sessionID string) (*models.GameSession, error) {
+	value := tx.Bucket(sessionsBucket).Get([]byte(sessionID))
+	if value == nil {
+		return nil, nil
+	}
+	var snapshot models.GameSession
+	if err := json.Unmarshal(value, &snapshot); err != nil {
+		return nil, err
+	}
+	records, err := readRecords(tx, sessionID, snapshot.Version+1)
+	if err != nil {
+		return nil, err
+	}
+	return engine.Fold(&snapshot, records)
+}
+
+// readRecords decodes the records of a session in a transaction, from a sequence number
+func readRecords(tx *bolt.Tx, sessionID string, from int64) ([]engine.Record, error) {
+	bucket := tx.Bucket(recordsBucket).Bucket([]byte(sessionID))
+	if bucket == nil {
+		return nil, nil
+	}
+	var records []engine.Record
+	c := bucket.Cursor()
+	for key, value := c.Seek(seqKey(from)); key != nil; key, value = c.Next() {
+		var record engine.Record
+		if err := json.Unmarshal(value, &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// seqKey returns the key of a record, so that the records of a session are sorted by sequence number
+func seqKey(seq int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(seq))
+	return key
+}
+
+// Get rebuilds the latest version of a session
+func (b *BoltStore) Get(ctx context.Context, sessionID string) (*models.GameSession, error) {
+	var session *models.GameSession
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		session, err = get(tx, sessionID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, ErrNotFound
+	}
+	return session, nil
+}
+
+// Append writes the records of a session update, and a snapshot of the session when one is due,
+// checking the version of the session in the same transaction
+func (b *BoltStore) Append(ctx context.Context, session *models.GameSession, records []engine.Record) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		stored, err := get(tx, session.SessionID)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(stored, session); err != nil {
+			return err
+		}
+
+		next := session.Clone()
+		sequence(next, records)
+		bucket, err := tx.Bucket(recordsBucket).CreateBucketIfNotExists([]byte(session.SessionID))
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			value, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(seqKey(r.Seq), value); err != nil {
+				return err
+			}
+		}
+		if snapshotDue(next, records) {
+			value, err := json.Marshal(next)
+			if err != nil {
+				return err
+			}
+			if err := tx.Bucket(sessionsBucket).Put([]byte(session.SessionID), value); err != nil {
+				return err
+			}
+		}
+		session.Version = next.Version
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b.notify(session.SessionID)
+	return nil
+}
+
+// notify wakes up the watchers of a session
+func (b *BoltStore) notify(sessionID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if changed, ok := b.changed[sessionID]; ok {
+		close(changed)
+		delete(b.changed, sessionID)
+	}
+}
+
+// History reads the records of a session
+func (b *BoltStore) History(ctx context.Context, sessionID string) ([]engine.Record, error) {
+	var records []engine.Record
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		records, err = readRecords(tx, sessionID, 1)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound
+	}
+	return records, nil
+}
+
+// List returns the IDs of the sessions, sorted
+func (b *BoltStore) List(ctx context.Context) ([]string, error) {
+	var sessionIDs []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).ForEach(func(key, _ []byte) error {
+			sessionIDs = append(sessionIDs, string(key))
+			return nil
+		})
+	})
+	return sessionIDs, err
+}
+
+// Watch hands the versions of a session to fn as they are stored
+func (b *BoltStore) Watch(ctx context.Context, sessionID string, fn func(*models.GameSession) bool) error {
+	handed := int64(-1)
+	for {
+		// The channel is taken before reading the session, so that a version stored in between wakes
+		// up the watcher
+		b.mu.Lock()
+		changed, watched := b.changed[sessionID]
+		if !watched {
+			changed = make(chan struct{})
+			b.changed[sessionID] = changed
+		}
+		b.mu.Unlock()
+
+		session, err := b.Get(ctx, sessionID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if session != nil && session.Version != handed {
+			handed = session.Version
+			if fn(session) {
+				return nil
+			}
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"shifumi-game/pkg/engine"
+	"shifumi-game/pkg/kafka"
+	"shifumi-game/pkg/models"
+	"sync"
+	"time"
+)
+
+// CatchUpTimeout is how long the Kafka store waits for its view to catch up with the session topics,
+// on startup before answering, and after an append to learn whether it was accepted
+const CatchUpTimeout = 30 * time.Second
+
+// CheckpointInterval is how often the Kafka store commits the offset the session events are replayed
+// from, and snapshots the sessions left behind it
+const CheckpointInterval = time.Minute
+
+// KafkaStore keeps the event logs of the sessions in the session-events topic, and their snapshots in
+// the compacted game-results topic. It serves the sessions from a local view: on startup, the view
+// loads the snapshots, then folds the records from the committed replay offset, and keeps following
+// the session events.
+//
+// The session events topic decides between concurrent updates, so that several instances can write:
+// every update is appended, and the first one read back from the version it was made from is the one
+// accepted, by every instance alike. Append waits for its update to be read back, and returns
+// ErrConflict when another one came first.
+//
+// The replay offset only moves past an update once a snapshot of its session includes it, so that an
+// update whose snapshot was never written is replayed rather than lost. Every CheckpointInterval, the
+// store commits it, and snapshots the sessions whose last update has been left out of their snapshot
+// since the previous checkpoint.
+type KafkaStore struct {
+	kafkaBroker string
+	writer      string // Tells the updates of this instance apart in the session events topic
+	view        *MemoryStore
+	ready       chan struct{} // Closed once the view has caught up with the session events
+	readyOnce   sync.Once
+
+	mu       sync.Mutex
+	position int64            // Offset of the last update read back
+	updates  map[string]int64 // Offset of the last accepted update of each session
+	covered  map[string]int64 // Offset of the last update included in the last snapshot read back of each session
+	idle     map[string]int64 // Offset of the last update of the sessions left out of their snapshot at the last checkpoint
+	outcomes map[int64]bool   // Whether the updates of this instance were accepted, by offset, until Append collects them
+	handled  chan struct{}    // Closed when an outcome is added
+}
+
+// NewKafkaStore returns a store on the session topics of a Kafka broker. The topics are followed in
+// the background for the lifetime of the process.
+func NewKafkaStore(kafkaBroker string) *KafkaStore {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("store: cannot read random bytes: %v", err))
+	}
+	k := &KafkaStore{
+		kafkaBroker: kafkaBroker,
+		writer:      hex.EncodeToString(b),
+		view:        NewMemoryStore(),
+		ready:       make(chan struct{}),
+		position:    -1,
+		updates:     map[string]int64{},
+		covered:     map[string]int64{},
+		idle:        map[string]int64{},
+		outcomes:    map[int64]bool{},
+		handled:     make(chan struct{}),
+	}
+	go func() {
+		for {
+			err := k.follow(context.Background())
+			log.Printf("[WARN] Game sessions watcher exited: %v. Restarting...", err)
+			time.Sleep(2 * time.Second)
+		}
+	}()
+	return k
+}
+
+// follow loads the snapshots into the view, then folds the session events from the replay offset,
+// keeping track of the snapshots written meanwhile and checkpointing the replay offset
+func (k *KafkaStore) follow(ctx context.Context) error {
+	from, err := kafka.ReplayOffset(ctx, k.kafkaBroker)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, 2)
+	loaded := make(chan struct{})
+	loading := true
+	go func() {
+		errs <- kafka.WatchGameSessions(ctx, k.kafkaBroker, func(sessionID string, session *models.GameSession, eventsOffset int64) {
+			k.handleSnapshot(sessionID, session, eventsOffset, loading)
+		}, func() {
+			if loading {
+				loading = false
+				close(loaded)
+			}
+		})
+	}()
+	select {
+	case <-loaded:
+	case err := <-errs:
+		return err
+	}
+
+	go func() {
+		errs <- kafka.TailRecords(ctx, k.kafkaBroker, from, k.handle, func() {
+			k.readyOnce.Do(func() { close(k.ready) })
+		})
+	}()
+	ticker := time.NewTicker(CheckpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-errs:
+			return err
+		case <-ticker.C:
+			k.checkpoint(ctx)
+		}
+	}
+}
+
+// handleSnapshot records the updates a snapshot includes, and loads it into the view while the
+// snapshots are being loaded. Afterwards, the view follows the session events only.
+func (k *KafkaStore) handleSnapshot(sessionID string, session *models.GameSession, eventsOffset int64, loading bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if session == nil {
+		delete(k.covered, sessionID)
+		if loading {
+			k.view.apply(sessionID, nil)
+			delete(k.updates, sessionID)
+		}
+		return
+	}
+	if covered, ok := k.covered[sessionID]; !ok || eventsOffset > covered {
+		k.covered[sessionID] = eventsOffset
+	}
+	if !loading {
+		return
+	}
+	k.view.apply(sessionID, session)
+	if last, ok := k.updates[sessionID]; !ok || eventsOffset > last {
+		k.updates[sessionID] = eventsOffset
+	}
+}
+
+// handle folds an update read from the session events topic into the view, and records whether it
+// was accepted when this instance appended it. Updates read again after the watcher restarts are
+// only folded.
+func (k *KafkaStore) handle(offset int64, writer string, records []engine.Record) {
+	// The offset of the last update of a session changes along with its version
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	accepted, err := k.view.applyRecords(records)
+	if err != nil {
+		log.Printf("[ERROR] Error folding session records | SessionID: %s | Offset: %d | Error: %v", records[0].SessionID, offset, err)
+	}
+	if accepted {
+		sessionID := records[0].SessionID
+		k.updates[sessionID] = offset
+		if _, ok := k.covered[sessionID]; !ok {
+			// No snapshot includes the updates of a session before it is created
+			k.covered[sessionID] = offset - 1
+		}
+	}
+
+	if offset <= k.position {
+		return
+	}
+	k.position = offset
+	if writer == k.writer {
+		k.outcomes[offset] = accepted
+		close(k.handled)
+		k.handled = make(chan struct{})
+	}
+}
+
+// checkpoint commits the replay offset: the oldest update that the snapshot of its session does not
+// include, or the update after the last one read back. The sessions whose last update was already
+// left out of their snapshot at the previous checkpoint are snapshotted from the view first, as the
+// snapshot due with it either failed to be written or is not due until the session is updated again.
+func (k *KafkaStore) checkpoint(ctx context.Context) {
+	select {
+	case <-k.ready:
+	default:
+		return
+	}
+
+	type snapshot struct {
+		session      *models.GameSession
+		eventsOffset int64
+	}
+	var behind []snapshot
+	k.mu.Lock()
+	low := k.position + 1
+	idle := map[string]int64{}
+	for sessionID, last := range k.updates {
+		covered := k.covered[sessionID]
+		if last <= covered {
+			continue
+		}
+		if covered+1 < low {
+			low = covered + 1
+		}
+		if previous, ok := k.idle[sessionID]; ok && previous == last {
+			if session, err := k.view.Get(ctx, sessionID); err == nil {
+				behind = append(behind, snapshot{session: session, eventsOffset: last})
+			}
+		}
+		idle[sessionID] = last
+	}
+	k.idle = idle
+	k.mu.Unlock()
+
+	// The replay offset moves past these sessions at the next checkpoint, once their snapshots are read back
+	for _, s := range behind {
+		if err := kafka.SaveGameSession(k.kafkaBroker, s.session, s.eventsOffset); err != nil {
+			log.Printf("[ERROR] Error saving session snapshot | SessionID: %s | Error: %v", s.session.SessionID, err)
+		}
+	}
+	if err := kafka.CommitReplayOffset(ctx, k.kafkaBroker, k.writer, low); err != nil {
+		log.Printf("[ERROR] Error committing the session events replay offset | Offset: %d | Error: %v", low, err)
+	}
+}
+
+// outcome waits for an update of this instance to be read back, and returns whether it was accepted
+func (k *KafkaStore) outcome(ctx context.Context, offset int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, CatchUpTimeout)
+	defer cancel()
+	for {
+		k.mu.Lock()
+		accepted, ok := k.outcomes[offset]
+		delete(k.outcomes, offset)
+		handled := k.handled
+		k.mu.Unlock()
+		if ok {
+			return accepted, nil
+		}
+
+		select {
+		case <-handled:
+		case <-ctx.Done():
+			return false, fmt.Errorf("session update at offset %d has not been read back: %w", offset, ctx.Err())
+		}
+	}
+}
+
+// waitReady waits for the view to catch up with the session topics
+func (k *KafkaStore) waitReady(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, CatchUpTimeout)
+	defer cancel()
+	select {
+	case <-k.ready:
+		return nil
+	case <-ctx.Done():
+		return errors.New("game sessions are still being loaded from Kafka")
+	}
+}
+
+// Get returns a session from the view
+func (k *KafkaStore) Get(ctx context.Context, sessionID string) (*models.GameSession, error) {
+	if err := k.waitReady(ctx); err != nil {
+		return nil, err
+	}
+	return k.view.Get(ctx, sessionID)
+}
+
+// Append publishes the records of a session update, waits for the view to accept it, then publishes
+// a snapshot of the session when one is due. Updates made from a version the view has already gone
+// past are rejected without being published.
+func (k *KafkaStore) Append(ctx context.Context, session *models.GameSession, records []engine.Record) error {
+	if err := k.waitReady(ctx); err != nil {
+		return err
+	}
+	k.mu.Lock()
+	stored, err := k.view.Get(ctx, session.SessionID)
+	previous, ok := k.updates[session.SessionID]
+	k.mu.Unlock()
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err := checkVersion(stored, session); err != nil {
+		return err
+	}
+	if !ok {
+		previous = -1
+	}
+
+	version := session.Version
+	sequence(session, records)
+	offset, err := kafka.AppendRecords(ctx, k.kafkaBroker, k.writer, previous, records)
+	if err == nil {
+		var accepted bool
+		if accepted, err = k.outcome(ctx, offset); err == nil && !accepted {
+			err = fmt.Errorf("%w: session %s was updated from version %d first", ErrConflict, session.SessionID, version)
+		}
+	}
+	if err != nil {
+		session.Version = version
+		return err
+	}
+
+	if snapshotDue(session, records) {
+		// The records are stored: the replay offset stays before them until the next checkpoint
+		// snapshots the session
+		if err := kafka.SaveGameSession(k.kafkaBroker, session, offset); err != nil {
+			log.Printf("[ERROR] Error saving session snapshot | SessionID: %s | Error: %v", session.SessionID, err)
+		}
+	}
+	return nil
+}
+
+// History reads the records of a session from the session events topic, without the updates that
+// lost to a concurrent one. The updates of the session are read back from the last one the view
+// accepted.
+func (k *KafkaStore) History(ctx context.Context, sessionID string) ([]engine.Record, error) {
+	if err := k.waitReady(ctx); err != nil {
+		return nil, err
+	}
+	k.mu.Lock()
+	last, ok := k.updates[sessionID]
+	k.mu.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	batches, err := kafka.ReadSessionRecords(ctx, k.kafkaBroker, last)
+	if err != nil {
+		return nil, err
+	}
+	var records []engine.Record
+	for _, batch := range batches {
+		if len(records) == 0 || batch[0].Seq == records[len(records)-1].Seq+1 {
+			records = append(records, batch...)
+		}
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound
+	}
+	return records, nil
+}
+
+// List returns the IDs of the sessions of the view
+func (k *KafkaStore) List(ctx context.Context) ([]string, error) {
+	if err := k.waitReady(ctx); err != nil {
+		return nil, err
+	}
+	return k.view.List(ctx)
+}
+
+// Watch hands the versions of a session to fn as the view receives them
+func (k *KafkaStore) Watch(ctx context.Context, sessionID string, fn func(*models.GameSession) bool) error {
+	if err := k.waitReady(ctx); err != nil {
+		return err
+	}
+	return k.view.Watch(ctx, sessionID, fn)
+}
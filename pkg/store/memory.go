@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"shifumi-game/pkg/engine"
+	"shifumi-game/pkg/models"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps the sessions and their event logs in memory. They are lost when the process
+// exits, and are not shared with other processes.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]*models.GameSession
+	records  map[string][]engine.Record
+	changed  map[string]chan struct{} // Closed when the session is stored again
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: map[string]*models.GameSession{}, records: map[string][]engine.Record{}, changed: map[string]chan struct{}{}}
+}
+
+// Get returns a copy of the latest version of a session
+func (m *MemoryStore) Get(ctx context.Context, sessionID string) (*models.GameSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return session.Clone(), nil
+}
+
+// Append stores a copy of a session with its records and wakes up its watchers
+func (m *MemoryStore) Append(ctx context.Context, session *models.GameSession, records []engine.Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := checkVersion(m.sessions[session.SessionID], session); err != nil {
+		return err
+	}
+	sequence(session, records)
+	m.records[session.SessionID] = append(m.records[session.SessionID], records...)
+	m.set(session.SessionID, session.Clone())
+	return nil
+}
+
+// History returns the records of a session
+func (m *MemoryStore) History(ctx context.Context, sessionID string) ([]engine.Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[sessionID]; !ok {
+		return nil, ErrNotFound
+	}
+	return append([]engine.Record(nil), m.records[sessionID]...), nil
+}
+
+// set replaces a session and wakes up its watchers, with m.mu held
+func (m *MemoryStore) set(sessionID string, session *models.GameSession) {
+	m.sessions[sessionID] = session
+	if changed, ok := m.changed[sessionID]; ok {
+		close(changed)
+		delete(m.changed, sessionID)
+	}
+}
+
+// apply sets a session as it was stored elsewhere, unless it is older than the version held, and wakes
+// up its watchers. A nil session is removed.
+func (m *MemoryStore) apply(sessionID string, session *models.GameSession) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if session == nil {
+		delete(m.sessions, sessionID)
+		return
+	}
+	if stored, ok := m.sessions[sessionID]; ok && stored.Version > session.Version {
+		return
+	}
+	m.set(sessionID, session)
+}
+
+// applyRecords folds the records of a session update stored elsewhere into its session, and returns
+// whether they were accepted. An update that does not follow the version held is skipped: the session
+// either already includes it, or it was appended from the same version as an update that came first.
+func (m *MemoryStore) applyRecords(records []engine.Record) (bool, error) {
+	if len(records) == 0 {
+		return false, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current := m.sessions[records[0].SessionID]
+	if current != nil && records[0].Seq <= current.Version {
+		return false, nil
+	}
+	session, err := engine.Fold(current, records)
+	if err != nil {
+		return false, err
+	}
+	m.set(records[0].SessionID, session)
+	return true, nil
+}
+
+// List returns the IDs of the sessions, sorted
+func (m *MemoryStore) List(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sessionIDs := make([]string, 0, len(m.sessions))
+	for sessionID := range m.sessions {
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	sort.Strings(sessionIDs)
+	return sessionIDs, nil
+}
+
+// Watch hands the versions of a session to fn as they are stored
+func (m *MemoryStore) Watch(ctx context.Context, sessionID string, fn func(*models.GameSession) bool) error {
+	handed := int64(-1)
+	for {
+		m.mu.Lock()
+		session, ok := m.sessions[sessionID]
+		if ok {
+			session = session.Clone()
+		}
+		changed, watched := m.changed[sessionID]
+		if !watched {
+			changed = make(chan struct{})
+			m.changed[sessionID] = changed
+		}
+		m.mu.Unlock()
+
+		if ok && session.Version != handed {
+			handed = session.Version
+			if fn(session) {
+				return nil
+			}
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
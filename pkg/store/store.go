@@ -0,0 +1,140 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"shifumi-game/pkg/engine"
+	"shifumi-game/pkg/models"
+)
+
+// Kinds of session stores
+const (
+	KindKafka  = "kafka"  // Sessions in the compacted game-results topic
+	KindMemory = "memory" // Sessions held in memory, for tests and single-process dev: not shared with any other process
+	KindBolt   = "bolt"   // Sessions in a local bbolt file, for durable single-process dev: not shared with any other process
+)
+
+// DefaultBoltPath is the file of the bolt store when no path is given
+const DefaultBoltPath = "sessions.db"
+
+var (
+	// ErrNotFound is returned for a session that has never been stored
+	ErrNotFound = errors.New("session not found")
+	// ErrConflict is returned when a session is stored from a version that is no longer the latest one
+	ErrConflict = errors.New("session was updated concurrently")
+)
+
+// SnapshotInterval is the number of records after which the stores that keep an event log take a
+// snapshot of the session, so that rebuilding it only folds the records that follow the snapshot
+const SnapshotInterval = 20
+
+// SessionStore holds the game sessions. Every session update is stored as records of its event log
+// (see engine.Record), and every stored session carries a version, the sequence number of its last
+// record, so that a session read, updated and stored again does not overwrite a newer update.
+type SessionStore interface {
+	// Get returns the latest version of a session, or ErrNotFound
+	Get(ctx context.Context, sessionID string) (*models.GameSession, error)
+	// Append stores the records of an update of a session. session is the updated session, still at
+	// the version it was read at, 0 for a new session; it gets the version of the last record. Append
+	// returns ErrConflict if the stored session is not at that version anymore.
+	Append(ctx context.Context, session *models.GameSession, records []engine.Record) error
+	// History returns the event log of a session, or ErrNotFound
+	History(ctx context.Context, sessionID string) ([]engine.Record, error)
+	// List returns the IDs of the stored sessions
+	List(ctx context.Context) ([]string, error)
+	// Watch hands the latest version of a session, then every later one, to fn until fn returns true
+	// or ctx is done. Versions replaced before they are handed over may be skipped.
+	Watch(ctx context.Context, sessionID string, fn func(*models.GameSession) bool) error
+}
+
+// New returns the session store of the given kind, the Kafka store by default. path is the file of
+// the bolt store.
+func New(kind, kafkaBroker, path string) (SessionStore, error) {
+	switch kind {
+	case "", KindKafka:
+		return NewKafkaStore(kafkaBroker), nil
+	case KindMemory:
+		return NewMemoryStore(), nil
+	case KindBolt:
+		if path == "" {
+			path = DefaultBoltPath
+		}
+		return NewBoltStore(path)
+	default:
+		return nil, fmt.Errorf("unknown session store %q, expected %s, %s or %s", kind, KindKafka, KindMemory, KindBolt)
+	}
+}
+
+// NewShared returns the session store of a service, which shares the sessions with the other
+// services. The memory and bolt stores are only held by the process that opened them, so they are
+// rejected unless singleProcess is set, i.e. the client and game-logic services run in the same
+// process (see cmd/dev).
+func NewShared(kind, kafkaBroker, path string, singleProcess bool) (SessionStore, error) {
+	if !singleProcess && (kind == KindMemory || kind == KindBolt) {
+		return nil, fmt.Errorf("the %s session store is not shared between processes, expected %s, or run the services in a single process with cmd/dev", kind, KindKafka)
+	}
+	return New(kind, kafkaBroker, path)
+}
+
+// sequence numbers the records of an update of a session, and sets the version of the session to
+// the sequence number of the last one
+func sequence(session *models.GameSession, records []engine.Record) {
+	for i := range records {
+		records[i].SessionID = session.SessionID
+		records[i].Seq = session.Version + int64(i) + 1
+	}
+	session.Version += int64(len(records))
+}
+
+// snapshotDue returns whether a snapshot of a session is taken once the records are stored: when it
+// is created, every SnapshotInterval records, and once it is over
+func snapshotDue(session *models.GameSession, records []engine.Record) bool {
+	from := session.Version - int64(len(records))
+	return from == 0 || session.IsOver() || from/SnapshotInterval != session.Version/SnapshotInterval
+}
+
+// checkVersion returns ErrConflict unless a session is stored from the version that is currently
+// stored, stored being nil for a session that has never been stored
+func checkVersion(stored, session *models.GameSession) error {
+	current := int64(0)
+	if stored != nil {
+		current = stored.Version
+	}
+	if session.Version != current {
+		return fmt.Errorf("%w: session %s is at version %d, not %d", ErrConflict, session.SessionID, current, session.Version)
+	}
+	return nil
+}
+
+// sessionIDLetters are the characters of the random part of session IDs
+const sessionIDLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// NewSessionID returns a session ID made of the prefix and 10 characters from a cryptographically
+// secure source, checked against the sessions of the store
+func NewSessionID(ctx context.Context, s SessionStore, prefix string) (string, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		b := make([]byte, 10)
+		for i := range b {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(sessionIDLetters))))
+			if err != nil {
+				return "", err
+			}
+			b[i] = sessionIDLetters[n.Int64()]
+		}
+		sessionID := prefix + string(b)
+
+		_, err := s.Get(ctx, sessionID)
+		if errors.Is(err, ErrNotFound) {
+			return sessionID, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		log.Printf("[INFO] Session ID collision, drawing another one | SessionID: %s", sessionID)
+	}
+	return "", errors.New("could not draw an unused session ID")
+}
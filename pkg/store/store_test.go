@@ -0,0 +1,333 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"shifumi-game/pkg/engine"
+	"shifumi-game/pkg/models"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// TestSessionStores runs the same checks against every store that can run without a broker
+func TestSessionStores(t *testing.T) {
+	stores := []struct {
+		name     string
+		newStore func(t *testing.T) SessionStore
+	}{
+		{name: KindMemory, newStore: func(t *testing.T) SessionStore { return NewMemoryStore() }},
+		{name: KindBolt, newStore: func(t *testing.T) SessionStore {
+			s, err := NewBoltStore(filepath.Join(t.TempDir(), DefaultBoltPath))
+			if err != nil {
+				t.Fatalf("NewBoltStore() error = %v", err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		}},
+	}
+	checks := []struct {
+		name  string
+		check func(t *testing.T, s SessionStore)
+	}{
+		{name: "append and get", check: testAppendAndGet},
+		{name: "version conflicts", check: testVersionConflicts},
+		{name: "snapshots", check: testSnapshots},
+		{name: "history", check: testHistory},
+		{name: "list", check: testList},
+		{name: "watch", check: testWatch},
+		{name: "watch until cancelled", check: testWatchCancelled},
+	}
+	for _, st := range stores {
+		t.Run(st.name, func(t *testing.T) {
+			for _, c := range checks {
+				t.Run(c.name, func(t *testing.T) {
+					c.check(t, st.newStore(t))
+				})
+			}
+		})
+	}
+}
+
+func TestNewShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultBoltPath)
+	for _, kind := range []string{KindMemory, KindBolt} {
+		if _, err := NewShared(kind, "", path, false); err == nil {
+			t.Errorf("NewShared(%s) across processes: want an error", kind)
+		}
+	}
+	memory, err := NewShared(KindMemory, "", "", true)
+	if _, ok := memory.(*MemoryStore); err != nil || !ok {
+		t.Errorf("NewShared(%s) in a single process = %T, %v, want the memory store", KindMemory, memory, err)
+	}
+	bolt, err := NewShared(KindBolt, "", path, true)
+	if _, ok := bolt.(*BoltStore); err != nil || !ok {
+		t.Fatalf("NewShared(%s) in a single process = %T, %v, want the bolt store", KindBolt, bolt, err)
+	}
+	bolt.(*BoltStore).Close()
+}
+
+// create stores a new 2-player session
+func create(t *testing.T, s SessionStore, sessionID string) *models.GameSession {
+	t.Helper()
+	session, _, err := engine.New(sessionID, models.SessionOptions{}, "", t0)
+	if err != nil {
+		t.Fatalf("engine.New() error = %v", err)
+	}
+	if err := s.Append(context.Background(), session, []engine.Record{engine.CreationRecord(session, t0)}); err != nil {
+		t.Fatalf("Append(creation) error = %v", err)
+	}
+	return session
+}
+
+// play applies a move to a session read from the store, and stores the update
+func play(t *testing.T, s SessionStore, sessionID string, move engine.Move) *models.GameSession {
+	t.Helper()
+	session, err := s.Get(context.Background(), sessionID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	updated, events, err := engine.Apply(session, move)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if err := s.Append(context.Background(), updated, engine.MoveRecords(updated, move, events)); err != nil {
+		t.Fatalf("Append(%s) error = %v", move.Type, err)
+	}
+	return updated
+}
+
+func join(playerID string) engine.Move {
+	return engine.Move{Type: models.MessageJoin, PlayerID: playerID, At: t0}
+}
+
+func choice(playerID, move string) engine.Move {
+	return engine.Move{Type: models.MessageChoice, PlayerID: playerID, Choice: move, At: t0}
+}
+
+// wantSession checks the parts of a stored session that the stores rebuild from the log
+func wantSession(t *testing.T, got, want *models.GameSession) {
+	t.Helper()
+	if got.Version != want.Version || got.Status != want.Status || got.CurrentRound != want.CurrentRound ||
+		!reflect.DeepEqual(got.Players, want.Players) || got.Draws != want.Draws || got.Winner != want.Winner {
+		t.Errorf("stored session = %+v\nwant %+v", got, want)
+	}
+}
+
+func testAppendAndGet(t *testing.T, s SessionStore) {
+	ctx := context.Background()
+	if _, err := s.Get(ctx, "unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(unknown) error = %v, want %v", err, ErrNotFound)
+	}
+
+	created := create(t, s, "session-1")
+	if created.Version != 1 {
+		t.Fatalf("version after creation = %d, want 1", created.Version)
+	}
+	got, err := s.Get(ctx, "session-1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	wantSession(t, got, created)
+
+	play(t, s, "session-1", join("2"))
+	updated := play(t, s, "session-1", choice("1", "rock"))
+	if updated.Version != 3 {
+		t.Fatalf("version after two moves = %d, want 3", updated.Version)
+	}
+	got, err = s.Get(ctx, "session-1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	wantSession(t, got, updated)
+
+	// The store keeps its own copy
+	got.Players[0].Wins = 10
+	if again, _ := s.Get(ctx, "session-1"); again.Players[0].Wins != 0 {
+		t.Errorf("changing a session read from the store changed the stored session")
+	}
+}
+
+func testVersionConflicts(t *testing.T, s SessionStore) {
+	ctx := context.Background()
+	created := create(t, s, "session-1")
+
+	again, _, _ := engine.New("session-1", models.SessionOptions{}, "", t0)
+	if err := s.Append(ctx, again, []engine.Record{engine.CreationRecord(again, t0)}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("creating a session twice: error = %v, want %v", err, ErrConflict)
+	}
+
+	// Two updates read at the same version: the second one is rejected
+	first, events, err := engine.Apply(created, join("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append(ctx, first, engine.MoveRecords(first, join("2"), events)); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	second, events, err := engine.Apply(created, choice("2", "rock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append(ctx, second, engine.MoveRecords(second, choice("2", "rock"), events)); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Append() from a stale version: error = %v, want %v", err, ErrConflict)
+	}
+	if second.Version != 1 {
+		t.Errorf("version of the rejected update = %d, want it left at 1", second.Version)
+	}
+
+	got, err := s.Get(ctx, "session-1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	wantSession(t, got, first)
+	if history, _ := s.History(ctx, "session-1"); len(history) != 2 {
+		t.Errorf("history has %d records, want the rejected update left out", len(history))
+	}
+}
+
+func testSnapshots(t *testing.T, s SessionStore) {
+	create(t, s, "session-1")
+	play(t, s, "session-1", join("2"))
+	// Drawn rounds keep the game going past a few snapshots
+	var last *models.GameSession
+	for i := 0; i < SnapshotInterval; i++ {
+		play(t, s, "session-1", choice("1", "rock"))
+		last = play(t, s, "session-1", choice("2", "rock"))
+	}
+	if last.Version <= 2*SnapshotInterval {
+		t.Fatalf("version = %d, want past two snapshots", last.Version)
+	}
+
+	got, err := s.Get(context.Background(), "session-1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	wantSession(t, got, last)
+	if got.Draws != SnapshotInterval {
+		t.Errorf("draws = %d, want %d", got.Draws, SnapshotInterval)
+	}
+}
+
+func testHistory(t *testing.T, s SessionStore) {
+	ctx := context.Background()
+	if _, err := s.History(ctx, "unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("History(unknown) error = %v, want %v", err, ErrNotFound)
+	}
+
+	create(t, s, "session-1")
+	create(t, s, "session-2")
+	play(t, s, "session-1", join("2"))
+	play(t, s, "session-1", choice("1", "rock"))
+	play(t, s, "session-1", choice("2", "scissors"))
+
+	history, err := s.History(ctx, "session-1")
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	want := []engine.RecordType{
+		engine.RecordSessionCreated, engine.RecordPlayerJoined,
+		engine.RecordMoveSubmitted, engine.RecordMoveSubmitted, engine.RecordRoundResolved,
+	}
+	if len(history) != len(want) {
+		t.Fatalf("history has %d records, want %d", len(history), len(want))
+	}
+	for i, r := range history {
+		if r.Seq != int64(i+1) || r.Type != want[i] || r.SessionID != "session-1" {
+			t.Errorf("record %d = %d %s of %s, want %d %s of session-1", i, r.Seq, r.Type, r.SessionID, i+1, want[i])
+		}
+	}
+	if history[4].Round == nil || history[4].Round.WinnerID != "1" {
+		t.Errorf("round-resolved record = %+v, want round 1 won by player 1", history[4].Round)
+	}
+
+	folded, err := engine.Fold(nil, history)
+	if err != nil {
+		t.Fatalf("Fold(history) error = %v", err)
+	}
+	got, _ := s.Get(ctx, "session-1")
+	wantSession(t, folded, got)
+}
+
+func testList(t *testing.T, s SessionStore) {
+	ctx := context.Background()
+	if sessionIDs, err := s.List(ctx); err != nil || len(sessionIDs) != 0 {
+		t.Fatalf("List() = %v, %v, want no sessions", sessionIDs, err)
+	}
+	create(t, s, "session-b")
+	create(t, s, "session-a")
+	play(t, s, "session-a", join("2"))
+
+	sessionIDs, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if want := []string{"session-a", "session-b"}; !reflect.DeepEqual(sessionIDs, want) {
+		t.Errorf("List() = %v, want %v", sessionIDs, want)
+	}
+}
+
+func testWatch(t *testing.T, s SessionStore) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	versions := make(chan int64, 10)
+	done := make(chan error, 1)
+	go func() {
+		// The session is created after the watch starts
+		done <- s.Watch(ctx, "session-1", func(session *models.GameSession) bool {
+			versions <- session.Version
+			return session.Version >= 3
+		})
+	}()
+
+	create(t, s, "session-1")
+	play(t, s, "session-1", join("2"))
+	play(t, s, "session-1", choice("1", "rock"))
+
+	if err := <-done; err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	close(versions)
+	handed := int64(0)
+	for version := range versions {
+		if version <= handed {
+			t.Errorf("Watch handed version %d after version %d", version, handed)
+		}
+		handed = version
+	}
+	if handed != 3 {
+		t.Errorf("last version handed = %d, want 3", handed)
+	}
+}
+
+func testWatchCancelled(t *testing.T, s SessionStore) {
+	create(t, s, "session-1")
+	ctx, cancel := context.WithCancel(context.Background())
+	handed := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Watch(ctx, "session-1", func(session *models.GameSession) bool {
+			close(handed)
+			return false
+		})
+	}()
+
+	select {
+	case <-handed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Watch did not hand the stored session")
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Watch() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Watch did not return once cancelled")
+	}
+}